@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aHugues/system-monitor/monitor/checks"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// runCheck evaluates a probe against its thresholds as a Nagios plugin, printing
+// a single line and returning the exit code of the state
+func runCheck(args []string) int {
+	usage := fmt.Sprintf("Usage: monitor check <%s> [flags]", strings.Join(checks.Names, "|"))
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("UNKNOWN - " + usage)
+		return int(checks.Unknown)
+	}
+	name := args[0]
+
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	warning := flags.String("w", "", "Warning range, the configured one by default")
+	critical := flags.String("c", "", "Critical range, the configured one by default")
+	mounts := flags.String("mount", "", "Comma-separated mount points checked by the disk check, all of them by default")
+	services := flags.String("service", "", "Comma-separated services checked by the service check, the configured ones by default")
+	options := newConfigOptions(flags)
+	if err := flags.Parse(args[1:]); err != nil {
+		fmt.Println("UNKNOWN - " + usage)
+		return int(checks.Unknown)
+	}
+
+	useStderrLogger()
+	config, _, err := options.load()
+	if err != nil {
+		fmt.Printf("%s UNKNOWN - Invalid configuration: %s\n", strings.ToUpper(name), strings.Join(configErrors(err), "; "))
+		return int(checks.Unknown)
+	}
+
+	result := check(name, config, *warning, *critical, *mounts, *services)
+	fmt.Println(result)
+	return int(result.State)
+}
+
+// splitList splits a comma-separated list, ignoring the empty items
+func splitList(text string) []string {
+	items := []string{}
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// thresholds returns the configured thresholds of a check, overridden by the flags
+func thresholds(config utils.ThresholdConfig, warning string, critical string) (checks.Thresholds, error) {
+	if warning != "" {
+		config.Warning = warning
+	}
+	if critical != "" {
+		config.Critical = critical
+	}
+	return checks.NewThresholds(config)
+}
+
+// check runs the probe of a check and evaluates its result
+func check(name string, config utils.FullConfiguration, warning string, critical string, mounts string, services string) checks.Result {
+	thresholdConfigs := map[string]utils.ThresholdConfig{
+		"disk":   config.Checks.Disk,
+		"ram":    config.Checks.RAM,
+		"uptime": config.Checks.Uptime,
+		"load":   config.Checks.Load,
+	}
+	t, err := thresholds(thresholdConfigs[name], warning, critical)
+	if err != nil {
+		return checks.UnknownResult(name, err)
+	}
+
+	switch name {
+	case "disk":
+		devices := probes.GetUsageStats(probes.LinuxCommandRunner{})
+		if selected := splitList(mounts); len(selected) > 0 {
+			filtered := []probes.DeviceStat{}
+			for _, device := range devices {
+				for _, mount := range selected {
+					if device.MountPoint == mount {
+						filtered = append(filtered, device)
+					}
+				}
+			}
+			devices = filtered
+		}
+		return checks.Disk(devices, t)
+	case "ram":
+		return checks.RAM(probes.GetRAMUsage(probes.LinuxCommandRunner{}), t)
+	case "service":
+		names := config.Probes.SystemdServices
+		if selected := splitList(services); len(selected) > 0 {
+			names = selected
+		}
+		return checks.Services(probes.GetServicesStatuses(probes.LinuxCommandRunner{}, names))
+	case "uptime":
+		uptime, err := probes.GetUptime()
+		if err != nil {
+			return checks.UnknownResult(name, err)
+		}
+		return checks.Uptime(uptime, t)
+	case "load":
+		load, err := probes.GetLoadAverage()
+		if err != nil {
+			return checks.UnknownResult(name, err)
+		}
+		return checks.Load(load, t)
+	}
+	return checks.UnknownResult(name, fmt.Errorf("Unknown check %q, expecting one of %q", name, checks.Names))
+}
@@ -0,0 +1,210 @@
+package checks
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// State is the result of a check, its value being the exit code of a Nagios plugin
+type State int
+
+// States of a check, OK to Critical being ordered by severity
+const (
+	OK       State = 0
+	Warning  State = 1
+	Critical State = 2
+	Unknown  State = 3
+)
+
+func (s State) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// Names lists the available checks
+var Names = []string{"disk", "ram", "service", "uptime", "load"}
+
+// Thresholds are the ranges outside of which a check warns or fails
+type Thresholds struct {
+	Warning  *utils.Range
+	Critical *utils.Range
+}
+
+// NewThresholds parses the ranges of a configuration
+func NewThresholds(config utils.ThresholdConfig) (Thresholds, error) {
+	warning, err := utils.ParseRange(config.Warning)
+	if err != nil {
+		return Thresholds{}, err
+	}
+	critical, err := utils.ParseRange(config.Critical)
+	if err != nil {
+		return Thresholds{}, err
+	}
+	return Thresholds{Warning: warning, Critical: critical}, nil
+}
+
+// State returns the state of a value
+func (t Thresholds) State(value float64) State {
+	if t.Critical.Alerts(value) {
+		return Critical
+	}
+	if t.Warning.Alerts(value) {
+		return Warning
+	}
+	return OK
+}
+
+// Perfdata is a value reported to the monitoring system with its thresholds
+type Perfdata struct {
+	Label      string
+	Value      float64
+	Unit       string
+	Thresholds Thresholds
+	Min        string
+	Max        string
+}
+
+func (p Perfdata) String() string {
+	label := p.Label
+	if strings.ContainsAny(label, " '=") {
+		label = "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	value := strconv.FormatFloat(p.Value, 'f', -1, 64)
+	data := fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", label, value, p.Unit, p.Thresholds.Warning, p.Thresholds.Critical, p.Min, p.Max)
+	return strings.TrimRight(data, ";")
+}
+
+// Result is the outcome of a check, printed as the single line of a Nagios plugin
+type Result struct {
+	Name     string
+	State    State
+	Summary  string
+	Perfdata []Perfdata
+}
+
+func (r Result) String() string {
+	line := fmt.Sprintf("%s %s - %s", strings.ToUpper(r.Name), r.State, r.Summary)
+	if len(r.Perfdata) == 0 {
+		return line
+	}
+	perfdata := make([]string, 0, len(r.Perfdata))
+	for _, p := range r.Perfdata {
+		perfdata = append(perfdata, p.String())
+	}
+	return line + " | " + strings.Join(perfdata, " ")
+}
+
+// UnknownResult reports a check that could not be run
+func UnknownResult(name string, err error) Result {
+	return Result{Name: name, State: Unknown, Summary: err.Error()}
+}
+
+// percent returns the share of a total as a percentage rounded to one decimal
+func percent(value int64, total int64) float64 {
+	return float64(int64(float64(value)*1000/float64(total)+0.5)) / 10
+}
+
+// Disk checks the used percentage of each mount point, the worst one giving the state.
+// The percentage is computed in bytes so that the small mount points are checked.
+func Disk(devices []probes.DeviceStat, thresholds Thresholds) Result {
+	result := Result{Name: "disk", State: OK}
+	if len(devices) == 0 {
+		return Result{Name: "disk", State: Unknown, Summary: "No mount point found"}
+	}
+	usages := []string{}
+	for _, device := range devices {
+		if device.SizeBytes == 0 {
+			continue
+		}
+		used := percent(device.UsedBytes, device.SizeBytes)
+		if state := thresholds.State(used); state > result.State {
+			result.State = state
+		}
+		usages = append(usages, fmt.Sprintf("%s %v%% used", device.MountPoint, used))
+		result.Perfdata = append(result.Perfdata, Perfdata{Label: device.MountPoint, Value: used, Unit: "%", Thresholds: thresholds, Min: "0", Max: "100"})
+	}
+	result.Summary = strings.Join(usages, ", ")
+	return result
+}
+
+// RAM checks the used percentage of the memory
+func RAM(ram probes.RAMStats, thresholds Thresholds) Result {
+	if ram.Available == 0 {
+		return Result{Name: "ram", State: Unknown, Summary: "Memory usage not available"}
+	}
+	used := percent(ram.Used, ram.Available)
+	return Result{
+		Name:    "ram",
+		State:   thresholds.State(used),
+		Summary: fmt.Sprintf("%v%% used (%d of %d kB)", used, ram.Used, ram.Available),
+		Perfdata: []Perfdata{
+			{Label: "used", Value: used, Unit: "%", Thresholds: thresholds, Min: "0", Max: "100"},
+			{Label: "used_memory", Value: float64(ram.Used), Unit: "KB", Min: "0", Max: strconv.FormatInt(ram.Available, 10)},
+		},
+	}
+}
+
+// Services checks that all the services are active, any inactive one being critical
+func Services(statuses map[string]bool) Result {
+	if len(statuses) == 0 {
+		return Result{Name: "service", State: Unknown, Summary: "No service to check"}
+	}
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := Result{Name: "service", State: OK}
+	states := []string{}
+	active := 0
+	for _, name := range names {
+		if statuses[name] {
+			active++
+			states = append(states, name+" active")
+			continue
+		}
+		result.State = Critical
+		states = append(states, name+" inactive")
+	}
+	result.Summary = strings.Join(states, ", ")
+	result.Perfdata = []Perfdata{{Label: "active", Value: float64(active), Min: "0", Max: strconv.Itoa(len(names))}}
+	return result
+}
+
+// Uptime checks the time since the last boot, in seconds
+func Uptime(uptime int64, thresholds Thresholds) Result {
+	return Result{
+		Name:     "uptime",
+		State:    thresholds.State(float64(uptime)),
+		Summary:  fmt.Sprintf("up %s", time.Duration(uptime)*time.Second),
+		Perfdata: []Perfdata{{Label: "uptime", Value: float64(uptime), Unit: "s", Thresholds: thresholds, Min: "0"}},
+	}
+}
+
+// Load checks the load average over one minute, the others being reported as perfdata
+func Load(load probes.LoadAverage, thresholds Thresholds) Result {
+	return Result{
+		Name:    "load",
+		State:   thresholds.State(load.Load1),
+		Summary: fmt.Sprintf("load average %v, %v, %v", load.Load1, load.Load5, load.Load15),
+		Perfdata: []Perfdata{
+			{Label: "load1", Value: load.Load1, Thresholds: thresholds, Min: "0"},
+			{Label: "load5", Value: load.Load5, Min: "0"},
+			{Label: "load15", Value: load.Load15, Min: "0"},
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package checks
+
+import (
+	"testing"
+
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+func testThresholds(t *testing.T, warning string, critical string) Thresholds {
+	thresholds, err := NewThresholds(utils.ThresholdConfig{Warning: warning, Critical: critical})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	return thresholds
+}
+
+// Test that the worst mount point gives the state of the disk check
+func TestDisk(t *testing.T) {
+	devices := []probes.DeviceStat{
+		{Filesystem: "/dev/sda1", MountPoint: "/", Size: 100, Used: 50, SizeBytes: 100 << 30, UsedBytes: 50 << 30},
+		{Filesystem: "/dev/sda2", MountPoint: "/var lib", Size: 200, Used: 170, SizeBytes: 200 << 30, UsedBytes: 170 << 30},
+	}
+	result := Disk(devices, testThresholds(t, "80", "90"))
+	expected := "DISK WARNING - / 50% used, /var lib 85% used | /=50%;80;90;0;100 '/var lib'=85%;80;90;0;100"
+	if result.State != Warning || result.String() != expected {
+		t.Fatalf("Invalid result %q", result)
+	}
+
+	// A boot partition smaller than a GiB has a size of 0 GiB once rounded
+	boot := probes.DeviceStat{Filesystem: "/dev/sda3", MountPoint: "/boot", SizeBytes: 256 << 20, UsedBytes: 240 << 20}
+	result = Disk(append(devices, boot), testThresholds(t, "80", "90"))
+	expected = "DISK CRITICAL - / 50% used, /var lib 85% used, /boot 93.8% used | /=50%;80;90;0;100 '/var lib'=85%;80;90;0;100 /boot=93.8%;80;90;0;100"
+	if result.State != Critical || result.String() != expected {
+		t.Fatalf("Invalid result %q", result)
+	}
+	if result := Disk(nil, testThresholds(t, "80", "90")); result.State != Unknown {
+		t.Fatalf("Expecting an unknown state, got %q", result)
+	}
+}
+
+// Test the state of the other checks
+func TestChecks(t *testing.T) {
+	for _, test := range []struct {
+		result   Result
+		expected string
+	}{
+		{
+			RAM(probes.RAMStats{Available: 1000, Used: 950}, testThresholds(t, "80", "90")),
+			"RAM CRITICAL - 95% used (950 of 1000 kB) | used=95%;80;90;0;100 used_memory=950KB;;;0;1000",
+		},
+		{
+			RAM(probes.RAMStats{}, testThresholds(t, "80", "90")),
+			"RAM UNKNOWN - Memory usage not available",
+		},
+		{
+			Services(map[string]bool{"sshd": true, "nginx": false}),
+			"SERVICE CRITICAL - nginx inactive, sshd active | active=1;;;0;2",
+		},
+		{
+			Uptime(300, testThresholds(t, "600:", "")),
+			"UPTIME WARNING - up 5m0s | uptime=300s;600:;;0",
+		},
+		{
+			Load(probes.LoadAverage{Load1: 0.5, Load5: 1.25, Load15: 2}, Thresholds{}),
+			"LOAD OK - load average 0.5, 1.25, 2 | load1=0.5;;;0 load5=1.25;;;0 load15=2;;;0",
+		},
+	} {
+		if test.result.String() != test.expected {
+			t.Fatalf("Invalid result %q, expecting %q", test.result, test.expected)
+		}
+	}
+}
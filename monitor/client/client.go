@@ -0,0 +1,255 @@
+// Package client reads the stats of a system-monitor agent from its HTTP API.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+)
+
+// Models returned by the API, shared with the agent
+type (
+	// Stats holds the results of all the enabled probes
+	Stats = stats.FullStats
+	// DeviceStat is the usage of a mounted device
+	DeviceStat = probes.DeviceStat
+	// RAMStats is the usage of the memory
+	RAMStats = probes.RAMStats
+	// SystemInfo describes the host
+	SystemInfo = probes.SystemInfo
+	// ProcessesStats lists the processes using the most resources
+	ProcessesStats = probes.ProcessesStats
+	// ProcessStat describes a running process
+	ProcessStat = probes.ProcessStat
+	// Alert is a condition detected by the agent, such as a disk about to be full
+	Alert = stats.Alert
+	// SeriesPoints are the points of a history series
+	SeriesPoints = history.SeriesPoints
+	// Point is a single timestamped value of a series
+	Point = history.Point
+)
+
+// Options configure the connection to the agent
+type Options struct {
+	// Token is sent as a bearer token when not empty
+	Token string
+	// Username and Password are sent with HTTP basic auth when the username is not empty
+	Username string
+	Password string
+	// TLSConfig is used for https URLs, the system roots being trusted when nil
+	TLSConfig *tls.Config
+	// HTTPClient replaces the default client, TLSConfig and Timeout being ignored
+	HTTPClient *http.Client
+	// Timeout limits the duration of the requests, except for the streams
+	Timeout time.Duration
+	// Retries is the number of times a request is retried after a network error,
+	// a server error or a rate limit, waiting RetryWait then twice longer each time
+	Retries   int
+	RetryWait time.Duration
+}
+
+// StatusError is an unexpected status returned by the agent
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// retryable checks whether a request failing with a status may succeed later
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Client reads the API of an agent
+type Client struct {
+	baseURL *url.URL
+	options Options
+	http    *http.Client
+	stream  *http.Client
+}
+
+// New creates a client for the agent at the given URL, such as http://host:5000
+func New(baseURL string, options Options) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid URL %q, expecting an http or https scheme", baseURL)
+	}
+	if options.RetryWait <= 0 {
+		options.RetryWait = 500 * time.Millisecond
+	}
+
+	c := &Client{baseURL: parsed, options: options, http: options.HTTPClient, stream: options.HTTPClient}
+	if c.http == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = options.TLSConfig
+		// Streams last until they are cancelled, so they do not have a timeout
+		c.http = &http.Client{Transport: transport, Timeout: options.Timeout}
+		c.stream = &http.Client{Transport: transport}
+	}
+	return c, nil
+}
+
+// newRequest builds an authenticated request for a path of the API
+func (c *Client) newRequest(ctx context.Context, path string, query url.Values) (*http.Request, error) {
+	target := *c.baseURL
+	target.Path += path
+	target.RawQuery = query.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.options.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.options.Token)
+	} else if c.options.Username != "" {
+		request.SetBasicAuth(c.options.Username, c.options.Password)
+	}
+	return request, nil
+}
+
+// statusError reads the error returned by the agent
+func statusError(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	return &StatusError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
+// get requests a path of the API and decodes the JSON response, retrying on
+// network errors, server errors and rate limits
+func (c *Client) get(ctx context.Context, path string, query url.Values, result interface{}) error {
+	wait := c.options.RetryWait
+	for attempt := 0; ; attempt++ {
+		request, err := c.newRequest(ctx, path, query)
+		if err != nil {
+			return err
+		}
+		response, err := c.http.Do(request)
+		if err == nil && response.StatusCode == http.StatusOK {
+			defer response.Body.Close()
+			return json.NewDecoder(response.Body).Decode(result)
+		}
+
+		retryAfter := wait
+		if err == nil {
+			err = statusError(response)
+			response.Body.Close()
+			if !retryable(response.StatusCode) {
+				return err
+			}
+			if seconds, parseErr := strconv.Atoi(response.Header.Get("Retry-After")); parseErr == nil {
+				retryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		if attempt >= c.options.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// Stats returns the results of all the probes enabled on the agent
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var result Stats
+	err := c.get(ctx, "/api/stats", nil, &result)
+	return result, err
+}
+
+// Probe runs a single probe on the agent and decodes its result, which must be
+// of the type of the probe in Stats
+func (c *Client) Probe(ctx context.Context, name string, result interface{}) error {
+	return c.get(ctx, "/api/stats/"+url.PathEscape(name), nil, result)
+}
+
+// DiskUsage returns the usage of the mounted devices of the agent
+func (c *Client) DiskUsage(ctx context.Context) ([]DeviceStat, error) {
+	var result []DeviceStat
+	err := c.Probe(ctx, "disk-usage", &result)
+	return result, err
+}
+
+// RAMUsage returns the memory usage of the agent
+func (c *Client) RAMUsage(ctx context.Context) (RAMStats, error) {
+	var result RAMStats
+	err := c.Probe(ctx, "ram-usage", &result)
+	return result, err
+}
+
+// SystemInfo returns the description of the host of the agent
+func (c *Client) SystemInfo(ctx context.Context) (SystemInfo, error) {
+	var result SystemInfo
+	err := c.Probe(ctx, "system-info", &result)
+	return result, err
+}
+
+// Services returns whether each monitored service is active
+func (c *Client) Services(ctx context.Context) (map[string]bool, error) {
+	var result map[string]bool
+	err := c.Probe(ctx, "services-status", &result)
+	return result, err
+}
+
+// Uptime returns the time since the agent host booted
+func (c *Client) Uptime(ctx context.Context) (time.Duration, error) {
+	var seconds int64
+	err := c.Probe(ctx, "uptime", &seconds)
+	return time.Duration(seconds) * time.Second, err
+}
+
+// Processes returns the processes of the agent using the most CPU, memory and file descriptors
+func (c *Client) Processes(ctx context.Context) (ProcessesStats, error) {
+	var result ProcessesStats
+	err := c.Probe(ctx, "processes", &result)
+	return result, err
+}
+
+// Alerts returns the alerts firing on the agent, which requires the read:alerts scope
+func (c *Client) Alerts(ctx context.Context) ([]Alert, error) {
+	var result []Alert
+	err := c.get(ctx, "/api/alerts", nil, &result)
+	return result, err
+}
+
+// Series lists the series kept in the history of the agent
+func (c *Client) Series(ctx context.Context) ([]string, error) {
+	var result []string
+	err := c.get(ctx, "/api/history", nil, &result)
+	return result, err
+}
+
+// History returns the points of a series between two times, the agent using
+// the last hour when they are zero
+func (c *Client) History(ctx context.Context, series string, from time.Time, to time.Time) (SeriesPoints, error) {
+	query := url.Values{"series": {series}}
+	if !from.IsZero() {
+		query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	}
+	if !to.IsZero() {
+		query.Set("to", strconv.FormatInt(to.Unix(), 10))
+	}
+	var result SeriesPoints
+	err := c.get(ctx, "/api/history", query, &result)
+	return result, err
+}
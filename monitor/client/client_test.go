@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that the requests are authenticated and retried on server errors
+func TestRetries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"uptime":42}`))
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL, Options{Username: "admin", Password: "secret", Retries: 2, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Stats(context.Background())
+	if err != nil || result.Uptime != 42 || attempts != 3 {
+		t.Fatalf("Invalid result %+v after %d attempts: %v", result, attempts, err)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	c, _ = New(server.URL, Options{Username: "admin", Password: "secret", Retries: 1, RetryWait: time.Millisecond})
+	var statusErr *StatusError
+	if _, err := c.Stats(context.Background()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable || statusErr.Message != "Unavailable" {
+		t.Fatalf("Expecting a status error, got %v", err)
+	}
+
+	// Client errors are not retried
+	atomic.StoreInt32(&attempts, 0)
+	c, _ = New(server.URL, Options{Token: "token", Retries: 5, RetryWait: time.Millisecond})
+	if _, err := c.Uptime(context.Background()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized || attempts != 0 {
+		t.Fatalf("Expecting an unauthorized error, got %v", err)
+	}
+}
+
+// Test reading the alerts firing on the agent
+func TestAlerts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/alerts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"name":"disk-full-soon","target":"/var","message":"/var is expected to be full in 1h0m0s","since":1600000000}]`))
+	}))
+	defer server.Close()
+
+	c, _ := New(server.URL, Options{})
+	alerts, err := c.Alerts(context.Background())
+	if err != nil || len(alerts) != 1 || alerts[0].Name != "disk-full-soon" || alerts[0].Target != "/var" || alerts[0].Since != 1600000000 {
+		t.Fatalf("Invalid alerts %+v: %v", alerts, err)
+	}
+}
+
+// Test that the wait between the retries stops with the context
+func TestRetryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c, _ := New(server.URL, Options{Retries: 3})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Series(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expecting the deadline to be exceeded, got %v", err)
+	}
+
+	if _, err := New("localhost:5000", Options{}); err == nil {
+		t.Fatal("Expecting an error without scheme")
+	}
+}
+
+// Test the parsing of the Server-Sent Events
+func TestReadEvents(t *testing.T) {
+	input := ": heartbeat\n\nid: 1600000000\nevent: delta\ndata: {\"uptime\":100}\n\n: heartbeat\n\nid: 1600000010\nevent: snapshot\ndata: {\"uptime\":110,\n\ndata: \"ram-usage\":{\"used\":5}}\n\n"
+	events := []Event{}
+	err := readEvents(bufio.NewScanner(strings.NewReader(input)), func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expecting an error for the truncated event")
+	}
+	if len(events) != 1 || events[0].Type != "delta" || events[0].Time.Unix() != 1600000000 {
+		t.Fatalf("Invalid events %+v", events)
+	}
+	decoded, err := events[0].Stats()
+	if err != nil || decoded.Uptime != 100 {
+		t.Fatalf("Invalid stats %+v", decoded)
+	}
+
+	input = "event: snapshot\ndata: {\"uptime\":110,\ndata: \"ram-usage\":{\"used\":5}}\n\n"
+	err = readEvents(bufio.NewScanner(strings.NewReader(input)), func(event Event) error {
+		decoded, err = event.Stats()
+		return err
+	})
+	if err != nil || decoded.Uptime != 110 || decoded.RAMUsage.Used != 5 {
+		t.Fatalf("Invalid multi-line event %+v: %v", decoded, err)
+	}
+}
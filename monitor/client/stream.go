@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStopStream can be returned by a stream handler to end the stream without error
+var ErrStopStream = errors.New("stream stopped")
+
+// StreamOptions select the events sent by the agent
+type StreamOptions struct {
+	// Probes limits the events to some probes, all of them being sent when empty
+	Probes []string
+	// Interval between the events, the agent never sending them faster than it collects
+	Interval time.Duration
+	// Deltas only sends the probes that changed since the previous event
+	Deltas bool
+}
+
+// Event is a set of probe results sent by the agent
+type Event struct {
+	// Time of the collection of the stats
+	Time time.Time
+	// Type is snapshot, or delta when only the changed probes are sent
+	Type string
+	// Probes holds the JSON result of each probe of the event
+	Probes map[string]json.RawMessage
+}
+
+// Stats decodes the probes of the event, the missing ones being left empty
+func (e Event) Stats() (Stats, error) {
+	var result Stats
+	b, err := json.Marshal(e.Probes)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(b, &result)
+	return result, err
+}
+
+// readEvents parses a Server-Sent Events stream, calling the handler for each event
+func readEvents(scanner *bufio.Scanner, handler func(Event) error) error {
+	event := Event{}
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line dispatches the event, heartbeat comments having no data
+			if data.Len() > 0 {
+				if err := json.Unmarshal([]byte(data.String()), &event.Probes); err != nil {
+					return err
+				}
+				if err := handler(event); err != nil {
+					return err
+				}
+			}
+			event = Event{}
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+					event.Time = time.Unix(seconds, 0)
+				}
+			case "event":
+				event.Type = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Stream calls the handler with the stats sent by the agent until the context is
+// cancelled, the handler returns an error or the agent closes the stream. The
+// context error is not reported, nor ErrStopStream when returned by the handler.
+func (c *Client) Stream(ctx context.Context, options StreamOptions, handler func(Event) error) error {
+	query := url.Values{}
+	if len(options.Probes) > 0 {
+		query.Set("probes", strings.Join(options.Probes, ","))
+	}
+	if options.Interval > 0 {
+		seconds := int(options.Interval.Round(time.Second) / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		query.Set("interval", strconv.Itoa(seconds))
+	}
+	if options.Deltas {
+		query.Set("mode", "delta")
+	}
+
+	request, err := c.newRequest(ctx, "/api/v1/stream", query)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	response, err := c.stream.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return statusError(response)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	err = readEvents(scanner, handler)
+	if errors.Is(err, ErrStopStream) || ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
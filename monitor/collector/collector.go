@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// Snapshot is the result of a single run of the probes
+type Snapshot struct {
+	Time  time.Time
+	Stats stats.FullStats
+	// Alerts are the alerts firing at the time of the snapshot
+	Alerts []stats.Alert
+	// Events are the alerts which started firing or were resolved since the previous snapshot
+	Events []stats.AlertEvent
+}
+
+// Collector periodically runs the probes and hands the results to its subscribers
+type Collector struct {
+	config   utils.ProbesConfig
+	interval time.Duration
+	collect  func(config utils.ProbesConfig) stats.FullStats
+
+	reset chan struct{}
+
+	mu          sync.RWMutex
+	store       history.Store
+	latest      Snapshot
+	alerts      map[string]stats.Alert
+	nextID      int
+	subscribers map[int]func(Snapshot)
+}
+
+// collectionInterval returns the configured interval, defaulting to 10 seconds
+func collectionInterval(config utils.ProbesConfig) time.Duration {
+	interval := time.Duration(config.Interval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return interval
+}
+
+// New creates a collector running the configured probes
+func New(config utils.ProbesConfig) *Collector {
+	return &Collector{
+		config:      config,
+		interval:    collectionInterval(config),
+		collect:     stats.NewSampler().Collect,
+		reset:       make(chan struct{}, 1),
+		alerts:      make(map[string]stats.Alert),
+		subscribers: make(map[int]func(Snapshot)),
+	}
+}
+
+// Interval returns the time between two collections
+func (c *Collector) Interval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.interval
+}
+
+// Reconfigure changes the probes run by the collector and its interval,
+// taking effect from the next collection
+func (c *Collector) Reconfigure(config utils.ProbesConfig) {
+	c.mu.Lock()
+	c.config = config
+	c.interval = collectionInterval(config)
+	c.mu.Unlock()
+
+	select {
+	case c.reset <- struct{}{}:
+	default:
+	}
+}
+
+// SetHistory sets the store the disk-full forecasts are computed from, nil
+// disabling them
+func (c *Collector) SetHistory(store history.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+// Subscribe registers a function called with every new snapshot and returns
+// the function cancelling the subscription
+func (c *Collector) Subscribe(subscriber func(Snapshot)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	c.subscribers[id] = subscriber
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// Latest returns the last collected snapshot, if any
+func (c *Collector) Latest() (Snapshot, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latest, !c.latest.Time.IsZero()
+}
+
+// Current returns the last collected snapshot, running the probes when none was collected yet
+func (c *Collector) Current() Snapshot {
+	if latest, ok := c.Latest(); ok {
+		return latest
+	}
+	return c.Collect()
+}
+
+// updateAlerts replaces the firing alerts by the ones detected in a snapshot and
+// returns them with the events of the alerts which started firing or were resolved.
+// It must be called with the lock held.
+func (c *Collector) updateAlerts(detected []stats.Alert, now time.Time) ([]stats.Alert, []stats.AlertEvent) {
+	firing := make(map[string]stats.Alert)
+	alerts := []stats.Alert{}
+	events := []stats.AlertEvent{}
+	for _, alert := range detected {
+		if previous, ok := c.alerts[alert.Key()]; ok {
+			alert.Since = previous.Since
+		} else {
+			alert.Since = now.Unix()
+			events = append(events, stats.AlertEvent{Alert: alert, State: stats.AlertFiring})
+		}
+		firing[alert.Key()] = alert
+		alerts = append(alerts, alert)
+	}
+	for key, alert := range c.alerts {
+		if _, ok := firing[key]; !ok {
+			events = append(events, stats.AlertEvent{Alert: alert, State: stats.AlertResolved})
+		}
+	}
+	c.alerts = firing
+
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Key() < alerts[j].Key() })
+	sort.Slice(events, func(i, j int) bool { return events[i].Key() < events[j].Key() })
+	return alerts, events
+}
+
+// Collect runs the probes once, computes the disk-full forecasts and the alerts,
+// and notifies the subscribers
+func (c *Collector) Collect() Snapshot {
+	c.mu.RLock()
+	config, store := c.config, c.store
+	c.mu.RUnlock()
+	snapshot := Snapshot{Time: time.Now(), Stats: c.collect(config)}
+	if store != nil && config.DiskForecast.Enabled {
+		snapshot.Stats.AddDiskForecasts(store, config.DiskForecast, snapshot.Time)
+	}
+
+	c.mu.Lock()
+	snapshot.Alerts, snapshot.Events = c.updateAlerts(snapshot.Stats.Alerts(), snapshot.Time)
+	c.latest = snapshot
+	ids := make([]int, 0, len(c.subscribers))
+	for id := range c.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subscribers := make([]func(Snapshot), 0, len(ids))
+	for _, id := range ids {
+		subscribers = append(subscribers, c.subscribers[id])
+	}
+	c.mu.Unlock()
+
+	for _, event := range snapshot.Events {
+		if event.State == stats.AlertFiring {
+			log.Warnf("Alert %s firing: %s", event.Key(), event.Message)
+		} else {
+			log.Infof("Alert %s resolved", event.Key())
+		}
+	}
+	for _, subscriber := range subscribers {
+		subscriber(snapshot)
+	}
+	return snapshot
+}
+
+// Run collects the stats at every interval until stop is closed
+func (c *Collector) Run(stop <-chan struct{}) {
+	log.Debugf("Collecting stats every %s", c.Interval())
+	ticker := time.NewTicker(c.Interval())
+	defer ticker.Stop()
+
+	c.Collect()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.Collect()
+		case <-c.reset:
+			log.Debugf("Collecting stats every %s", c.Interval())
+			ticker.Reset(c.Interval())
+			c.Collect()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test that the snapshots carry the disk-full forecasts computed from the history
+func TestCollectForecasts(t *testing.T) {
+	device := probes.DeviceStat{Filesystem: "/dev/sda1", MountPoint: "/", Size: 1, Used: 1, SizeBytes: 1000000000, UsedBytes: 900000000}
+	config := utils.ProbesConfig{DiskUsage: true, DiskForecast: utils.DiskForecastConfig{Enabled: true, WindowHours: 6, AlertWithinHours: 24}}
+	c := New(config)
+	c.collect = func(utils.ProbesConfig) stats.FullStats {
+		return stats.FullStats{DiskUsage: []probes.DeviceStat{device}}
+	}
+
+	if snapshot := c.Collect(); snapshot.Stats.DiskUsage[0].Forecast != nil {
+		t.Fatal("Expecting no forecast without history")
+	}
+
+	// The usage grows by 100 MB per hour
+	store := history.NewMemoryStore(24 * time.Hour)
+	now := time.Now().Unix()
+	series := stats.DiskUsedSeries(device)
+	store.Append([]history.Entry{
+		{Series: series, Point: history.Point{Timestamp: now - 7200, Value: 700000000}},
+		{Series: series, Point: history.Point{Timestamp: now - 3600, Value: 800000000}},
+	})
+	c.SetHistory(store)
+	forecast := c.Collect().Stats.DiskUsage[0].Forecast
+	if forecast == nil || !forecast.FullSoon || forecast.TimeToFull == nil {
+		t.Fatalf("Invalid forecast %+v", forecast)
+	}
+	if latest, ok := c.Latest(); !ok || latest.Stats.DiskUsage[0].Forecast == nil {
+		t.Fatal("Expecting the forecast in the latest snapshot")
+	}
+}
+
+// Test that the alerts fire and are resolved once, keeping their start time
+func TestCollectAlerts(t *testing.T) {
+	timeToFull := int64(3600)
+	fullSoon := &probes.DiskForecast{TimeToFull: &timeToFull, FullSoon: true}
+	forecasts := []*probes.DiskForecast{fullSoon, fullSoon, nil}
+	c := New(utils.ProbesConfig{DiskUsage: true})
+	c.collect = func(utils.ProbesConfig) stats.FullStats {
+		forecast := forecasts[0]
+		forecasts = forecasts[1:]
+		return stats.FullStats{DiskUsage: []probes.DeviceStat{{Filesystem: "/dev/sda1", MountPoint: "/var", Forecast: forecast}}}
+	}
+
+	first := c.Collect()
+	if len(first.Alerts) != 1 || len(first.Events) != 1 || first.Events[0].State != stats.AlertFiring {
+		t.Fatalf("Expecting a firing alert, got %+v", first)
+	}
+	if alert := first.Alerts[0]; alert.Name != "disk-full-soon" || alert.Target != "/var" || alert.Message != "/var is expected to be full in 1h0m0s" {
+		t.Fatalf("Invalid alert %+v", alert)
+	}
+	second := c.Collect()
+	if len(second.Alerts) != 1 || len(second.Events) != 0 || second.Alerts[0].Since != first.Alerts[0].Since {
+		t.Fatalf("Expecting the alert to keep firing, got %+v", second)
+	}
+	third := c.Collect()
+	if len(third.Alerts) != 0 || len(third.Events) != 1 || third.Events[0].State != stats.AlertResolved {
+		t.Fatalf("Expecting a resolved alert, got %+v", third)
+	}
+}
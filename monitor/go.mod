@@ -1,5 +1,27 @@
 module github.com/aHugues/system-monitor/monitor
 
-go 1.14
+go 1.21
 
-require github.com/cihub/seelog v0.0.0-20170130134532-f561c5e57575
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/cihub/seelog v0.0.0-20170130134532-f561c5e57575
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/gorilla/websocket v1.5.0
+	go.opentelemetry.io/proto/otlp v1.3.1
+	golang.org/x/crypto v0.23.0
+	golang.org/x/term v0.20.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.20.0 // indirect
+	golang.org/x/net v0.23.0 // indirect
+	golang.org/x/sync v0.6.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240513163218-0867130af1f8 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240513163218-0867130af1f8 // indirect
+)
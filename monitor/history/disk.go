@@ -0,0 +1,608 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const compactionBatchSize = 1024
+
+// DiskOptions handles the retention and downsampling policy of a disk store
+type DiskOptions struct {
+	Retention          time.Duration
+	MaxSize            int64
+	DownsampleAfter    time.Duration
+	DownsampleInterval time.Duration
+	SegmentDuration    time.Duration
+	SegmentSize        int64
+	CompactInterval    time.Duration
+}
+
+// DiskStore keeps the history in append-only segment files
+type DiskStore struct {
+	dir      string
+	options  DiskOptions
+	mu       sync.Mutex
+	segments []*segment
+	active   *os.File
+	current  *segment
+	stop     chan struct{}
+	done     chan struct{}
+	closed   sync.Once
+}
+
+// withDefaults fills the unset segment and downsampling options
+func (options DiskOptions) withDefaults() DiskOptions {
+	if options.SegmentDuration <= 0 {
+		options.SegmentDuration = time.Hour
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = 4 * 1024 * 1024
+	}
+	if options.DownsampleInterval <= 0 {
+		options.DownsampleInterval = 5 * time.Minute
+	}
+	return options
+}
+
+// OpenDiskStore opens or creates a disk store in the given directory, recovering
+// from interrupted writes and compactions
+func OpenDiskStore(dir string, options DiskOptions) (*DiskStore, error) {
+	options = options.withDefaults()
+
+	log.Debugf("Opening history store in %q", dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	store := &DiskStore{
+		dir:     dir,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	if options.CompactInterval > 0 {
+		go store.maintain()
+	} else {
+		close(store.done)
+	}
+	return store, nil
+}
+
+// load scans the existing segments and repairs the directory after a crash
+func (s *DiskStore) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(s.dir, file.Name())
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			log.Warnf("Removing incomplete history segment %q", path)
+			os.Remove(path)
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), segmentExtension) {
+			continue
+		}
+
+		seg, err := parseSegmentName(file.Name())
+		if err != nil {
+			log.Warnf("Ignoring unknown file %q in history directory", path)
+			continue
+		}
+		seg.path = path
+		if err := scanSegment(&seg); err != nil {
+			return err
+		}
+		if seg.size < file.Size() {
+			log.Warnf("Truncating corrupted tail of history segment %q", path)
+			if err := os.Truncate(path, seg.size); err != nil {
+				return err
+			}
+		}
+		s.segments = append(s.segments, &seg)
+	}
+
+	// A crash between writing a downsampled segment and removing its sources
+	// leaves raw segments already covered by the downsampled data
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if !seg.downsampled && s.coveredByDownsampled(seg) {
+			log.Warnf("Removing history segment %q already downsampled", seg.path)
+			os.Remove(seg.path)
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	s.segments = kept
+	s.sortSegments()
+	return nil
+}
+
+func (s *DiskStore) coveredByDownsampled(raw *segment) bool {
+	if raw.empty {
+		return false
+	}
+	for _, seg := range s.segments {
+		if seg.downsampled && seg.start <= raw.minTime && raw.maxTime <= seg.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *DiskStore) sortSegments() {
+	sort.SliceStable(s.segments, func(i, j int) bool {
+		return s.segments[i].start < s.segments[j].start
+	})
+}
+
+// scanSegment computes the time range, series and valid size of a segment
+func scanSegment(seg *segment) error {
+	seg.empty = true
+	size, err := readSegment(seg.path, seg.add)
+	seg.size = size
+	return err
+}
+
+// SetOptions changes the retention, segment and downsampling options, taking effect
+// from the next append or compaction. The compaction interval is kept.
+func (s *DiskStore) SetOptions(options DiskOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	options = options.withDefaults()
+	options.CompactInterval = s.options.CompactInterval
+	s.options = options
+}
+
+// Append writes the entries to the active segment and syncs it to disk
+func (s *DiskStore) Append(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil || time.Since(time.Unix(s.current.start, 0)) >= s.options.SegmentDuration || s.current.size >= s.options.SegmentSize {
+		if err := s.rotate(time.Now()); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.active.Write(encodeRecord(entries))
+	if err != nil {
+		return err
+	}
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+
+	s.current.size += int64(n)
+	s.current.add(entries)
+	return nil
+}
+
+// rotate closes the active segment and starts a new one
+func (s *DiskStore) rotate(now time.Time) error {
+	s.closeActive()
+
+	start := now.Unix()
+	for _, seg := range s.segments {
+		if !seg.downsampled && seg.start >= start {
+			start = seg.start + 1
+		}
+	}
+	path := filepath.Join(s.dir, rawSegmentName(start))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.active = file
+	s.current = &segment{path: path, start: start, empty: true, series: make(map[string]bool)}
+	s.segments = append(s.segments, s.current)
+	s.sortSegments()
+	return nil
+}
+
+func (s *DiskStore) closeActive() {
+	if s.active != nil {
+		s.active.Close()
+	}
+	s.active = nil
+	s.current = nil
+}
+
+// Query returns the points of a series between the given times
+func (s *DiskStore) Query(series string, from time.Time, to time.Time) ([]Point, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Point{}
+	for _, seg := range s.segments {
+		if seg.empty || seg.maxTime < from.Unix() || seg.minTime > to.Unix() {
+			continue
+		}
+		_, err := readSegment(seg.path, func(entries []Entry) {
+			for _, entry := range entries {
+				if entry.Series == series && entry.Timestamp >= from.Unix() && entry.Timestamp <= to.Unix() {
+					result = append(result, entry.Point)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+	return result, nil
+}
+
+// Series returns the names of all the series in the store, from the series indexed
+// when the segments are loaded and written
+func (s *DiskStore) Series() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make(map[string]bool)
+	for _, seg := range s.segments {
+		for name := range seg.series {
+			names[name] = true
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Size returns the total size of the segments on disk
+func (s *DiskStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return total
+}
+
+// Compact downsamples the old raw data, merges small downsampled segments and
+// applies the retention policy
+func (s *DiskStore) Compact(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != nil && now.Sub(time.Unix(s.current.start, 0)) >= s.options.SegmentDuration {
+		s.closeActive()
+	}
+
+	if err := s.downsample(now); err != nil {
+		return err
+	}
+	if err := s.merge(); err != nil {
+		return err
+	}
+	s.applyRetention(now)
+	return nil
+}
+
+// downsampleSources returns the closed raw segments whose points are all before the
+// cut-off. The cut-off is moved back to the start of a bucket until no other raw
+// segment has points before it, so that every bucket is averaged only once.
+func (s *DiskStore) downsampleSources(limit int64, interval int64) []*segment {
+	cutoff := limit - limit%interval
+	for {
+		sources := []*segment{}
+		next := cutoff
+		for _, seg := range s.segments {
+			if seg.downsampled || seg.empty {
+				continue
+			}
+			if seg != s.current && seg.maxTime < cutoff {
+				sources = append(sources, seg)
+			} else if seg.minTime < next {
+				next = seg.minTime - seg.minTime%interval
+			}
+		}
+		if next == cutoff {
+			// Empty raw segments are removed along with the downsampled ones
+			for _, seg := range s.segments {
+				if !seg.downsampled && seg.empty && seg != s.current {
+					sources = append(sources, seg)
+				}
+			}
+			return sources
+		}
+		cutoff = next
+	}
+}
+
+// downsample replaces the closed raw segments older than the threshold with
+// a segment averaging their points over the downsampling interval
+func (s *DiskStore) downsample(now time.Time) error {
+	if s.options.DownsampleAfter <= 0 {
+		return nil
+	}
+	interval := int64(s.options.DownsampleInterval / time.Second)
+	sources := s.downsampleSources(now.Add(-s.options.DownsampleAfter).Unix(), interval)
+	if len(sources) == 0 {
+		return nil
+	}
+
+	type bucketKey struct {
+		series string
+		start  int64
+	}
+	type bucket struct {
+		sum   float64
+		count int
+	}
+	buckets := make(map[bucketKey]*bucket)
+	for _, seg := range sources {
+		_, err := readSegment(seg.path, func(entries []Entry) {
+			for _, entry := range entries {
+				key := bucketKey{entry.Series, entry.Timestamp - entry.Timestamp%interval}
+				if buckets[key] == nil {
+					buckets[key] = &bucket{}
+				}
+				buckets[key].sum += entry.Value
+				buckets[key].count++
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	entries := make([]Entry, 0, len(buckets))
+	for key, b := range buckets {
+		entries = append(entries, Entry{Series: key.series, Point: Point{Timestamp: key.start, Value: b.sum / float64(b.count)}})
+	}
+	if len(entries) > 0 {
+		log.Debugf("Downsampling %d history segments into %d points", len(sources), len(entries))
+		if _, err := s.writeDownsampled(entries); err != nil {
+			return err
+		}
+	}
+	s.removeSegments(sources)
+	return nil
+}
+
+// merge combines adjacent downsampled segments as long as the result stays small
+func (s *DiskStore) merge() error {
+	group := []*segment{}
+	var groupSize int64
+	flush := func() error {
+		if len(group) > 1 {
+			if err := s.mergeGroup(group); err != nil {
+				return err
+			}
+		}
+		group = []*segment{}
+		groupSize = 0
+		return nil
+	}
+
+	candidates := []*segment{}
+	for _, seg := range s.segments {
+		if seg.downsampled {
+			candidates = append(candidates, seg)
+		}
+	}
+	for _, seg := range candidates {
+		if groupSize+seg.size > s.options.SegmentSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		group = append(group, seg)
+		groupSize += seg.size
+	}
+	return flush()
+}
+
+func (s *DiskStore) mergeGroup(group []*segment) error {
+	entries := []Entry{}
+	for _, seg := range group {
+		_, err := readSegment(seg.path, func(batch []Entry) {
+			entries = append(entries, batch...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := s.writeDownsampled(entries); err != nil {
+		return err
+	}
+	s.removeSegments(group)
+	return nil
+}
+
+// uniqueEntries keeps the last entry of each series and timestamp
+func uniqueEntries(entries []Entry) []Entry {
+	type entryKey struct {
+		series    string
+		timestamp int64
+	}
+	last := make(map[entryKey]int)
+	for i, entry := range entries {
+		last[entryKey{entry.Series, entry.Timestamp}] = i
+	}
+	unique := make([]Entry, 0, len(last))
+	for i, entry := range entries {
+		if last[entryKey{entry.Series, entry.Timestamp}] == i {
+			unique = append(unique, entry)
+		}
+	}
+	return unique
+}
+
+// writeDownsampled atomically creates a downsampled segment holding the entries. An
+// existing segment with the same range is merged into it rather than overwritten.
+func (s *DiskStore) writeDownsampled(entries []Entry) (*segment, error) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+	seg := &segment{
+		downsampled: true,
+		start:       entries[0].Timestamp,
+		end:         entries[len(entries)-1].Timestamp,
+	}
+	// The end of the range is widened to the downsampling interval so that it
+	// covers all the raw points averaged into the last bucket
+	seg.end += int64(s.options.DownsampleInterval/time.Second) - 1
+
+	name := downsampledSegmentName(seg.start, seg.end)
+	seg.path = filepath.Join(s.dir, name)
+	replaced := make(map[*segment]bool)
+	existing := []Entry{}
+	for _, other := range s.segments {
+		if other.path != seg.path {
+			continue
+		}
+		replaced[other] = true
+		if _, err := readSegment(other.path, func(batch []Entry) { existing = append(existing, batch...) }); err != nil {
+			return nil, err
+		}
+	}
+	if len(replaced) > 0 {
+		log.Debugf("Merging downsampled points into existing history segment %q", seg.path)
+		entries = uniqueEntries(append(existing, entries...))
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+	}
+
+	size, err := writeSegment(s.dir, name, entries, compactionBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	seg.size = size
+	seg.empty = true
+	seg.add(entries)
+
+	kept := s.segments[:0]
+	for _, other := range s.segments {
+		if !replaced[other] {
+			kept = append(kept, other)
+		}
+	}
+	s.segments = append(kept, seg)
+	s.sortSegments()
+	return seg, nil
+}
+
+// applyRetention removes the segments older than the retention, then the oldest
+// segments until the store fits in its maximum size
+func (s *DiskStore) applyRetention(now time.Time) {
+	expired := []*segment{}
+	if s.options.Retention > 0 {
+		limit := now.Add(-s.options.Retention).Unix()
+		for _, seg := range s.segments {
+			if seg != s.current && (seg.empty || seg.maxTime < limit) {
+				expired = append(expired, seg)
+			}
+		}
+	}
+	s.removeSegments(expired)
+
+	if s.options.MaxSize <= 0 {
+		return
+	}
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	for total > s.options.MaxSize {
+		var oldest *segment
+		for _, seg := range s.segments {
+			if seg != s.current && (oldest == nil || seg.maxTime < oldest.maxTime) {
+				oldest = seg
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		log.Infof("History store over its size limit, removing %q", oldest.path)
+		total -= oldest.size
+		s.removeSegments([]*segment{oldest})
+	}
+}
+
+func (s *DiskStore) removeSegments(removed []*segment) {
+	if len(removed) == 0 {
+		return
+	}
+	toRemove := make(map[*segment]bool)
+	for _, seg := range removed {
+		toRemove[seg] = true
+	}
+	kept := s.segments[:0]
+	keptPaths := make(map[string]bool)
+	for _, seg := range s.segments {
+		if !toRemove[seg] {
+			kept = append(kept, seg)
+			keptPaths[seg.path] = true
+		}
+	}
+	s.segments = kept
+
+	// A file rewritten by a merge belongs to the new segment and is kept
+	for _, seg := range removed {
+		if keptPaths[seg.path] {
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Error removing history segment: %q", err)
+		}
+	}
+	syncDir(s.dir)
+}
+
+// maintain periodically compacts the store until it is closed
+func (s *DiskStore) maintain() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.options.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			if err := s.Compact(now); err != nil {
+				log.Errorf("Error compacting history store: %q", err)
+			}
+		}
+	}
+}
+
+// Close stops the background compaction and closes the active segment, the next
+// calls doing nothing
+func (s *DiskStore) Close() error {
+	s.closed.Do(func() { close(s.stop) })
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeActive()
+	return nil
+}
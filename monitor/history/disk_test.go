@@ -0,0 +1,228 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, dir string, options DiskOptions) *DiskStore {
+	store, err := OpenDiskStore(dir, options)
+	if err != nil {
+		t.Fatalf("Impossible to open store: %q", err)
+	}
+	return store
+}
+
+func makeEntries(series string, start int64, count int, step int64) []Entry {
+	entries := []Entry{}
+	for i := 0; i < count; i++ {
+		entries = append(entries, Entry{Series: series, Point: Point{Timestamp: start + int64(i)*step, Value: float64(i)}})
+	}
+	return entries
+}
+
+// Test that the points survive closing and reopening the store
+func TestDiskStoreReopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Unix()
+	store := openTestStore(t, dir, DiskOptions{})
+	if err := store.Append(makeEntries("ram-usage.used", now-100, 10, 10)); err != nil {
+		t.Fatalf("Impossible to append: %q", err)
+	}
+	store.Append(makeEntries("uptime.seconds", now-100, 5, 10))
+	store.Close()
+
+	store = openTestStore(t, dir, DiskOptions{})
+	defer store.Close()
+	points, err := store.Query("ram-usage.used", time.Unix(now-100, 0), time.Unix(now, 0))
+	if err != nil || len(points) != 10 {
+		t.Fatalf("Expected 10 points, got %d (%v)", len(points), err)
+	}
+	if points[0].Timestamp != now-100 || points[9].Value != 9 {
+		t.Fatal("Invalid points")
+	}
+
+	series, _ := store.Series()
+	if len(series) != 2 || series[0] != "ram-usage.used" || series[1] != "uptime.seconds" {
+		t.Fatalf("Invalid series %q", series)
+	}
+}
+
+// Test that a record partially written before a crash is discarded
+func TestDiskStoreTruncatedRecord(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Unix()
+	store := openTestStore(t, dir, DiskOptions{})
+	store.Append(makeEntries("ram-usage.used", now-100, 3, 10))
+	path := store.current.path
+	store.Close()
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	record := encodeRecord(makeEntries("ram-usage.used", now-50, 3, 10))
+	file.Write(record[:len(record)-5])
+	file.Close()
+	ioutil.WriteFile(filepath.Join(dir, "ds-1-2.seg.tmp"), []byte("garbage"), 0644)
+
+	store = openTestStore(t, dir, DiskOptions{})
+	defer store.Close()
+	points, _ := store.Query("ram-usage.used", time.Unix(now-200, 0), time.Unix(now, 0))
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(points))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ds-1-2.seg.tmp")); !os.IsNotExist(err) {
+		t.Fatal("Temporary file not removed")
+	}
+
+	// New appends must remain readable after the repaired segment
+	store.Append(makeEntries("ram-usage.used", now-10, 1, 10))
+	points, _ = store.Query("ram-usage.used", time.Unix(now-200, 0), time.Unix(now, 0))
+	if len(points) != 4 {
+		t.Fatalf("Expected 4 points, got %d", len(points))
+	}
+}
+
+// Test that old raw points are averaged over the downsampling interval
+func TestDiskStoreDownsample(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	start := now.Add(-3*time.Hour).Unix() / 600 * 600
+	store := openTestStore(t, dir, DiskOptions{DownsampleAfter: time.Hour, DownsampleInterval: 10 * time.Minute})
+	defer store.Close()
+	store.Append(makeEntries("ram-usage.used", start, 60, 20))
+
+	if err := store.Compact(now.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Impossible to compact: %q", err)
+	}
+	points, _ := store.Query("ram-usage.used", time.Unix(start, 0), now)
+	if len(points) != 2 {
+		t.Fatalf("Expected 2 points, got %d", len(points))
+	}
+	if points[0].Timestamp != start || points[0].Value != 14.5 || points[1].Value != 44.5 {
+		t.Fatalf("Invalid downsampled points %v", points)
+	}
+	for _, seg := range store.segments {
+		if !seg.downsampled {
+			t.Fatal("Raw segment not removed after downsampling")
+		}
+	}
+}
+
+// Test that raw segments already downsampled are removed when reopening
+func TestDiskStoreInterruptedDownsample(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	writeSegment(dir, rawSegmentName(1000), makeEntries("ram-usage.used", 1000, 10, 10), 10)
+	writeSegment(dir, downsampledSegmentName(900, 1199), makeEntries("ram-usage.used", 900, 1, 10), 10)
+
+	store := openTestStore(t, dir, DiskOptions{})
+	defer store.Close()
+	points, _ := store.Query("ram-usage.used", time.Unix(0, 0), time.Unix(2000, 0))
+	if len(points) != 1 {
+		t.Fatalf("Expected 1 point, got %d", len(points))
+	}
+}
+
+// Test the retention by age and by size
+func TestDiskStoreRetention(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Unix()
+	writeSegment(dir, rawSegmentName(now-7200), makeEntries("ram-usage.used", now-7200, 10, 10), 10)
+	writeSegment(dir, rawSegmentName(now-3000), makeEntries("ram-usage.used", now-3000, 10, 10), 10)
+	writeSegment(dir, rawSegmentName(now-1000), makeEntries("ram-usage.used", now-1000, 10, 10), 10)
+
+	store := openTestStore(t, dir, DiskOptions{Retention: time.Hour})
+	defer store.Close()
+	store.Compact(time.Unix(now, 0))
+	if len(store.segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(store.segments))
+	}
+
+	store.options.MaxSize = store.segments[1].size
+	store.Compact(time.Unix(now, 0))
+	if len(store.segments) != 1 || store.segments[0].start != now-1000 {
+		t.Fatal("Oldest segment not removed")
+	}
+}
+
+// Test that a bucket spread over two raw segments is averaged once
+func TestDiskStoreDownsampleStraddle(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	start := time.Now().Add(-3*time.Hour).Unix() / 600 * 600
+	store := openTestStore(t, dir, DiskOptions{DownsampleAfter: time.Hour, DownsampleInterval: 10 * time.Minute})
+	defer store.Close()
+	// The first segment ends in the middle of the second bucket, where the second
+	// segment starts
+	store.Append(makeEntries("ram-usage.used", start, 45, 20))
+	store.closeActive()
+	store.Append(makeEntries("ram-usage.used", start+900, 20, 20))
+	store.closeActive()
+
+	// The second segment is too recent to be downsampled, so the first one waits for it
+	if err := store.Compact(time.Unix(start+1290, 0).Add(time.Hour)); err != nil {
+		t.Fatalf("Impossible to compact: %q", err)
+	}
+	points, _ := store.Query("ram-usage.used", time.Unix(start, 0), time.Now())
+	if len(points) != 65 {
+		t.Fatalf("Expected 65 raw points, got %d", len(points))
+	}
+
+	if err := store.Compact(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Impossible to compact: %q", err)
+	}
+	points, _ = store.Query("ram-usage.used", time.Unix(start, 0), time.Now())
+	expected := []Point{{Timestamp: start, Value: 14.5}, {Timestamp: start + 600, Value: 22}, {Timestamp: start + 1200, Value: 17}}
+	if len(points) != len(expected) {
+		t.Fatalf("Invalid downsampled points %v", points)
+	}
+	for i := range expected {
+		if points[i] != expected[i] {
+			t.Fatalf("Invalid downsampled points %v", points)
+		}
+	}
+}
+
+// Test that downsampling into the range of an existing segment merges their points
+func TestDiskStoreDownsampleCollision(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+
+	writeSegment(dir, downsampledSegmentName(1200, 1799), makeEntries("ram-usage.used", 1200, 1, 10), 10)
+	options := DiskOptions{DownsampleAfter: time.Hour, DownsampleInterval: 10 * time.Minute}
+	store := openTestStore(t, dir, options)
+	store.Append(makeEntries("uptime.seconds", 1200, 30, 20))
+	if err := store.Compact(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Impossible to compact: %q", err)
+	}
+	if len(store.segments) != 1 {
+		t.Fatalf("Expected 1 segment, got %d", len(store.segments))
+	}
+	series, _ := store.Series()
+	if len(series) != 2 {
+		t.Fatalf("Invalid series %q", series)
+	}
+	store.Close()
+	store.Close()
+
+	store = openTestStore(t, dir, options)
+	defer store.Close()
+	for _, name := range []string{"ram-usage.used", "uptime.seconds"} {
+		points, _ := store.Query(name, time.Unix(0, 0), time.Unix(2000, 0))
+		if len(points) != 1 || points[0].Timestamp != 1200 {
+			t.Fatalf("Invalid points of %s: %v", name, points)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package history
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Point is a single timestamped value of a series
+type Point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// SeriesPoints are the points of a series between two unix timestamps, as
+// returned by the history API
+type SeriesPoints struct {
+	Series string  `json:"series"`
+	From   int64   `json:"from"`
+	To     int64   `json:"to"`
+	Points []Point `json:"points"`
+}
+
+// Entry associates a point with the series it belongs to
+type Entry struct {
+	Series string
+	Point
+}
+
+// Store keeps the history of the collected series
+type Store interface {
+	Append(entries []Entry) error
+	Query(series string, from time.Time, to time.Time) ([]Point, error)
+	Series() ([]string, error)
+	Close() error
+}
+
+// MemoryStore keeps the history in memory for a limited duration
+type MemoryStore struct {
+	retention time.Duration
+	mu        sync.RWMutex
+	series    map[string][]Point
+}
+
+// NewMemoryStore creates an in-memory store dropping points older than the retention
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{
+		retention: retention,
+		series:    make(map[string][]Point),
+	}
+}
+
+// SetRetention changes the retention, the points being dropped on the next append
+func (s *MemoryStore) SetRetention(retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = retention
+}
+
+// Append adds the entries to the store and drops the expired points
+func (s *MemoryStore) Append(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		s.series[entry.Series] = append(s.series[entry.Series], entry.Point)
+	}
+
+	limit := time.Now().Add(-s.retention).Unix()
+	for name, points := range s.series {
+		first := sort.Search(len(points), func(i int) bool { return points[i].Timestamp >= limit })
+		if first == len(points) {
+			delete(s.series, name)
+		} else if first > 0 {
+			s.series[name] = append([]Point{}, points[first:]...)
+		}
+	}
+	return nil
+}
+
+// Query returns the points of a series between the given times
+func (s *MemoryStore) Query(series string, from time.Time, to time.Time) ([]Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []Point{}
+	for _, point := range s.series[series] {
+		if point.Timestamp >= from.Unix() && point.Timestamp <= to.Unix() {
+			result = append(result, point)
+		}
+	}
+	return result, nil
+}
+
+// Series returns the names of all the series in the store
+func (s *MemoryStore) Series() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Close releases the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
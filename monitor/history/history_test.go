@@ -0,0 +1,35 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+// Test querying points from the memory store
+func TestMemoryStoreQuery(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	now := time.Now().Unix()
+	store.Append(makeEntries("ram-usage.used", now-100, 10, 10))
+
+	points, _ := store.Query("ram-usage.used", time.Unix(now-50, 0), time.Unix(now, 0))
+	if len(points) != 5 || points[0].Timestamp != now-50 {
+		t.Fatalf("Expected 5 points, got %d", len(points))
+	}
+}
+
+// Test that the memory store drops expired points
+func TestMemoryStoreRetention(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	now := time.Now().Unix()
+	store.Append(makeEntries("ram-usage.used", now-100, 10, 10))
+	store.Append(makeEntries("uptime.seconds", now-500, 1, 10))
+
+	points, _ := store.Query("ram-usage.used", time.Unix(0, 0), time.Unix(now, 0))
+	if len(points) != 6 {
+		t.Fatalf("Expected 6 points, got %d", len(points))
+	}
+	series, _ := store.Series()
+	if len(series) != 1 {
+		t.Fatalf("Expected expired series to be removed, got %q", series)
+	}
+}
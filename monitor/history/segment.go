@@ -0,0 +1,215 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	recordHeaderSize  = 8
+	segmentExtension  = ".seg"
+	rawPrefix         = "raw-"
+	downsampledPrefix = "ds-"
+)
+
+// segment describes a file holding a part of the history
+type segment struct {
+	path        string
+	downsampled bool
+	start       int64
+	end         int64
+	minTime     int64
+	maxTime     int64
+	size        int64
+	empty       bool
+	// series are the names of the series with points in the segment
+	series map[string]bool
+}
+
+// add updates the time range and the series of the segment with new entries
+func (seg *segment) add(entries []Entry) {
+	if seg.series == nil {
+		seg.series = make(map[string]bool)
+	}
+	for _, entry := range entries {
+		if seg.empty || entry.Timestamp < seg.minTime {
+			seg.minTime = entry.Timestamp
+		}
+		if seg.empty || entry.Timestamp > seg.maxTime {
+			seg.maxTime = entry.Timestamp
+		}
+		seg.empty = false
+		seg.series[entry.Series] = true
+	}
+}
+
+func rawSegmentName(start int64) string {
+	return fmt.Sprintf("%s%d%s", rawPrefix, start, segmentExtension)
+}
+
+func downsampledSegmentName(start int64, end int64) string {
+	return fmt.Sprintf("%s%d-%d%s", downsampledPrefix, start, end, segmentExtension)
+}
+
+// parseSegmentName extracts the segment kind and time range from its file name
+func parseSegmentName(name string) (segment, error) {
+	base := strings.TrimSuffix(name, segmentExtension)
+	if strings.HasPrefix(base, rawPrefix) {
+		start, err := strconv.ParseInt(strings.TrimPrefix(base, rawPrefix), 10, 64)
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{start: start}, nil
+	}
+	if strings.HasPrefix(base, downsampledPrefix) {
+		bounds := strings.Split(strings.TrimPrefix(base, downsampledPrefix), "-")
+		if len(bounds) != 2 {
+			return segment{}, errors.New("Invalid downsampled segment name")
+		}
+		start, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil {
+			return segment{}, err
+		}
+		end, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{downsampled: true, start: start, end: end}, nil
+	}
+	return segment{}, errors.New("Unknown segment name")
+}
+
+// encodeRecord serializes a batch of entries into a checksummed record
+func encodeRecord(entries []Entry) []byte {
+	var buffer bytes.Buffer
+	scratch := make([]byte, binary.MaxVarintLen64)
+	buffer.Write(scratch[:binary.PutUvarint(scratch, uint64(len(entries)))])
+	for _, entry := range entries {
+		buffer.Write(scratch[:binary.PutUvarint(scratch, uint64(len(entry.Series)))])
+		buffer.WriteString(entry.Series)
+		buffer.Write(scratch[:binary.PutVarint(scratch, entry.Timestamp)])
+		binary.LittleEndian.PutUint64(scratch, math.Float64bits(entry.Value))
+		buffer.Write(scratch[:8])
+	}
+	payload := buffer.Bytes()
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+// decodePayload parses the entries of a record payload
+func decodePayload(payload []byte) ([]Entry, error) {
+	count, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return nil, errors.New("Invalid entry count")
+	}
+	payload = payload[n:]
+	entries := make([]Entry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		length, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload)-n) < length {
+			return nil, errors.New("Invalid series name")
+		}
+		series := string(payload[n : n+int(length)])
+		payload = payload[n+int(length):]
+
+		timestamp, n := binary.Varint(payload)
+		if n <= 0 || len(payload)-n < 8 {
+			return nil, errors.New("Invalid point")
+		}
+		value := math.Float64frombits(binary.LittleEndian.Uint64(payload[n : n+8]))
+		payload = payload[n+8:]
+
+		entries = append(entries, Entry{Series: series, Point: Point{Timestamp: timestamp, Value: value}})
+	}
+	return entries, nil
+}
+
+// readSegment calls handler for every valid record of the file and returns
+// the size of the valid part, stopping at the first truncated or corrupted record
+func readSegment(path string, handler func(entries []Entry)) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := 0
+	for len(data)-offset >= recordHeaderSize {
+		length := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		checksum := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		if len(data)-offset-recordHeaderSize < length {
+			break
+		}
+		payload := data[offset+recordHeaderSize : offset+recordHeaderSize+length]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			break
+		}
+		entries, err := decodePayload(payload)
+		if err != nil {
+			break
+		}
+		handler(entries)
+		offset += recordHeaderSize + length
+	}
+	return int64(offset), nil
+}
+
+// writeSegment atomically writes the entries to a new segment file
+func writeSegment(dir string, name string, entries []Entry, batchSize int) (int64, error) {
+	tmpPath := filepath.Join(dir, name+".tmp")
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for i := 0; i < len(entries); i += batchSize {
+		end := i + batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		n, err := file.Write(encodeRecord(entries[i:end]))
+		if err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return 0, err
+		}
+		size += int64(n)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return size, syncDir(dir)
+}
+
+// syncDir flushes the directory entries so that renames survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
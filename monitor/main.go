@@ -1,7 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
 	log "github.com/cihub/seelog"
 
@@ -9,14 +16,153 @@ import (
 	"github.com/aHugues/system-monitor/monitor/webserver"
 )
 
+// configErrors lists the errors of a configuration, one per line
+func configErrors(err error) []string {
+	var validationErrors utils.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []string{err.Error()}
+	}
+	messages := []string{}
+	for _, validationError := range validationErrors {
+		messages = append(messages, validationError.Error())
+	}
+	return messages
+}
+
+// configOptions are the command-line flags telling where the configuration is read from
+type configOptions struct {
+	flags     *flag.FlagSet
+	path      *string
+	format    *string
+	dir       *string
+	overrides map[string]string
+}
+
+// newConfigOptions registers the configuration flags of a command
+func newConfigOptions(flags *flag.FlagSet) *configOptions {
+	return &configOptions{
+		flags:     flags,
+		path:      flags.String("config", "config.json", "Path to the configuration file"),
+		format:    flags.String("config-format", "", "Format of the configuration file (json, yaml or toml), guessed from its extension by default"),
+		dir:       flags.String("config-dir", "", "Directory of configuration fragments merged in lexical order, conf.d next to the configuration file by default"),
+		overrides: utils.ConfigFlags(flags),
+	}
+}
+
+// load reads the configuration from its sources once the flags are parsed. Settings
+// are taken from the flags, then the environment, then the fragments of the drop-in
+// directory, then the file, then the default values. Only the default configuration
+// file and drop-in directory may be missing.
+func (o *configOptions) load() (utils.FullConfiguration, utils.Origins, error) {
+	explicitConfig, explicitDir := false, false
+	o.flags.Visit(func(f *flag.Flag) {
+		explicitConfig = explicitConfig || f.Name == "config"
+		explicitDir = explicitDir || f.Name == "config-dir"
+	})
+
+	sources := utils.ConfigSources{File: *o.path, Format: *o.format, Dir: o.dirPath(), Env: os.Environ(), Flags: o.overrides}
+	if _, err := os.Stat(sources.File); !explicitConfig && errors.Is(err, fs.ErrNotExist) {
+		log.Warnf("No configuration found at %q, using default config", sources.File)
+		sources.File = ""
+	}
+	if _, err := os.Stat(sources.Dir); !explicitDir && errors.Is(err, fs.ErrNotExist) {
+		sources.Dir = ""
+	}
+	return utils.LoadConfigOrigins(sources)
+}
+
+// dirPath returns the drop-in directory, next to the configuration file by default
+func (o *configOptions) dirPath() string {
+	if *o.dir == "" {
+		return filepath.Join(filepath.Dir(*o.path), "conf.d")
+	}
+	return *o.dir
+}
+
+// useStderrLogger sends the logs to the standard error, so that they do not mix
+// with the output of the commands
+func useStderrLogger() {
+	logger, err := log.LoggerFromWriterWithMinLevel(os.Stderr, log.WarnLvl)
+	if err == nil {
+		log.ReplaceLogger(logger)
+	}
+}
+
+// commands lists the subcommands by name, serve being the default one
+var commands = map[string]func(args []string) int{
+	"serve": runServe,
+	"stats": runStats,
+	"check": runCheck,
+	"top":   runTop,
+}
+
 func main() {
-	configPath := flag.String("config", "config.json", "Path to the JSON configuration file")
-	flag.Parse()
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	run, ok := commands[command]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q, expecting serve, stats, check or top\n", command)
+		os.Exit(2)
+	}
+	os.Exit(run(args))
+}
+
+// runServe runs the agent until it is stopped
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	checkConfig := flags.Bool("check-config", false, "Validate the configuration and exit")
+	printConfig := flags.Bool("print-config", false, "Print the effective configuration, secrets hidden, and exit")
+	printOrigins := flags.Bool("print-origins", false, "Print the effective settings with the source they were read from, and exit")
+	options := newConfigOptions(flags)
+	flags.Parse(args)
+
+	if *checkConfig || *printConfig || *printOrigins {
+		useStderrLogger()
+	}
+	config, origins, err := options.load()
+	if *checkConfig || *printConfig || *printOrigins {
+		if err != nil {
+			for _, message := range configErrors(err) {
+				fmt.Fprintln(os.Stderr, message)
+			}
+			return 1
+		}
+		if *printConfig {
+			b, _ := json.MarshalIndent(utils.RedactConfig(config), "", "  ")
+			fmt.Println(string(b))
+			return 0
+		}
+		if *printOrigins {
+			for _, line := range utils.FormatOrigins(config, origins) {
+				fmt.Println(line)
+			}
+			return 0
+		}
+		fmt.Printf("Configuration %s is valid\n", *options.path)
+		return 0
+	}
 
-	config, err := utils.ReadConfigJSON(*configPath)
+	defer log.Flush()
 	if err != nil {
-		log.Warn("Impossible to read from JSON configuration, using default config")
-		config = utils.NewConfig()
+		for _, message := range configErrors(err) {
+			log.Critical(message)
+		}
+		return 1
+	}
+
+	reload := webserver.ReloadOptions{
+		Load: func() (utils.FullConfiguration, error) {
+			config, _, err := options.load()
+			return config, err
+		},
+		Files: []string{*options.path},
+		Dirs:  []string{options.dirPath()},
+	}
+	if err := webserver.RunServer(config, reload); err != nil {
+		log.Criticalf("Server failed: %q", err)
+		return 1
 	}
-	webserver.RunServer(config)
+	return 0
 }
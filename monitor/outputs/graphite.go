@@ -0,0 +1,173 @@
+package outputs
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// GraphitePusher sends the collected stats to a Carbon server using the plaintext
+// protocol, buffering the metrics while the server is unreachable
+type GraphitePusher struct {
+	config utils.GraphiteConfig
+	host   string
+
+	mu      sync.Mutex
+	pending []string
+
+	// connMu serializes the flushes, which dial and write without holding mu so
+	// that the collector can keep adding lines
+	connMu sync.Mutex
+	conn   net.Conn
+}
+
+// NewGraphitePusher creates a pusher for the configured Carbon address
+func NewGraphitePusher(config utils.GraphiteConfig) *GraphitePusher {
+	if config.MaxBuffer <= 0 {
+		config.MaxBuffer = 10000
+	}
+	return &GraphitePusher{config: config, host: hostname()}
+}
+
+// metricPath returns the path of a sample, from its template when one is configured
+func (p *GraphitePusher) metricPath(sample stats.Sample) string {
+	if template, ok := p.config.Templates[sample.Probe+"."+sample.Field]; ok {
+		return expandTemplate(template, sample, p.host, sanitizeComponent)
+	}
+
+	components := []string{}
+	if p.config.Prefix != "" {
+		components = append(components, expandTemplate(p.config.Prefix, sample, p.host, sanitizeComponent))
+	}
+	components = append(components, sanitizeComponent(sample.Probe))
+	keys := make([]string, 0, len(sample.Tags))
+	for k := range sample.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		components = append(components, sanitizeComponent(sample.Tags[k]))
+	}
+	return strings.Join(append(components, sanitizeComponent(sample.Field)), ".")
+}
+
+// Render returns one plaintext protocol line per sample of the stats
+func (p *GraphitePusher) Render(fullStats stats.FullStats, timestamp time.Time) []string {
+	lines := []string{}
+	for _, sample := range fullStats.Samples() {
+		lines = append(lines, fmt.Sprintf("%s %s %d", p.metricPath(sample), strconv.FormatFloat(sample.Value, 'f', -1, 64), timestamp.Unix()))
+	}
+	return lines
+}
+
+// Add queues the lines of a snapshot until the next push
+func (p *GraphitePusher) Add(snapshot collector.Snapshot) {
+	lines := p.Render(snapshot.Stats, snapshot.Time)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, lines...)
+	p.trimPending()
+}
+
+// trimPending keeps a bounded buffer, dropping the oldest lines. It must be called
+// with the lock held.
+func (p *GraphitePusher) trimPending() {
+	if len(p.pending) > p.config.MaxBuffer {
+		log.Warnf("Graphite buffer full, dropping %d lines", len(p.pending)-p.config.MaxBuffer)
+		p.pending = p.pending[len(p.pending)-p.config.MaxBuffer:]
+	}
+}
+
+// requeue puts back lines that could not be sent before the ones added since
+func (p *GraphitePusher) requeue(lines []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(lines, p.pending...)
+	p.trimPending()
+}
+
+// Flush sends the buffered lines, reconnecting to the server if needed. The lines
+// are kept for the next flush when the server cannot be reached.
+func (p *GraphitePusher) Flush() error {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	p.mu.Lock()
+	lines := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.config.Address, timeout)
+		if err != nil {
+			p.requeue(lines)
+			return err
+		}
+		log.Infof("Connected to Carbon server %q", p.config.Address)
+		p.conn = conn
+	}
+
+	if timeout > 0 {
+		p.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	if _, err := p.conn.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.requeue(lines)
+		return err
+	}
+	return nil
+}
+
+// Run pushes the buffered lines at every interval until stop is closed
+func (p *GraphitePusher) Run(stop <-chan struct{}) {
+	interval := time.Duration(p.config.PushInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	log.Infof("Pushing metrics to Graphite every %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			if err := p.Flush(); err != nil {
+				log.Errorf("Error flushing Graphite lines: %q", err)
+			}
+			p.Close()
+			return
+		case <-ticker.C:
+			if err := p.Flush(); err != nil {
+				log.Warnf("Error pushing to Graphite, keeping lines for the next push: %q", err)
+			}
+		}
+	}
+}
+
+// Close closes the connection to the server
+func (p *GraphitePusher) Close() error {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
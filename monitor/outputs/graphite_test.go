@@ -0,0 +1,79 @@
+package outputs
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the templated and default metric paths
+func TestGraphiteRender(t *testing.T) {
+	pusher := NewGraphitePusher(utils.NewConfig().Outputs.Graphite)
+	pusher.host = "web-01.example.com"
+	lines := pusher.Render(testStats(), time.Unix(1600000000, 0))
+	expected := []string{
+		"servers.web_01_example_com.disk.home.size 96 1600000000",
+		"servers.web_01_example_com.disk.home.used 43 1600000000",
+		"servers.web_01_example_com.ram_usage.available 16316868 1600000000",
+		"servers.web_01_example_com.ram_usage.used 5157872 1600000000",
+		"servers.web_01_example_com.ram_usage.free 7319832 1600000000",
+		"servers.web_01_example_com.ram_usage.shared 662180 1600000000",
+		"servers.web_01_example_com.services.nginx.active 1 1600000000",
+		"servers.web_01_example_com.uptime.seconds 3600 1600000000",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Invalid lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+// Test that the lines are buffered while the server is down and sent after reconnecting
+func TestGraphiteReconnect(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	pusher := NewGraphitePusher(utils.GraphiteConfig{Address: address, Timeout: 1})
+	defer pusher.Close()
+	pusher.Add(collector.Snapshot{Time: time.Unix(1600000000, 0), Stats: testStats()})
+	if err := pusher.Flush(); err == nil {
+		t.Fatal("Expecting a connection error")
+	}
+	pusher.Add(collector.Snapshot{Time: time.Unix(1600000010, 0), Stats: testStats()})
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("Impossible to listen again on %q", address)
+	}
+	defer listener.Close()
+	received := make(chan []string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		lines := []string{}
+		scanner := bufio.NewScanner(conn)
+		for len(lines) < 16 && scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	if err := pusher.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	select {
+	case lines := <-received:
+		if !strings.HasSuffix(lines[0], " 1600000000") || !strings.HasSuffix(lines[15], " 1600000010") {
+			t.Fatalf("Invalid lines %q", lines)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No lines received")
+	}
+}
@@ -0,0 +1,244 @@
+package outputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxName converts a probe or field name to the InfluxDB naming style
+func influxName(name string) string {
+	return strings.Replace(name, "-", "_", -1)
+}
+
+// influxTags renders the sorted tag set of a line
+func influxTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		builder.WriteString(",")
+		builder.WriteString(tagEscaper.Replace(influxName(k)))
+		builder.WriteString("=")
+		builder.WriteString(tagEscaper.Replace(tags[k]))
+	}
+	return builder.String()
+}
+
+// RenderInflux renders the stats as InfluxDB line protocol, one line per probe
+// and tag set, with the host tags added to every line
+func RenderInflux(fullStats stats.FullStats, timestamp time.Time, hostTags map[string]string) []string {
+	lines := []string{}
+	for _, group := range groupSamples(fullStats.Samples()) {
+		tags := make(map[string]string)
+		for k, v := range hostTags {
+			tags[k] = v
+		}
+		for k, v := range group.tags {
+			tags[k] = v
+		}
+
+		fields := make([]string, 0, len(group.fields))
+		for _, sample := range group.fields {
+			fields = append(fields, tagEscaper.Replace(influxName(sample.Field))+"="+strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %s %d", measurementEscaper.Replace(influxName(group.probe)), influxTags(tags), strings.Join(fields, ","), timestamp.UnixNano()))
+	}
+
+	info := fullStats.SystemInfo
+	if info.OperatingSystem != "" {
+		fields := []string{
+			fmt.Sprintf(`operating_system="%s"`, stringEscaper.Replace(info.OperatingSystem)),
+			fmt.Sprintf(`kernel="%s"`, stringEscaper.Replace(info.Kernel)),
+			fmt.Sprintf(`distro="%s"`, stringEscaper.Replace(info.Distro)),
+			fmt.Sprintf(`machine="%s"`, stringEscaper.Replace(info.Machine)),
+			fmt.Sprintf(`name="%s"`, stringEscaper.Replace(info.Name)),
+		}
+		lines = append(lines, fmt.Sprintf("system_info%s %s %d", influxTags(hostTags), strings.Join(fields, ","), timestamp.UnixNano()))
+	}
+	return lines
+}
+
+// InfluxHostTags returns the tags added to every line, including the hostname
+func InfluxHostTags(config utils.InfluxConfig) map[string]string {
+	tags := map[string]string{"host": hostname()}
+	for k, v := range config.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// InfluxPusher periodically sends the collected stats to an InfluxDB write endpoint
+type InfluxPusher struct {
+	config     utils.InfluxConfig
+	tags       map[string]string
+	client     *http.Client
+	retryDelay time.Duration
+
+	mu      sync.Mutex
+	pending []string
+}
+
+// NewInfluxPusher creates a pusher for the configured write URL
+func NewInfluxPusher(config utils.InfluxConfig) *InfluxPusher {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 5000
+	}
+	return &InfluxPusher{
+		config:     config,
+		tags:       InfluxHostTags(config),
+		client:     &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+		retryDelay: time.Second,
+	}
+}
+
+// Add queues the lines of a snapshot until the next push
+func (p *InfluxPusher) Add(snapshot collector.Snapshot) {
+	lines := RenderInflux(snapshot.Stats, snapshot.Time, p.tags)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, lines...)
+	p.trimPending()
+}
+
+// trimPending keeps a bounded backlog when the server is unreachable, dropping the
+// oldest lines. It must be called with the lock held.
+func (p *InfluxPusher) trimPending() {
+	maxPending := 10 * p.config.BatchSize
+	if len(p.pending) > maxPending {
+		log.Warnf("InfluxDB backlog full, dropping %d lines", len(p.pending)-maxPending)
+		p.pending = p.pending[len(p.pending)-maxPending:]
+	}
+}
+
+// Flush sends the queued lines in batches, keeping the ones that failed to be sent
+func (p *InfluxPusher) Flush() error {
+	p.mu.Lock()
+	lines := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	for len(lines) > 0 {
+		end := p.config.BatchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := p.sendWithRetry(lines[:end]); err != nil {
+			p.mu.Lock()
+			p.pending = append(lines, p.pending...)
+			p.trimPending()
+			p.mu.Unlock()
+			return err
+		}
+		lines = lines[end:]
+	}
+	return nil
+}
+
+// sendWithRetry sends a batch, retrying with an exponential backoff on server errors
+func (p *InfluxPusher) sendWithRetry(lines []string) error {
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	if p.config.Gzip {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		writer.Write(body)
+		writer.Close()
+		body = compressed.Bytes()
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.retryDelay << uint(attempt-1))
+		}
+		var retry bool
+		retry, err = p.send(body)
+		if err == nil {
+			return nil
+		}
+		log.Warnf("Error pushing to InfluxDB (attempt %d): %q", attempt+1, err)
+		if !retry {
+			log.Errorf("Dropping %d lines rejected by InfluxDB", len(lines))
+			return nil
+		}
+	}
+	return err
+}
+
+// send posts a batch and tells whether a failure is worth retrying
+func (p *InfluxPusher) send(body []byte) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, p.config.WriteURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if p.config.Gzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	if p.config.Token != "" {
+		request.Header.Set("Authorization", "Token "+p.config.Token)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("Unexpected status %q", response.Status)
+}
+
+// Run pushes the queued lines at every interval until stop is closed
+func (p *InfluxPusher) Run(stop <-chan struct{}) {
+	interval := time.Duration(p.config.PushInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	log.Infof("Pushing metrics to InfluxDB every %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			if err := p.Flush(); err != nil {
+				log.Errorf("Error flushing InfluxDB lines: %q", err)
+			}
+			return
+		case <-ticker.C:
+			if err := p.Flush(); err != nil {
+				log.Errorf("Error pushing to InfluxDB: %q", err)
+			}
+		}
+	}
+}
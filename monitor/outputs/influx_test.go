@@ -0,0 +1,134 @@
+package outputs
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+func testStats() stats.FullStats {
+	return stats.FullStats{
+		DiskUsage:  []probes.DeviceStat{{Filesystem: "/dev/sda1", MountPoint: "/home", Size: 96, Used: 43}},
+		RAMUsage:   probes.RAMStats{Available: 16316868, Used: 5157872, Free: 7319832, Shared: 662180},
+		SystemInfo: probes.SystemInfo{OperatingSystem: "Linux", Kernel: "5.4.0", Distro: "Ubuntu", Machine: "x86_64", Name: "my host"},
+		Services:   map[string]bool{"nginx": true},
+		Uptime:     3600,
+	}
+}
+
+// Test rendering the stats as line protocol
+func TestRenderInflux(t *testing.T) {
+	lines := RenderInflux(testStats(), time.Unix(1600000000, 0), map[string]string{"host": "my host"})
+	expected := []string{
+		`disk_usage,filesystem=/dev/sda1,host=my\ host,mountpoint=/home size=96,used=43 1600000000000000000`,
+		`ram_usage,host=my\ host available=16316868,used=5157872,free=7319832,shared=662180 1600000000000000000`,
+		`services_status,host=my\ host,service=nginx active=1 1600000000000000000`,
+		`uptime,host=my\ host seconds=3600 1600000000000000000`,
+		`system_info,host=my\ host operating_system="Linux",kernel="5.4.0",distro="Ubuntu",machine="x86_64",name="my host" 1600000000000000000`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Invalid lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+// Test pushing gzipped batches to a local server
+func TestInfluxPush(t *testing.T) {
+	var mu sync.Mutex
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Authorization") != "Token secret" {
+			t.Error("Invalid headers")
+		}
+		reader, _ := gzip.NewReader(r.Body)
+		body, _ := ioutil.ReadAll(reader)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pusher := NewInfluxPusher(utils.InfluxConfig{WriteURL: server.URL, Token: "secret", BatchSize: 3, Gzip: true})
+	pusher.Add(collector.Snapshot{Time: time.Unix(1600000000, 0), Stats: testStats()})
+	if err := pusher.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	if len(bodies) != 2 || strings.Count(bodies[0], "\n") != 3 || strings.Count(bodies[1], "\n") != 2 {
+		t.Fatalf("Invalid batches %q", bodies)
+	}
+}
+
+// Test that failed batches are retried and kept for the next push
+func TestInfluxPushRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pusher := NewInfluxPusher(utils.InfluxConfig{WriteURL: server.URL, BatchSize: 100, MaxRetries: 1})
+	pusher.retryDelay = time.Millisecond
+	pusher.Add(collector.Snapshot{Time: time.Unix(1600000000, 0), Stats: testStats()})
+
+	if err := pusher.Flush(); err == nil || calls != 2 {
+		t.Fatalf("Expecting a failure after 2 calls, got %d", calls)
+	}
+	if err := pusher.Flush(); err != nil || calls != 4 {
+		t.Fatalf("Expecting a success after 4 calls, got %d", calls)
+	}
+	if len(pusher.pending) != 0 {
+		t.Fatal("Pending lines not sent")
+	}
+}
+
+// Test that batches rejected by the server are not retried
+func TestInfluxPushRejected(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pusher := NewInfluxPusher(utils.InfluxConfig{WriteURL: server.URL, MaxRetries: 3})
+	pusher.Add(collector.Snapshot{Time: time.Unix(1600000000, 0), Stats: testStats()})
+	if err := pusher.Flush(); err != nil || calls != 1 {
+		t.Fatalf("Expecting a single call, got %d", calls)
+	}
+}
+
+// Test that the backlog stays bounded when a failed batch is queued again
+func TestInfluxPushBacklog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pusher := NewInfluxPusher(utils.InfluxConfig{WriteURL: server.URL, BatchSize: 2})
+	pusher.retryDelay = time.Millisecond
+	for i := 0; i < 25; i++ {
+		pusher.pending = append(pusher.pending, "line")
+	}
+	if err := pusher.Flush(); err == nil {
+		t.Fatal("Expecting a failure")
+	}
+	if len(pusher.pending) != 20 {
+		t.Fatalf("Expecting 20 pending lines, got %d", len(pusher.pending))
+	}
+}
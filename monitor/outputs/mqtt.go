@@ -0,0 +1,315 @@
+package outputs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+var topicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// mqttQueueSize is the number of snapshots waiting to be published, the oldest ones
+// being dropped when the broker is too slow
+const mqttQueueSize = 10
+
+// jinjaString quotes a value as a Jinja string literal, which accepts the escapes of
+// Go quoted strings
+func jinjaString(value string) string {
+	return strconv.Quote(value)
+}
+
+// haDevice describes the host in the Home Assistant discovery payloads
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// haEntity is a Home Assistant MQTT discovery payload
+type haEntity struct {
+	Name                string   `json:"name"`
+	UniqueID            string   `json:"unique_id"`
+	StateTopic          string   `json:"state_topic"`
+	ValueTemplate       string   `json:"value_template"`
+	UnitOfMeasurement   string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass         string   `json:"device_class,omitempty"`
+	PayloadOn           string   `json:"payload_on,omitempty"`
+	PayloadOff          string   `json:"payload_off,omitempty"`
+	AvailabilityTopic   string   `json:"availability_topic"`
+	PayloadAvailable    string   `json:"payload_available"`
+	PayloadNotAvailable string   `json:"payload_not_available"`
+	Device              haDevice `json:"device"`
+}
+
+// MQTTPublisher publishes the latest sample of every probe to an MQTT broker
+type MQTTPublisher struct {
+	config utils.MQTTConfig
+	host   string
+	client mqtt.Client
+
+	mu         sync.Mutex
+	discovered map[string]bool
+	queue      []collector.Snapshot
+	queued     chan struct{}
+}
+
+// mqttTLSConfig loads the certificates configured for the broker connection
+func mqttTLSConfig(config utils.MQTTConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CACert != "" {
+		pem, err := ioutil.ReadFile(config.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificate found in " + config.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// NewMQTTPublisher connects to the configured broker. The status topic is set to
+// "online" once connected and to "offline" by the broker when the connection is lost.
+func NewMQTTPublisher(config utils.MQTTConfig) (*MQTTPublisher, error) {
+	publisher := &MQTTPublisher{
+		config:     config,
+		host:       hostname(),
+		discovered: make(map[string]bool),
+		queued:     make(chan struct{}, 1),
+	}
+
+	clientID := config.ClientID
+	if clientID == "" {
+		clientID = "system-monitor-" + publisher.host
+	}
+	options := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(clientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(time.Duration(config.Timeout) * time.Second)
+
+	if strings.HasPrefix(config.Broker, "ssl://") || strings.HasPrefix(config.Broker, "tls://") || strings.HasPrefix(config.Broker, "mqtts://") {
+		tlsConfig, err := mqttTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		options.SetTLSConfig(tlsConfig)
+	}
+
+	statusTopic := publisher.topic(config.StatusTopic, "status")
+	if statusTopic != "" {
+		options.SetWill(statusTopic, "offline", byte(config.QoS), true)
+	}
+	options.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Infof("Connected to MQTT broker %q", config.Broker)
+		if statusTopic != "" {
+			client.Publish(statusTopic, byte(config.QoS), true, "online")
+		}
+		// Discovery payloads are sent again in case the broker lost them
+		publisher.mu.Lock()
+		publisher.discovered = make(map[string]bool)
+		publisher.mu.Unlock()
+	})
+	options.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Warnf("Connection to MQTT broker lost: %q", err)
+	})
+
+	publisher.client = mqtt.NewClient(options)
+	token := publisher.client.Connect()
+	if token.WaitTimeout(time.Duration(config.Timeout)*time.Second) && token.Error() != nil {
+		return nil, token.Error()
+	}
+	return publisher, nil
+}
+
+// topic expands a topic template for a probe
+func (p *MQTTPublisher) topic(template string, probe string) string {
+	return expandTemplate(template, stats.Sample{Probe: probe}, p.host, topicEscaper.Replace)
+}
+
+// publish sends a message and logs the failures
+func (p *MQTTPublisher) publish(topic string, retained bool, payload []byte) {
+	token := p.client.Publish(topic, byte(p.config.QoS), retained, payload)
+	if token.WaitTimeout(time.Duration(p.config.Timeout)*time.Second) && token.Error() != nil {
+		log.Errorf("Error publishing to %q: %q", topic, token.Error())
+	}
+}
+
+// Add queues a snapshot to be published by Run, so that an unreachable broker does
+// not delay the collection
+func (p *MQTTPublisher) Add(snapshot collector.Snapshot) {
+	p.mu.Lock()
+	p.queue = append(p.queue, snapshot)
+	if len(p.queue) > mqttQueueSize {
+		log.Warnf("MQTT queue full, dropping %d snapshots", len(p.queue)-mqttQueueSize)
+		p.queue = p.queue[len(p.queue)-mqttQueueSize:]
+	}
+	p.mu.Unlock()
+
+	select {
+	case p.queued <- struct{}{}:
+	default:
+	}
+}
+
+// publishQueued publishes the queued snapshots, oldest first
+func (p *MQTTPublisher) publishQueued() {
+	p.mu.Lock()
+	queue := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+	for _, snapshot := range queue {
+		p.Publish(snapshot)
+	}
+}
+
+// Run publishes the queued snapshots until stop is closed
+func (p *MQTTPublisher) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			p.publishQueued()
+			return
+		case <-p.queued:
+			p.publishQueued()
+		}
+	}
+}
+
+// Publish sends the sample of every probe of the snapshot to its topic
+func (p *MQTTPublisher) Publish(snapshot collector.Snapshot) {
+	payloads, err := snapshot.Stats.Probes()
+	if err != nil {
+		log.Errorf("Error serializing stats for MQTT: %q", err)
+		return
+	}
+
+	if p.config.HomeAssistant {
+		p.publishDiscovery(snapshot.Stats)
+	}
+
+	probeNames := make([]string, 0, len(payloads))
+	for probe := range payloads {
+		probeNames = append(probeNames, probe)
+	}
+	sort.Strings(probeNames)
+	for _, probe := range probeNames {
+		p.publish(p.topic(p.config.Topic, probe), p.config.Retain, payloads[probe])
+	}
+}
+
+// discoveryEntities returns the Home Assistant entities matching the stats, by discovery topic
+func (p *MQTTPublisher) discoveryEntities(fullStats stats.FullStats) map[string]haEntity {
+	node := sanitizeComponent(p.host)
+	statusTopic := p.topic(p.config.StatusTopic, "status")
+	device := haDevice{
+		Identifiers:  []string{"system-monitor-" + p.host},
+		Name:         p.host,
+		Manufacturer: "Heimdall",
+		Model:        fullStats.SystemInfo.Distro,
+	}
+	entity := func(object string, name string, probe string, template string) haEntity {
+		return haEntity{
+			Name:                name,
+			UniqueID:            node + "_" + object,
+			StateTopic:          p.topic(p.config.Topic, probe),
+			ValueTemplate:       template,
+			AvailabilityTopic:   statusTopic,
+			PayloadAvailable:    "online",
+			PayloadNotAvailable: "offline",
+			Device:              device,
+		}
+	}
+	discoveryTopic := func(component string, object string) string {
+		return fmt.Sprintf("%s/%s/%s/%s/config", p.config.DiscoveryPrefix, component, node, object)
+	}
+
+	entities := make(map[string]haEntity)
+	if fullStats.RAMUsage.Available != 0 {
+		ram := entity("ram_used", "RAM used", "ram-usage", "{{ value_json.used }}")
+		ram.UnitOfMeasurement = "KiB"
+		ram.DeviceClass = "data_size"
+		entities[discoveryTopic("sensor", "ram_used")] = ram
+	}
+	if fullStats.Uptime != 0 {
+		uptime := entity("uptime", "Uptime", "uptime", "{{ value }}")
+		uptime.UnitOfMeasurement = "s"
+		uptime.DeviceClass = "duration"
+		entities[discoveryTopic("sensor", "uptime")] = uptime
+	}
+	for _, device := range fullStats.DiskUsage {
+		object := "disk_" + sanitizeComponent(device.MountPoint) + "_used"
+		template := fmt.Sprintf("{{ (value_json | selectattr('mountpoint', 'eq', %s) | first).used }}", jinjaString(device.MountPoint))
+		disk := entity(object, "Disk used "+device.MountPoint, "disk-usage", template)
+		disk.UnitOfMeasurement = "GiB"
+		disk.DeviceClass = "data_size"
+		entities[discoveryTopic("sensor", object)] = disk
+	}
+	for service := range fullStats.Services {
+		object := "service_" + sanitizeComponent(service)
+		template := fmt.Sprintf("{{ 'ON' if value_json[%s] else 'OFF' }}", jinjaString(service))
+		status := entity(object, "Service "+service, "services-status", template)
+		status.DeviceClass = "running"
+		status.PayloadOn = "ON"
+		status.PayloadOff = "OFF"
+		entities[discoveryTopic("binary_sensor", object)] = status
+	}
+	return entities
+}
+
+// publishDiscovery sends the discovery payloads not yet published since the last connection
+func (p *MQTTPublisher) publishDiscovery(fullStats stats.FullStats) {
+	for topic, entity := range p.discoveryEntities(fullStats) {
+		p.mu.Lock()
+		done := p.discovered[topic]
+		p.discovered[topic] = true
+		p.mu.Unlock()
+		if done {
+			continue
+		}
+
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			log.Errorf("Error serializing discovery payload: %q", err)
+			continue
+		}
+		p.publish(topic, true, payload)
+	}
+}
+
+// Close marks the host offline and disconnects from the broker
+func (p *MQTTPublisher) Close() {
+	if statusTopic := p.topic(p.config.StatusTopic, "status"); statusTopic != "" && p.client.IsConnected() {
+		p.publish(statusTopic, true, []byte("offline"))
+	}
+	p.client.Disconnect(uint(p.config.Timeout) * 1000)
+}
@@ -0,0 +1,175 @@
+package outputs
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// testBroker is a minimal MQTT broker stand-in recording the received packets
+type testBroker struct {
+	listener net.Listener
+	connect  chan *packets.ConnectPacket
+	publish  chan *packets.PublishPacket
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Impossible to listen: %q", err)
+	}
+	broker := &testBroker{
+		listener: listener,
+		connect:  make(chan *packets.ConnectPacket, 1),
+		publish:  make(chan *packets.PublishPacket, 100),
+	}
+	go broker.serve()
+	return broker
+}
+
+func (b *testBroker) serve() {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.connect <- p
+			packets.NewControlPacket(packets.Connack).Write(conn)
+		case *packets.PublishPacket:
+			b.publish <- p
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				ack.Write(conn)
+			}
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// receive waits for the published messages until the given topic is seen
+func (b *testBroker) receive(t *testing.T, topic string) map[string]*packets.PublishPacket {
+	messages := make(map[string]*packets.PublishPacket)
+	for {
+		select {
+		case p := <-b.publish:
+			messages[p.TopicName] = p
+			if p.TopicName == topic {
+				return messages
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Message on %q not received", topic)
+		}
+	}
+}
+
+// Test publishing the probes with the last will and status messages
+func TestMQTTPublish(t *testing.T) {
+	broker := newTestBroker(t)
+	defer broker.listener.Close()
+
+	config := utils.NewConfig().Outputs.MQTT
+	config.Broker = "tcp://" + broker.listener.Addr().String()
+	config.QoS = 1
+	publisher, err := NewMQTTPublisher(config)
+	if err != nil {
+		t.Fatalf("Impossible to connect: %q", err)
+	}
+	publisher.host = "web-01"
+
+	connect := <-broker.connect
+	if !connect.WillFlag || !connect.WillRetain || string(connect.WillMessage) != "offline" || !strings.HasSuffix(connect.WillTopic, "/status") {
+		t.Fatalf("Invalid last will: %v", connect)
+	}
+	online := broker.receive(t, connect.WillTopic)[connect.WillTopic]
+	if string(online.Payload) != "online" || !online.Retain {
+		t.Fatal("Invalid online status")
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		publisher.Run(stop)
+		close(done)
+	}()
+	publisher.Add(collector.Snapshot{Time: time.Now(), Stats: testStats()})
+	messages := broker.receive(t, "heimdall/web-01/uptime")
+	ram := messages["heimdall/web-01/ram-usage"]
+	if ram == nil || !ram.Retain || ram.Qos != 1 || string(ram.Payload) != `{"available":16316868,"used":5157872,"free":7319832,"shared":662180}` {
+		t.Fatalf("Invalid RAM message %v", ram)
+	}
+	if messages["heimdall/web-01/disk-usage"] == nil || messages["heimdall/web-01/services-status"] == nil {
+		t.Fatal("Missing probe messages")
+	}
+
+	close(stop)
+	<-done
+	publisher.Close()
+	offline := broker.receive(t, "heimdall/web-01/status")["heimdall/web-01/status"]
+	if string(offline.Payload) != "offline" {
+		t.Fatal("Invalid offline status")
+	}
+}
+
+// Test the Home Assistant discovery payloads
+func TestMQTTDiscovery(t *testing.T) {
+	config := utils.NewConfig().Outputs.MQTT
+	publisher := MQTTPublisher{config: config, host: "web-01"}
+
+	entities := publisher.discoveryEntities(testStats())
+	disk, ok := entities["homeassistant/sensor/web_01/disk_home_used/config"]
+	if !ok {
+		t.Fatalf("Missing disk entity in %v", entities)
+	}
+	if disk.StateTopic != "heimdall/web-01/disk-usage" || disk.AvailabilityTopic != "heimdall/web-01/status" || disk.UniqueID != "web_01_disk_home_used" {
+		t.Fatalf("Invalid disk entity %+v", disk)
+	}
+	service, ok := entities["homeassistant/binary_sensor/web_01/service_nginx/config"]
+	if !ok || service.DeviceClass != "running" {
+		t.Fatalf("Invalid service entity %+v", service)
+	}
+	if _, err := json.Marshal(service); err != nil {
+		t.Fatalf("Impossible to serialize entity: %q", err)
+	}
+	if len(entities) != 4 {
+		t.Fatalf("Expecting 4 entities, got %d", len(entities))
+	}
+
+	fullStats := testStats()
+	fullStats.DiskUsage[0].MountPoint = "/mnt/it's"
+	disk = publisher.discoveryEntities(fullStats)["homeassistant/sensor/web_01/disk_mnt_it_s_used/config"]
+	if disk.ValueTemplate != `{{ (value_json | selectattr('mountpoint', 'eq', "/mnt/it's") | first).used }}` {
+		t.Fatalf("Invalid disk template %q", disk.ValueTemplate)
+	}
+}
+
+// Test that the queued snapshots are bounded, the oldest ones being dropped
+func TestMQTTQueue(t *testing.T) {
+	publisher := MQTTPublisher{queued: make(chan struct{}, 1)}
+	for i := 0; i < mqttQueueSize+5; i++ {
+		publisher.Add(collector.Snapshot{Time: time.Unix(int64(i), 0)})
+	}
+	if len(publisher.queue) != mqttQueueSize {
+		t.Fatalf("Expecting %d queued snapshots, got %d", mqttQueueSize, len(publisher.queue))
+	}
+	if first := publisher.queue[0].Time.Unix(); first != 5 {
+		t.Fatalf("Expecting the oldest snapshots to be dropped, first is %d", first)
+	}
+}
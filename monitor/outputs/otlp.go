@@ -0,0 +1,331 @@
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+const kibibyte = 1024
+
+// archNames maps the uname machine names to the host.arch semantic convention values
+var archNames = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"armv7l":  "arm32",
+	"i686":    "x86",
+	"i386":    "x86",
+	"ppc64le": "ppc64",
+	"s390x":   "s390x",
+}
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// OTLPResource builds the resource describing the host from the system info
+func OTLPResource(info probes.SystemInfo) *resourcepb.Resource {
+	attributes := []*commonpb.KeyValue{stringAttribute("service.name", "system-monitor")}
+	if info.Name != "" {
+		attributes = append(attributes, stringAttribute("host.name", info.Name))
+	}
+	if info.OperatingSystem != "" {
+		attributes = append(attributes, stringAttribute("os.type", strings.ToLower(info.OperatingSystem)))
+	}
+	if description := strings.TrimSpace(info.Distro + " " + info.Kernel); description != "" {
+		attributes = append(attributes, stringAttribute("os.description", description))
+	}
+	if info.Machine != "" {
+		arch, ok := archNames[info.Machine]
+		if !ok {
+			arch = info.Machine
+		}
+		attributes = append(attributes, stringAttribute("host.arch", arch))
+	}
+	return &resourcepb.Resource{Attributes: attributes}
+}
+
+func gaugePoint(value float64, timestamp time.Time, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:   attributes,
+		TimeUnixNano: uint64(timestamp.UnixNano()),
+		Value:        &metricspb.NumberDataPoint_AsInt{AsInt: int64(value)},
+	}
+}
+
+func doublePoint(value float64, timestamp time.Time, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:   attributes,
+		TimeUnixNano: uint64(timestamp.UnixNano()),
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func gaugeMetric(name string, unit string, description string, points []*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name:        name,
+		Unit:        unit,
+		Description: description,
+		Data:        &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: points}},
+	}
+}
+
+// upDownMetric builds a non-monotonic cumulative sum, as used by the usage metrics
+func upDownMetric(name string, unit string, description string, start time.Time, points []*metricspb.NumberDataPoint) *metricspb.Metric {
+	for _, point := range points {
+		point.StartTimeUnixNano = uint64(start.UnixNano())
+	}
+	return &metricspb.Metric{
+		Name:        name,
+		Unit:        unit,
+		Description: description,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             points,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            false,
+		}},
+	}
+}
+
+// OTLPMetrics converts the stats to OTLP metrics, using the semantic convention
+// names where they exist. The RAM usage is reported by vmstat in KiB and the disk
+// usage by df in GiB, both are converted to bytes. The shared memory, which is not a
+// state of system.memory.usage, has its own metric.
+func OTLPMetrics(fullStats stats.FullStats, timestamp time.Time, start time.Time) []*metricspb.Metric {
+	metrics := []*metricspb.Metric{}
+
+	if fullStats.RAMUsage != (probes.RAMStats{}) {
+		ram := fullStats.RAMUsage
+		metrics = append(metrics,
+			upDownMetric("system.memory.usage", "By", "Reports memory in use by state.", start, []*metricspb.NumberDataPoint{
+				gaugePoint(float64(ram.Used*kibibyte), timestamp, stringAttribute("system.memory.state", "used")),
+				gaugePoint(float64(ram.Free*kibibyte), timestamp, stringAttribute("system.memory.state", "free")),
+			}),
+			upDownMetric("system.memory.limit", "By", "Total memory available in the system.", start, []*metricspb.NumberDataPoint{
+				gaugePoint(float64(ram.Available*kibibyte), timestamp),
+			}),
+			upDownMetric("system_monitor.memory.shared", "By", "Memory shared between processes, including tmpfs.", start, []*metricspb.NumberDataPoint{
+				gaugePoint(float64(ram.Shared*kibibyte), timestamp),
+			}),
+		)
+	}
+
+	if fullStats.CPUUsage != nil {
+		metrics = append(metrics, gaugeMetric("system.cpu.utilization", "1", "Fraction of time the CPUs were busy since the previous collection.", []*metricspb.NumberDataPoint{
+			doublePoint(*fullStats.CPUUsage/100, timestamp),
+		}))
+	}
+
+	if len(fullStats.DiskUsage) > 0 {
+		usage := []*metricspb.NumberDataPoint{}
+		limit := []*metricspb.NumberDataPoint{}
+		for _, device := range fullStats.DiskUsage {
+			deviceAttr := stringAttribute("system.device", device.Filesystem)
+			mountAttr := stringAttribute("system.filesystem.mountpoint", device.MountPoint)
+			usage = append(usage,
+				gaugePoint(float64(device.UsedBytes), timestamp, deviceAttr, mountAttr, stringAttribute("system.filesystem.state", "used")),
+				gaugePoint(float64(device.SizeBytes-device.UsedBytes), timestamp, deviceAttr, mountAttr, stringAttribute("system.filesystem.state", "free")),
+			)
+			limit = append(limit, gaugePoint(float64(device.SizeBytes), timestamp, deviceAttr, mountAttr))
+		}
+		metrics = append(metrics,
+			upDownMetric("system.filesystem.usage", "By", "Reports a filesystem's space usage across different states.", start, usage),
+			upDownMetric("system.filesystem.limit", "By", "The total storage capacity of the filesystem.", start, limit),
+		)
+	}
+
+	if len(fullStats.Services) > 0 {
+		points := []*metricspb.NumberDataPoint{}
+		for _, sample := range fullStats.Samples() {
+			if sample.Probe == "services-status" {
+				points = append(points, gaugePoint(sample.Value, timestamp, stringAttribute("system_monitor.service", sample.Tags["service"])))
+			}
+		}
+		metrics = append(metrics, gaugeMetric("system_monitor.service.active", "1", "Whether the systemd service is active.", points))
+	}
+
+	if fullStats.Uptime != 0 {
+		metrics = append(metrics, gaugeMetric("system.uptime", "s", "The time the system has been running.", []*metricspb.NumberDataPoint{
+			gaugePoint(float64(fullStats.Uptime), timestamp),
+		}))
+	}
+	return metrics
+}
+
+// OTLPExporter periodically exports the latest stats to an OpenTelemetry collector,
+// over HTTP/protobuf or gRPC
+type OTLPExporter struct {
+	config   utils.OTLPConfig
+	resource *resourcepb.Resource
+	start    time.Time
+	client   *http.Client
+	conn     *grpc.ClientConn
+	grpc     colmetricspb.MetricsServiceClient
+
+	mu     sync.Mutex
+	latest *collector.Snapshot
+}
+
+// NewOTLPExporter creates an exporter for the configured collector endpoint
+func NewOTLPExporter(config utils.OTLPConfig, info probes.SystemInfo) (*OTLPExporter, error) {
+	exporter := &OTLPExporter{
+		config:   config,
+		resource: OTLPResource(info),
+		start:    time.Now(),
+	}
+
+	switch config.Protocol {
+	case "", "http/protobuf":
+		exporter.client = &http.Client{Timeout: time.Duration(config.Timeout) * time.Second}
+	case "grpc":
+		creds := credentials.NewTLS(&tls.Config{})
+		if config.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(config.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+		exporter.conn = conn
+		exporter.grpc = colmetricspb.NewMetricsServiceClient(conn)
+	default:
+		return nil, fmt.Errorf("Unknown OTLP protocol %q", config.Protocol)
+	}
+	return exporter, nil
+}
+
+// Add keeps the snapshot to be exported at the next push
+func (e *OTLPExporter) Add(snapshot collector.Snapshot) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.latest = &snapshot
+}
+
+// request builds the export request for a snapshot
+func (e *OTLPExporter) request(snapshot collector.Snapshot) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: e.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: "github.com/aHugues/system-monitor/monitor"},
+				Metrics: OTLPMetrics(snapshot.Stats, snapshot.Time, e.start),
+			}},
+		}},
+	}
+}
+
+// Export sends the latest snapshot to the collector
+func (e *OTLPExporter) Export() error {
+	e.mu.Lock()
+	snapshot := e.latest
+	e.latest = nil
+	e.mu.Unlock()
+	if snapshot == nil {
+		return nil
+	}
+
+	request := e.request(*snapshot)
+	if e.grpc != nil {
+		return e.exportGRPC(request)
+	}
+	return e.exportHTTP(request)
+}
+
+func (e *OTLPExporter) exportGRPC(request *colmetricspb.ExportMetricsServiceRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.Timeout)*time.Second)
+	defer cancel()
+	if len(e.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(e.config.Headers))
+	}
+
+	response, err := e.grpc.Export(ctx, request)
+	if err != nil {
+		return err
+	}
+	if partial := response.GetPartialSuccess(); partial != nil && partial.RejectedDataPoints > 0 {
+		log.Warnf("OTLP collector rejected %d data points: %q", partial.RejectedDataPoints, partial.ErrorMessage)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) exportHTTP(request *colmetricspb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequest(http.MethodPost, e.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.config.Headers {
+		httpRequest.Header.Set(k, v)
+	}
+
+	response, err := e.client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return errors.New("Unexpected status " + response.Status)
+	}
+	return nil
+}
+
+// Run exports the latest snapshot at every interval until stop is closed
+func (e *OTLPExporter) Run(stop <-chan struct{}) {
+	interval := time.Duration(e.config.PushInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	log.Infof("Exporting OTLP metrics to %q every %s", e.config.Endpoint, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			if err := e.Export(); err != nil {
+				log.Errorf("Error exporting OTLP metrics: %q", err)
+			}
+			e.Close()
+			return
+		case <-ticker.C:
+			if err := e.Export(); err != nil {
+				log.Errorf("Error exporting OTLP metrics: %q", err)
+			}
+		}
+	}
+}
+
+// Close releases the gRPC connection
+func (e *OTLPExporter) Close() error {
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	return nil
+}
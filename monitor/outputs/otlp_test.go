@@ -0,0 +1,133 @@
+package outputs
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+var testInfo = probes.SystemInfo{OperatingSystem: "Linux", Kernel: "5.4.0", Distro: "Ubuntu", Machine: "x86_64", Name: "web-01"}
+
+// otlpStats returns the test stats with the CPU usage, which the other outputs do not use
+func otlpStats() stats.FullStats {
+	fullStats := testStats()
+	usage := 12.5
+	fullStats.CPUUsage = &usage
+	fullStats.DiskUsage[0].SizeBytes = 102834466816
+	fullStats.DiskUsage[0].UsedBytes = 46170861568
+	return fullStats
+}
+
+// checkRequest verifies the resource and metric names of an export request
+func checkRequest(t *testing.T, request *colmetricspb.ExportMetricsServiceRequest) {
+	resource := request.ResourceMetrics[0].Resource
+	attributes := make(map[string]string)
+	for _, attribute := range resource.Attributes {
+		attributes[attribute.Key] = attribute.Value.GetStringValue()
+	}
+	if attributes["host.name"] != "web-01" || attributes["os.type"] != "linux" || attributes["os.description"] != "Ubuntu 5.4.0" || attributes["host.arch"] != "amd64" {
+		t.Errorf("Invalid resource attributes %v", attributes)
+	}
+
+	names := []string{}
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names = append(names, metric.Name)
+	}
+	expected := []string{"system.memory.usage", "system.memory.limit", "system_monitor.memory.shared", "system.cpu.utilization", "system.filesystem.usage", "system.filesystem.limit", "system_monitor.service.active", "system.uptime"}
+	if len(names) != len(expected) {
+		t.Fatalf("Invalid metrics %q", names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("Invalid metrics %q", names)
+		}
+	}
+
+	for _, point := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints {
+		if state := point.Attributes[0].Value.GetStringValue(); state != "used" && state != "free" {
+			t.Errorf("Invalid memory state %q", state)
+		}
+	}
+	if utilization := request.ResourceMetrics[0].ScopeMetrics[0].Metrics[3].GetGauge().DataPoints[0].GetAsDouble(); utilization != 0.125 {
+		t.Errorf("Invalid CPU utilization %v", utilization)
+	}
+	usage := request.ResourceMetrics[0].ScopeMetrics[0].Metrics[4].GetSum().DataPoints
+	if usage[0].GetAsInt() != 46170861568 || usage[1].GetAsInt() != 56663605248 {
+		t.Errorf("Invalid filesystem usage %v", usage)
+	}
+	limit := request.ResourceMetrics[0].ScopeMetrics[0].Metrics[5].GetSum().DataPoints
+	if limit[0].GetAsInt() != 102834466816 {
+		t.Errorf("Invalid filesystem limit %v", limit)
+	}
+}
+
+// Test exporting over HTTP/protobuf
+func TestOTLPExportHTTP(t *testing.T) {
+	received := make(chan *colmetricspb.ExportMetricsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("X-Api-Key") != "secret" {
+			t.Error("Invalid headers")
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		request := &colmetricspb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("Invalid body: %q", err)
+		}
+		received <- request
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(utils.OTLPConfig{Endpoint: server.URL + "/v1/metrics", Headers: map[string]string{"X-Api-Key": "secret"}, Timeout: 1}, testInfo)
+	if err != nil {
+		t.Fatalf("Impossible to create exporter: %q", err)
+	}
+	exporter.Add(collector.Snapshot{Time: time.Now(), Stats: otlpStats()})
+	if err := exporter.Export(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	checkRequest(t, <-received)
+}
+
+type testMetricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	received chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (s *testMetricsServer) Export(ctx context.Context, request *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.received <- request
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+// Test exporting over gRPC
+func TestOTLPExportGRPC(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := grpc.NewServer()
+	metricsServer := &testMetricsServer{received: make(chan *colmetricspb.ExportMetricsServiceRequest, 1)}
+	colmetricspb.RegisterMetricsServiceServer(server, metricsServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	exporter, err := NewOTLPExporter(utils.OTLPConfig{Endpoint: listener.Addr().String(), Protocol: "grpc", Insecure: true, Timeout: 5}, testInfo)
+	if err != nil {
+		t.Fatalf("Impossible to create exporter: %q", err)
+	}
+	defer exporter.Close()
+	exporter.Add(collector.Snapshot{Time: time.Now(), Stats: otlpStats()})
+	if err := exporter.Export(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	checkRequest(t, <-metricsServer.received)
+}
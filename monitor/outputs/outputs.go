@@ -0,0 +1,71 @@
+package outputs
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aHugues/system-monitor/monitor/stats"
+
+	log "github.com/cihub/seelog"
+)
+
+// hostname returns the name of the host the metrics are attached to
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		log.Errorf("Impossible to read hostname: %q", err)
+		return "unknown"
+	}
+	return name
+}
+
+// sampleGroup gathers the fields of the samples sharing a probe and tags
+type sampleGroup struct {
+	probe  string
+	tags   map[string]string
+	fields []stats.Sample
+}
+
+// groupSamples groups the samples by probe and tags, keeping their order
+func groupSamples(samples []stats.Sample) []*sampleGroup {
+	groups := []*sampleGroup{}
+	index := make(map[string]*sampleGroup)
+	for _, sample := range samples {
+		key := stats.Sample{Probe: sample.Probe, Tags: sample.Tags}.Series()
+		group, ok := index[key]
+		if !ok {
+			group = &sampleGroup{probe: sample.Probe, tags: sample.Tags}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.fields = append(group.fields, sample)
+	}
+	return groups
+}
+
+// expandTemplate replaces the {hostname}, {probe}, {field} and {tag} placeholders
+// of a metric name template, sanitizing the substituted values
+func expandTemplate(template string, sample stats.Sample, host string, sanitize func(string) string) string {
+	replacements := []string{
+		"{hostname}", sanitize(host),
+		"{probe}", sanitize(sample.Probe),
+		"{field}", sanitize(sample.Field),
+	}
+	for k, v := range sample.Tags {
+		replacements = append(replacements, "{"+k+"}", sanitize(v))
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// sanitizeComponent turns a value such as a mountpoint or a service name into
+// a single metric path component, the root mountpoint becoming "root"
+func sanitizeComponent(value string) string {
+	component := strings.Trim(invalidComponentChars.ReplaceAllString(value, "_"), "_")
+	if component == "" {
+		return "root"
+	}
+	return component
+}
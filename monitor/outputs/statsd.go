@@ -0,0 +1,125 @@
+package outputs
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+var dogTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_")
+
+// StatsdEmitter sends the collected stats as StatsD gauges over UDP
+type StatsdEmitter struct {
+	config utils.StatsdConfig
+	host   string
+	conn   net.Conn
+}
+
+// NewStatsdEmitter creates an emitter sending to the configured address
+func NewStatsdEmitter(config utils.StatsdConfig) (*StatsdEmitter, error) {
+	if config.MaxPacketSize <= 0 {
+		config.MaxPacketSize = 1432
+	}
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdEmitter{config: config, host: hostname(), conn: conn}, nil
+}
+
+// metricName returns the gauge name of a sample, using the configured mapping when
+// there is one. Without DogStatsD tags, the tag values are part of the default name.
+func (e *StatsdEmitter) metricName(sample stats.Sample) string {
+	var name string
+	if template, ok := e.config.Mapping[sample.Probe+"."+sample.Field]; ok {
+		name = expandTemplate(template, sample, e.host, sanitizeComponent)
+	} else {
+		components := []string{sanitizeComponent(sample.Probe)}
+		if !e.config.DogStatsd {
+			keys := make([]string, 0, len(sample.Tags))
+			for k := range sample.Tags {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				components = append(components, sanitizeComponent(sample.Tags[k]))
+			}
+		}
+		name = strings.Join(append(components, sanitizeComponent(sample.Field)), ".")
+	}
+	if e.config.Prefix != "" {
+		name = e.config.Prefix + "." + name
+	}
+	return name
+}
+
+// dogTags renders the DogStatsD tags of a sample
+func (e *StatsdEmitter) dogTags(sample stats.Sample) string {
+	tags := []string{}
+	for k, v := range e.config.Tags {
+		tags = append(tags, dogTagEscaper.Replace(k)+":"+dogTagEscaper.Replace(v))
+	}
+	for k, v := range sample.Tags {
+		tags = append(tags, dogTagEscaper.Replace(k)+":"+dogTagEscaper.Replace(v))
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+// Render returns one gauge line per sample of the stats
+func (e *StatsdEmitter) Render(fullStats stats.FullStats) []string {
+	lines := []string{}
+	for _, sample := range fullStats.Samples() {
+		line := e.metricName(sample) + ":" + strconv.FormatFloat(sample.Value, 'f', -1, 64) + "|g"
+		if e.config.DogStatsd {
+			line += e.dogTags(sample)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// packets groups the lines into packets no larger than the maximum packet size
+func (e *StatsdEmitter) packets(lines []string) []string {
+	packets := []string{}
+	current := ""
+	for _, line := range lines {
+		if current != "" && len(current)+1+len(line) > e.config.MaxPacketSize {
+			packets = append(packets, current)
+			current = ""
+		}
+		if current == "" {
+			current = line
+		} else {
+			current += "\n" + line
+		}
+	}
+	if current != "" {
+		packets = append(packets, current)
+	}
+	return packets
+}
+
+// Emit sends the gauges of a snapshot
+func (e *StatsdEmitter) Emit(snapshot collector.Snapshot) {
+	for _, packet := range e.packets(e.Render(snapshot.Stats)) {
+		if _, err := e.conn.Write([]byte(packet)); err != nil {
+			log.Errorf("Error sending StatsD packet: %q", err)
+		}
+	}
+}
+
+// Close releases the UDP socket
+func (e *StatsdEmitter) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,81 @@
+package outputs
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the default and mapped gauge names
+func TestStatsdRender(t *testing.T) {
+	emitter := StatsdEmitter{
+		config: utils.StatsdConfig{
+			Prefix:  "sysmon",
+			Mapping: map[string]string{"disk-usage.used": "{hostname}.disk.{mountpoint}.used"},
+		},
+		host: "my.host",
+	}
+	lines := emitter.Render(testStats())
+	expected := []string{
+		"sysmon.disk_usage.dev_sda1.home.size:96|g",
+		"sysmon.my_host.disk.home.used:43|g",
+		"sysmon.ram_usage.available:16316868|g",
+		"sysmon.ram_usage.used:5157872|g",
+		"sysmon.ram_usage.free:7319832|g",
+		"sysmon.ram_usage.shared:662180|g",
+		"sysmon.services_status.nginx.active:1|g",
+		"sysmon.uptime.seconds:3600|g",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Invalid lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+// Test the DogStatsD tags
+func TestStatsdRenderDogTags(t *testing.T) {
+	emitter := StatsdEmitter{config: utils.StatsdConfig{DogStatsd: true, Tags: map[string]string{"env": "prod"}}}
+	lines := emitter.Render(testStats())
+	if lines[0] != "disk_usage.size:96|g|#env:prod,filesystem:/dev/sda1,mountpoint:/home" {
+		t.Fatalf("Invalid line %q", lines[0])
+	}
+	if lines[2] != "ram_usage.available:16316868|g|#env:prod" {
+		t.Fatalf("Invalid line %q", lines[2])
+	}
+}
+
+// Test that the gauges are sent over UDP in packets of limited size
+func TestStatsdEmit(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Impossible to listen: %q", err)
+	}
+	defer listener.Close()
+
+	emitter, err := NewStatsdEmitter(utils.StatsdConfig{Address: listener.LocalAddr().String(), MaxPacketSize: 100})
+	if err != nil {
+		t.Fatalf("Impossible to create emitter: %q", err)
+	}
+	defer emitter.Close()
+	emitter.Emit(collector.Snapshot{Time: time.Now(), Stats: testStats()})
+
+	received := []string{}
+	buffer := make([]byte, 1500)
+	for len(strings.Join(received, "\n")) < len(strings.Join(emitter.Render(testStats()), "\n")) {
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("Error receiving packets: %q", err)
+		}
+		if n > 100 {
+			t.Fatalf("Packet too large: %d bytes", n)
+		}
+		received = append(received, string(buffer[:n]))
+	}
+	if len(received) < 2 {
+		t.Fatal("Expecting several packets")
+	}
+}
@@ -0,0 +1,65 @@
+package probes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// CPUTimes holds the time spent by all the CPUs since boot, in clock ticks
+type CPUTimes struct {
+	Idle  uint64
+	Total uint64
+}
+
+// CPUTimesFromProc builds the CPU times from the aggregated cpu line of /proc/stat
+func CPUTimesFromProc(content string) (CPUTimes, error) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		times := CPUTimes{}
+		// user, nice, system, idle, iowait, irq, softirq and steal, the guest
+		// times being already counted in user and nice
+		for i, field := range fields[1:] {
+			if i == 8 {
+				break
+			}
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return CPUTimes{}, fmt.Errorf("Invalid CPU times %q", line)
+			}
+			times.Total += value
+			if i == 3 || i == 4 {
+				times.Idle += value
+			}
+		}
+		return times, nil
+	}
+	return CPUTimes{}, fmt.Errorf("No CPU times found")
+}
+
+// GetCPUTimes reads the current CPU times from /proc/stat
+func GetCPUTimes() (CPUTimes, error) {
+	log.Debug("Reading CPU times from /proc/stat")
+	dat, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		log.Errorf("Error reading CPU times: %q", err)
+		return CPUTimes{}, err
+	}
+	return CPUTimesFromProc(string(dat))
+}
+
+// CPUUsage returns the percentage of time the CPUs were busy between two readings
+func CPUUsage(previous CPUTimes, current CPUTimes) float64 {
+	if current.Total <= previous.Total || current.Idle < previous.Idle {
+		return 0
+	}
+	total := float64(current.Total - previous.Total)
+	idle := float64(current.Idle - previous.Idle)
+	return (total - idle) * 100 / total
+}
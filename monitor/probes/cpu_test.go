@@ -0,0 +1,27 @@
+package probes
+
+import "testing"
+
+func TestCPUTimesFromProc(t *testing.T) {
+	content := "cpu  100 10 50 800 40 0 0 0 5 0\ncpu0 50 5 25 400 20 0 0 0 0 0\nintr 1234\n"
+	times, err := CPUTimesFromProc(content)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if times != (CPUTimes{Idle: 840, Total: 1000}) {
+		t.Fatalf("Invalid CPU times %+v", times)
+	}
+	if _, err := CPUTimesFromProc("intr 1234\n"); err == nil {
+		t.Fatal("Expecting an error without cpu line")
+	}
+}
+
+func TestCPUUsage(t *testing.T) {
+	usage := CPUUsage(CPUTimes{Idle: 840, Total: 1000}, CPUTimes{Idle: 915, Total: 1100})
+	if usage != 25 {
+		t.Fatalf("Invalid usage %v", usage)
+	}
+	if usage := CPUUsage(CPUTimes{Idle: 840, Total: 1000}, CPUTimes{Idle: 840, Total: 1000}); usage != 0 {
+		t.Fatalf("Invalid usage %v", usage)
+	}
+}
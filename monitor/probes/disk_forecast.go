@@ -0,0 +1,61 @@
+package probes
+
+import (
+	"errors"
+	"time"
+)
+
+// UsageSample represents the space used on a device at a given time, in bytes
+type UsageSample struct {
+	Timestamp int64
+	Used      float64
+}
+
+// DiskForecast represents the estimated evolution of the usage of a device
+type DiskForecast struct {
+	FillRate   float64 `json:"fill-rate"`
+	TimeToFull *int64  `json:"time-to-full,omitempty"`
+	FullSoon   bool    `json:"full-soon"`
+}
+
+// FullWithin returns True if the device is expected to be full within the duration
+func (forecast *DiskForecast) FullWithin(duration time.Duration) bool {
+	return forecast.TimeToFull != nil && *forecast.TimeToFull <= int64(duration/time.Second)
+}
+
+// ForecastDiskUsage fits a linear regression on the usage history of a device
+// and estimates when it will be full. The samples are in bytes, the fill rate is
+// given in GB per hour and the time to full in seconds, left empty when the usage
+// is not growing.
+func ForecastDiskUsage(device DeviceStat, samples []UsageSample, now time.Time) (DiskForecast, error) {
+	if len(samples) < 2 {
+		return DiskForecast{}, errors.New("Not enough samples")
+	}
+
+	// Timestamps are taken relative to now to keep the sums small
+	var sumX, sumY, sumXX, sumXY float64
+	for _, sample := range samples {
+		x := float64(sample.Timestamp - now.Unix())
+		sumX += x
+		sumY += sample.Used
+		sumXX += x * x
+		sumXY += x * sample.Used
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return DiskForecast{}, errors.New("Samples are not spread over time")
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+
+	forecast := DiskForecast{FillRate: slope * 3600 / gibibyte}
+	if slope > 0 {
+		timeToFull := int64(0)
+		if intercept < float64(device.SizeBytes) {
+			timeToFull = int64((float64(device.SizeBytes) - intercept) / slope)
+		}
+		forecast.TimeToFull = &timeToFull
+	}
+	return forecast, nil
+}
@@ -0,0 +1,77 @@
+package probes
+
+import (
+	"testing"
+	"time"
+)
+
+// Test the forecast of a device filling up at a constant rate
+func TestForecastGrowing(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	device := DeviceStat{Filesystem: "/dev/sda1", MountPoint: "/", Size: 100, Used: 85, SizeBytes: 100 * gibibyte, UsedBytes: 85 * gibibyte}
+	samples := []UsageSample{
+		{now.Unix() - 7200, 75 * gibibyte},
+		{now.Unix() - 3600, 80 * gibibyte},
+		{now.Unix(), 85 * gibibyte},
+	}
+
+	forecast, err := ForecastDiskUsage(device, samples, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if forecast.FillRate != 5 || forecast.TimeToFull == nil || *forecast.TimeToFull != 3*3600 {
+		t.Fatalf("Invalid forecast %+v", forecast)
+	}
+	if !forecast.FullWithin(24*time.Hour) || forecast.FullWithin(time.Hour) {
+		t.Fatal("Invalid alert condition")
+	}
+}
+
+// Test the forecast of a device with a stable usage
+func TestForecastStable(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	device := DeviceStat{Filesystem: "/dev/sda1", MountPoint: "/", Size: 100, Used: 95, SizeBytes: 100 * gibibyte, UsedBytes: 95 * gibibyte}
+	samples := []UsageSample{
+		{now.Unix() - 3600, 95 * gibibyte},
+		{now.Unix(), 95 * gibibyte},
+	}
+
+	forecast, err := ForecastDiskUsage(device, samples, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if forecast.FillRate != 0 || forecast.TimeToFull != nil || forecast.FullWithin(24*time.Hour) {
+		t.Fatalf("Invalid forecast %+v", forecast)
+	}
+}
+
+// Test the forecast without enough history
+func TestForecastNotEnoughSamples(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	device := DeviceStat{Filesystem: "/dev/sda1", MountPoint: "/", Size: 100, Used: 95}
+
+	if _, err := ForecastDiskUsage(device, []UsageSample{{now.Unix(), 95}}, now); err == nil {
+		t.Fatal("Expecting an error")
+	}
+	if _, err := ForecastDiskUsage(device, []UsageSample{{now.Unix(), 95}, {now.Unix(), 96}}, now); err == nil {
+		t.Fatal("Expecting an error")
+	}
+}
+
+// Test that a growth smaller than a GB per hour is detected
+func TestForecastSlowGrowth(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	device := DeviceStat{Filesystem: "/dev/sda1", MountPoint: "/", Size: 1, Used: 1, SizeBytes: 1000000000, UsedBytes: 900000000}
+	samples := []UsageSample{
+		{now.Unix() - 7200, 700000000},
+		{now.Unix() - 3600, 800000000},
+		{now.Unix(), 900000000},
+	}
+	forecast, err := ForecastDiskUsage(device, samples, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if forecast.TimeToFull == nil || *forecast.TimeToFull != 3600 || forecast.FillRate <= 0 || forecast.FillRate >= 1 {
+		t.Fatalf("Invalid forecast %+v", forecast)
+	}
+}
@@ -3,19 +3,25 @@ package probes
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 
 	log "github.com/cihub/seelog"
 )
 
-// DeviceStat represents the usage stats for a device
+// gibibyte converts the sizes in bytes to the GB shown by df -h
+const gibibyte = 1 << 30
+
+// DeviceStat represents the usage stats for a device, the sizes being given in
+// GB and in bytes
 type DeviceStat struct {
-	Filesystem string `json:"filesystem"`
-	MountPoint string `json:"mountpoint"`
-	Size       int64  `json:"size"`
-	Used       int64  `json:"used"`
+	Filesystem string        `json:"filesystem"`
+	MountPoint string        `json:"mountpoint"`
+	Size       int64         `json:"size"`
+	Used       int64         `json:"used"`
+	SizeBytes  int64         `json:"size-bytes"`
+	UsedBytes  int64         `json:"used-bytes"`
+	Forecast   *DiskForecast `json:"forecast,omitempty"`
 }
 
 // ToString creates a string from a given DeviceStats
@@ -23,30 +29,36 @@ func (dev *DeviceStat) ToString() string {
 	return fmt.Sprintf("Device %s - mountpoint %s\tTotal size %dGB - Used %dGB", dev.Filesystem, dev.MountPoint, dev.Size, dev.Used)
 }
 
-// DeviceStatFromDf builds the device stats from a DF output
+// DeviceStatFromDf builds the device stats from a line of df -B1 --output=source,size,used,target,
+// only the devices backed by a file such as /dev/sda1 being kept
 func DeviceStatFromDf(dfLine string) (DeviceStat, error) {
-	r := regexp.MustCompile(`^(?P<device_path>(/(\w+))+) +(?P<size>\d+)\D +(?P<used>\d+)\D.+(?P<mountpoint>(/(\w*))+)$`)
-	match := r.FindStringSubmatch(dfLine)
-	if r.MatchString(dfLine) == false {
+	fields := strings.Fields(dfLine)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "/") {
 		return DeviceStat{}, errors.New("No match")
 	}
-	result := make(map[string]string)
-	for i, name := range r.SubexpNames() {
-		if i != 0 && name != "" {
-			result[name] = match[i]
-		}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return DeviceStat{}, errors.New("No match")
 	}
-
-	filesystem := result["device_path"]
-	size, _ := strconv.ParseInt(result["size"], 10, 64)
-	used, _ := strconv.ParseInt(result["used"], 10, 64)
-	mountpoint := result["mountpoint"]
-	return DeviceStat{filesystem, mountpoint, size, used}, nil
+	used, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return DeviceStat{}, errors.New("No match")
+	}
+	// The mount point is the last column and may contain spaces
+	mountpoint := strings.Join(fields[3:], " ")
+	return DeviceStat{
+		Filesystem: fields[0],
+		MountPoint: mountpoint,
+		Size:       (size + gibibyte/2) / gibibyte,
+		Used:       (used + gibibyte/2) / gibibyte,
+		SizeBytes:  size,
+		UsedBytes:  used,
+	}, nil
 }
 
 // GetUsageStats compute the disk usage on the machine and return it
 func GetUsageStats(runner commandRunner) []DeviceStat {
-	dfCommand := []string{"/usr/bin/df", "-h", "-x", "tmpfs", "-x", "devtmpfs", "-x", "squashfs"}
+	dfCommand := []string{"/usr/bin/df", "-B1", "--output=source,size,used,target", "-x", "tmpfs", "-x", "devtmpfs", "-x", "squashfs"}
 	commandResult := runner.runCommand(dfCommand)
 
 	if commandResult.StatusCode != 0 {
@@ -16,27 +16,35 @@ func (r mockCommandRunnerDisk) runCommand(command []string) CommandResult {
 
 // Basic test when line corresponds to a correct device
 func TestDeviceStatFromDfOk(t *testing.T) {
-	device, err := DeviceStatFromDf("/dev/sdb6        41G   32G  6.7G  83% /")
+	device, err := DeviceStatFromDf("/dev/sdb6       44023414784 34359738368 /mnt/my disk")
 	if err != nil {
 		t.Fatal("Invalid test case")
 	}
-	if device.Filesystem != "/dev/sdb6" || device.MountPoint != "/" || device.Size != 41 || device.Used != 32 {
+	if device.Filesystem != "/dev/sdb6" || device.MountPoint != "/mnt/my disk" || device.Size != 41 || device.Used != 32 {
 		t.Fatal("Invalid test case")
 	}
+	if device.SizeBytes != 44023414784 || device.UsedBytes != 34359738368 {
+		t.Fatalf("Invalid sizes in bytes %+v", device)
+	}
+	for _, line := range []string{"Filesystem 1B-blocks Used Mounted on", "overlay 1000 500 /", "/dev/sda1 500M 1.5T /"} {
+		if _, err := DeviceStatFromDf(line); err == nil {
+			t.Fatalf("Expecting no match for %q", line)
+		}
+	}
 }
 
 // Test running the whole command with a sample output
 func TestDiskOk(t *testing.T) {
 	mockRunner := mockCommandRunnerDisk{}
 	mockRunDisk = func(command []string) CommandResult {
-		expectedCommand := []string{"/usr/bin/df", "-h", "-x", "tmpfs", "-x", "devtmpfs", "-x", "squashfs"}
+		expectedCommand := []string{"/usr/bin/df", "-B1", "--output=source,size,used,target", "-x", "tmpfs", "-x", "devtmpfs", "-x", "squashfs"}
 		if !reflect.DeepEqual(command, expectedCommand) {
 			t.Fatal("Command is invalid")
 		}
 		lines := []string{
-			"Filesystem      Size  Used Avail Use% Mounted on",
-			"/dev/sdb6        41G   34G  5.1G  87% /",
-			"/dev/sda5        96G   43G   48G  48% /home",
+			"Filesystem        1B-blocks        Used Mounted on",
+			"/dev/sdb6       44023414784 36507222016 /",
+			"/dev/sda5      103079215104 46170898432 /home",
 		}
 		return CommandResult{
 			Stdout:     strings.Join(lines, "\n"),
@@ -62,14 +70,14 @@ func TestDiskOk(t *testing.T) {
 func TestDiskError(t *testing.T) {
 	mockRunner := mockCommandRunnerDisk{}
 	mockRunDisk = func(command []string) CommandResult {
-		expectedCommand := []string{"/usr/bin/df", "-h", "-x", "tmpfs", "-x", "devtmpfs", "-x", "squashfs"}
+		expectedCommand := []string{"/usr/bin/df", "-B1", "--output=source,size,used,target", "-x", "tmpfs", "-x", "devtmpfs", "-x", "squashfs"}
 		if !reflect.DeepEqual(command, expectedCommand) {
 			t.Fatal("Command is invalid")
 		}
 		lines := []string{
-			"Filesystem      Size  Used Avail Use% Mounted on",
-			"/dev/sdb6        41G   34G  5.1G  87% /",
-			"/dev/sda5        96G   43G   48G  48% /home",
+			"Filesystem        1B-blocks        Used Mounted on",
+			"/dev/sdb6       44023414784 36507222016 /",
+			"/dev/sda5      103079215104 46170898432 /home",
 		}
 		return CommandResult{
 			Stdout:     strings.Join(lines, "\n"),
@@ -87,7 +95,7 @@ func TestDiskError(t *testing.T) {
 
 // Test displaying a string from a Device
 func TestToString(t *testing.T) {
-	device := DeviceStat{"/dev/sda1", "/", 42, 13}
+	device := DeviceStat{Filesystem: "/dev/sda1", MountPoint: "/", Size: 42, Used: 13}
 	if device.ToString() != "Device /dev/sda1 - mountpoint /\tTotal size 42GB - Used 13GB" {
 		t.Fatal("Invalid test case")
 	}
@@ -0,0 +1,45 @@
+package probes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// LoadAverage represents the system load averaged over 1, 5 and 15 minutes
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// LoadAverageFromProc builds the load average from the content of /proc/loadavg
+func LoadAverageFromProc(content string) (LoadAverage, error) {
+	fields := strings.Fields(content)
+	if len(fields) < 3 {
+		return LoadAverage{}, fmt.Errorf("Invalid load average %q", content)
+	}
+	values := make([]float64, 3)
+	for i := range values {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return LoadAverage{}, fmt.Errorf("Invalid load average %q", content)
+		}
+		values[i] = value
+	}
+	return LoadAverage{Load1: values[0], Load5: values[1], Load15: values[2]}, nil
+}
+
+// GetLoadAverage reads the current load average from /proc/loadavg
+func GetLoadAverage() (LoadAverage, error) {
+	log.Debug("Reading load average from /proc/loadavg")
+	dat, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		log.Errorf("Error reading load average: %q", err)
+		return LoadAverage{}, err
+	}
+	return LoadAverageFromProc(string(dat))
+}
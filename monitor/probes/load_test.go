@@ -0,0 +1,21 @@
+package probes
+
+import "testing"
+
+func TestLoadAverageFromProc(t *testing.T) {
+	load, err := LoadAverageFromProc("0.52 0.48 0.40 2/312 12345\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if load != (LoadAverage{Load1: 0.52, Load5: 0.48, Load15: 0.40}) {
+		t.Fatalf("Invalid load average %+v", load)
+	}
+}
+
+func TestLoadAverageFromProcInvalid(t *testing.T) {
+	for _, content := range []string{"", "0.52 0.48", "0.52 high 0.40 2/312 12345"} {
+		if _, err := LoadAverageFromProc(content); err == nil {
+			t.Fatalf("Expecting an error for %q", content)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package probes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// InterfaceCounters holds the bytes received and sent by a network interface since boot
+type InterfaceCounters struct {
+	Name    string `json:"name"`
+	RxBytes uint64 `json:"rx-bytes"`
+	TxBytes uint64 `json:"tx-bytes"`
+}
+
+// NetworkCountersFromProc builds the interface counters from the content of /proc/net/dev
+func NetworkCountersFromProc(content string) ([]InterfaceCounters, error) {
+	counters := []InterfaceCounters{}
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.Contains(parts[0], "|") {
+			continue
+		}
+		// The received bytes come first, the sent ones being the 9th field
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("Invalid interface counters %q", line)
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid interface counters %q", line)
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid interface counters %q", line)
+		}
+		counters = append(counters, InterfaceCounters{Name: strings.TrimSpace(parts[0]), RxBytes: rx, TxBytes: tx})
+	}
+	return counters, nil
+}
+
+// GetNetworkCounters reads the current interface counters from /proc/net/dev
+func GetNetworkCounters() ([]InterfaceCounters, error) {
+	log.Debug("Reading network counters from /proc/net/dev")
+	dat, err := ioutil.ReadFile("/proc/net/dev")
+	if err != nil {
+		log.Errorf("Error reading network counters: %q", err)
+		return nil, err
+	}
+	return NetworkCountersFromProc(string(dat))
+}
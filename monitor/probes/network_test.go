@@ -0,0 +1,28 @@
+package probes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetworkCountersFromProc(t *testing.T) {
+	content := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:  123456     100    0    0    0     0          0         0   123456     100    0    0    0     0       0          0
+  eth0: 9876543    5000    0    0    0     0          0         0  1234567    4000    0    0    0     0       0          0
+`
+	counters, err := NetworkCountersFromProc(content)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	expected := []InterfaceCounters{
+		{Name: "lo", RxBytes: 123456, TxBytes: 123456},
+		{Name: "eth0", RxBytes: 9876543, TxBytes: 1234567},
+	}
+	if !reflect.DeepEqual(counters, expected) {
+		t.Fatalf("Invalid counters %+v", counters)
+	}
+	if _, err := NetworkCountersFromProc("eth0: 1 2 3\n"); err == nil {
+		t.Fatal("Expecting an error for truncated counters")
+	}
+}
@@ -0,0 +1,292 @@
+package probes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// clockTicks is the unit of the times of /proc, USER_HZ being 100 on Linux
+const clockTicks = 100
+
+// ProcessStat describes a running process
+type ProcessStat struct {
+	PID     int    `json:"pid"`
+	User    string `json:"user"`
+	Command string `json:"command"`
+	State   string `json:"state"`
+	Threads int    `json:"threads"`
+	// CPU is the percentage of a single CPU used by the process
+	CPU float64 `json:"cpu-percent"`
+	// RSS is the resident memory of the process, in kB
+	RSS uint64 `json:"rss"`
+	// OpenFiles is 0 when the descriptors of the process cannot be read
+	OpenFiles int `json:"open-files"`
+}
+
+// ProcessesStats lists the processes using the most resources
+type ProcessesStats struct {
+	// Count is the number of processes matching the name filters
+	Count       int           `json:"count"`
+	ByCPU       []ProcessStat `json:"by-cpu"`
+	ByMemory    []ProcessStat `json:"by-memory"`
+	ByOpenFiles []ProcessStat `json:"by-open-files"`
+}
+
+// ProcessOptions select the reported processes
+type ProcessOptions struct {
+	// Top is the number of processes reported for each resource
+	Top int
+	// Names are glob patterns matched against the process name and executable,
+	// all the processes being reported when empty
+	Names []string
+}
+
+// processTimes holds the fields of /proc/[pid]/stat used by the probe
+type processTimes struct {
+	name  string
+	state string
+	// ticks is the CPU time used by the process, in user and kernel mode
+	ticks uint64
+	// start is the time the process started after boot, in clock ticks
+	start uint64
+}
+
+// processTimesFromProc parses the content of /proc/[pid]/stat
+func processTimesFromProc(content string) (processTimes, error) {
+	// The name is between parentheses and may contain spaces and parentheses
+	open, end := strings.Index(content, "("), strings.LastIndex(content, ")")
+	if open < 0 || end < open {
+		return processTimes{}, fmt.Errorf("Invalid process stat %q", content)
+	}
+	// Fields after the name start with the state, the third field of the line
+	fields := strings.Fields(content[end+1:])
+	if len(fields) < 20 {
+		return processTimes{}, fmt.Errorf("Invalid process stat %q", content)
+	}
+	times := processTimes{name: content[open+1 : end], state: fields[0]}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	start, err3 := strconv.ParseUint(fields[19], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return processTimes{}, fmt.Errorf("Invalid process stat %q", content)
+	}
+	times.ticks, times.start = utime+stime, start
+	return times, nil
+}
+
+// processStatus holds the fields of /proc/[pid]/status used by the probe
+type processStatus struct {
+	uid     string
+	rss     uint64
+	threads int
+}
+
+// processStatusFromProc parses the content of /proc/[pid]/status, kernel threads
+// having no resident memory
+func processStatusFromProc(content string) processStatus {
+	status := processStatus{}
+	for _, line := range strings.Split(content, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		fields := strings.Fields(value)
+		if !found || len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Uid":
+			status.uid = fields[0]
+		case "VmRSS":
+			status.rss, _ = strconv.ParseUint(fields[0], 10, 64)
+		case "Threads":
+			status.threads, _ = strconv.Atoi(fields[0])
+		}
+	}
+	return status
+}
+
+// commandFromProc builds the command line from /proc/[pid]/cmdline on a single line,
+// kernel threads being shown by their name between brackets
+func commandFromProc(content string, name string) string {
+	command := strings.Join(strings.Fields(strings.ReplaceAll(content, "\x00", " ")), " ")
+	if command == "" {
+		return "[" + name + "]"
+	}
+	return command
+}
+
+// matchesNames checks whether a process name or its executable matches one of the patterns
+func matchesNames(patterns []string, name string, command string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	executable := ""
+	if fields := strings.Fields(command); len(fields) > 0 {
+		executable = filepath.Base(fields[0])
+	}
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, executable); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// topProcesses returns the first processes once sorted by decreasing value
+func topProcesses(processes []ProcessStat, top int, value func(ProcessStat) float64) []ProcessStat {
+	sorted := append([]ProcessStat{}, processes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return value(sorted[i]) > value(sorted[j])
+	})
+	if len(sorted) > top {
+		sorted = sorted[:top]
+	}
+	return sorted
+}
+
+// processKey identifies a process, the start time telling apart reused PIDs
+type processKey struct {
+	pid   int
+	start uint64
+}
+
+// ProcessSampler reads the processes from a /proc directory, computing their CPU
+// usage since the previous sample
+type ProcessSampler struct {
+	root string
+
+	mu           sync.Mutex
+	previousTime time.Time
+	previous     map[processKey]uint64
+	users        map[string]string
+}
+
+// NewProcessSampler creates a sampler reading the given /proc directory
+func NewProcessSampler(root string) *ProcessSampler {
+	return &ProcessSampler{root: root, users: make(map[string]string)}
+}
+
+// userName returns the name of a user, or its ID when unknown
+func (s *ProcessSampler) userName(uid string) string {
+	if name, ok := s.users[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	s.users[uid] = name
+	return name
+}
+
+// readProcess reads a process, returning false when it exited while being read
+func (s *ProcessSampler) readProcess(pid int) (ProcessStat, processTimes, bool) {
+	dir := filepath.Join(s.root, strconv.Itoa(pid))
+	content, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return ProcessStat{}, processTimes{}, false
+	}
+	times, err := processTimesFromProc(string(content))
+	if err != nil {
+		log.Warnf("Impossible to parse process %d: %q", pid, err)
+		return ProcessStat{}, processTimes{}, false
+	}
+	content, err = ioutil.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return ProcessStat{}, processTimes{}, false
+	}
+	status := processStatusFromProc(string(content))
+	cmdline, _ := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+
+	process := ProcessStat{
+		PID:     pid,
+		User:    s.userName(status.uid),
+		Command: commandFromProc(string(cmdline), times.name),
+		State:   times.state,
+		Threads: status.threads,
+		RSS:     status.rss,
+	}
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		process.OpenFiles = len(fds)
+	}
+	return process, times, true
+}
+
+// Sample reads the processes matching the options. The CPU usage is computed since
+// the previous sample, or since the start of the processes for the first one.
+func (s *ProcessSampler) Sample(now time.Time, options ProcessOptions) (ProcessesStats, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return ProcessesStats{}, err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(s.root, "uptime"))
+	if err != nil {
+		return ProcessesStats{}, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return ProcessesStats{}, fmt.Errorf("Invalid uptime %q", content)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return ProcessesStats{}, fmt.Errorf("Invalid uptime %q", content)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := now.Sub(s.previousTime).Seconds()
+	current := make(map[processKey]uint64)
+	processes := []ProcessStat{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		process, times, ok := s.readProcess(pid)
+		if !ok || !matchesNames(options.Names, times.name, process.Command) {
+			continue
+		}
+
+		key := processKey{pid: pid, start: times.start}
+		current[key] = times.ticks
+		if previous, ok := s.previous[key]; ok && elapsed > 0 && times.ticks >= previous {
+			process.CPU = float64(times.ticks-previous) / clockTicks / elapsed * 100
+		} else if lifetime := uptime - float64(times.start)/clockTicks; lifetime > 0 {
+			process.CPU = float64(times.ticks) / clockTicks / lifetime * 100
+		}
+		process.CPU = math.Round(process.CPU*10) / 10
+		processes = append(processes, process)
+	}
+	s.previous, s.previousTime = current, now
+
+	sort.Slice(processes, func(i, j int) bool { return processes[i].PID < processes[j].PID })
+	return ProcessesStats{
+		Count:       len(processes),
+		ByCPU:       topProcesses(processes, options.Top, func(p ProcessStat) float64 { return p.CPU }),
+		ByMemory:    topProcesses(processes, options.Top, func(p ProcessStat) float64 { return float64(p.RSS) }),
+		ByOpenFiles: topProcesses(processes, options.Top, func(p ProcessStat) float64 { return float64(p.OpenFiles) }),
+	}, nil
+}
+
+// GetTopProcesses reads the processes using the most CPU, memory and file descriptors,
+// their CPU usage being computed since the previous sample of the sampler
+func GetTopProcesses(sampler *ProcessSampler, options ProcessOptions) (ProcessesStats, error) {
+	log.Debugf("Reading processes from %s", sampler.root)
+	processes, err := sampler.Sample(time.Now(), options)
+	if err != nil {
+		log.Errorf("Error reading processes: %q", err)
+	}
+	return processes, err
+}
@@ -0,0 +1,79 @@
+package probes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeProcess creates the files of a process in a fake /proc directory
+func writeProcess(t *testing.T, root string, pid int, name string, ticks uint64, rss uint64, fds int, cmdline string) {
+	dir := filepath.Join(root, fmt.Sprint(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// utime and stime are the 14th and 15th fields, the start time the 22nd
+	stat := fmt.Sprintf("%d (%s) S 1 1 1 0 -1 4194560 100 0 0 0 %d 0 0 0 20 0 3 0 1000 1000 100 18446744073709551615\n", pid, name, ticks)
+	status := fmt.Sprintf("Name:\t%s\nState:\tS (sleeping)\nUid:\t4242\t4242\t4242\t4242\nVmRSS:\t    %d kB\nThreads:\t3\n", name, rss)
+	ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0644)
+	for i := 0; i < fds; i++ {
+		ioutil.WriteFile(filepath.Join(dir, "fd", fmt.Sprint(i)), nil, 0644)
+	}
+}
+
+func TestProcessTimesFromProc(t *testing.T) {
+	times, err := processTimesFromProc("42 (tmux: server (1)) R 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 1 0 12345 1000 100\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if !reflect.DeepEqual(times, processTimes{name: "tmux: server (1)", state: "R", ticks: 300, start: 12345}) {
+		t.Fatalf("Invalid times %+v", times)
+	}
+	if _, err := processTimesFromProc("42 (truncated) R 1 42"); err == nil {
+		t.Fatal("Expecting an error for a truncated stat")
+	}
+}
+
+// Test the selection of the top processes and the CPU usage between two samples
+func TestProcessSampler(t *testing.T) {
+	root := t.TempDir()
+	ioutil.WriteFile(filepath.Join(root, "uptime"), []byte("110.00 200.00\n"), 0644)
+	writeProcess(t, root, 1, "init", 50, 1000, 1, "/sbin/init\x00splash\x00")
+	writeProcess(t, root, 2, "kthreadd", 0, 0, 0, "")
+	writeProcess(t, root, 300, "nginx", 200, 5000, 20, "nginx: worker\nprocess\x00")
+	os.MkdirAll(filepath.Join(root, "self"), 0755)
+
+	sampler := NewProcessSampler(root)
+	now := time.Unix(1600000000, 0)
+	processes, err := sampler.Sample(now, ProcessOptions{Top: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	// The processes started 10s after boot, 100s ago
+	expected := ProcessStat{PID: 300, User: "4242", Command: "nginx: worker process", State: "S", Threads: 3, CPU: 2, RSS: 5000, OpenFiles: 20}
+	if processes.Count != 3 || len(processes.ByCPU) != 2 || processes.ByCPU[0] != expected {
+		t.Fatalf("Invalid processes %+v", processes)
+	}
+	if processes.ByMemory[1].PID != 1 || processes.ByOpenFiles[1].PID != 1 {
+		t.Fatalf("Invalid order %+v", processes)
+	}
+
+	writeProcess(t, root, 1, "init", 550, 1000, 1, "/sbin/init\x00splash\x00")
+	processes, err = sampler.Sample(now.Add(10*time.Second), ProcessOptions{Top: 5, Names: []string{"ini*", "kthreadd"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if processes.Count != 2 || processes.ByCPU[0].PID != 1 || processes.ByCPU[0].CPU != 50 || processes.ByCPU[1].Command != "[kthreadd]" {
+		t.Fatalf("Invalid filtered processes %+v", processes)
+	}
+
+	if _, err := NewProcessSampler(filepath.Join(root, "missing")).Sample(now, ProcessOptions{Top: 1}); err == nil {
+		t.Fatal("Expecting an error without /proc")
+	}
+}
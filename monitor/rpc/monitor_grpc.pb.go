@@ -0,0 +1,448 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: monitor.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Monitor_GetStats_FullMethodName          = "/systemmonitor.v1.Monitor/GetStats"
+	Monitor_GetDiskUsage_FullMethodName      = "/systemmonitor.v1.Monitor/GetDiskUsage"
+	Monitor_GetRAMUsage_FullMethodName       = "/systemmonitor.v1.Monitor/GetRAMUsage"
+	Monitor_GetSystemInfo_FullMethodName     = "/systemmonitor.v1.Monitor/GetSystemInfo"
+	Monitor_GetServicesStatus_FullMethodName = "/systemmonitor.v1.Monitor/GetServicesStatus"
+	Monitor_GetUptime_FullMethodName         = "/systemmonitor.v1.Monitor/GetUptime"
+	Monitor_GetCPUUsage_FullMethodName       = "/systemmonitor.v1.Monitor/GetCPUUsage"
+	Monitor_GetProcesses_FullMethodName      = "/systemmonitor.v1.Monitor/GetProcesses"
+	Monitor_WatchStats_FullMethodName        = "/systemmonitor.v1.Monitor/WatchStats"
+)
+
+// MonitorClient is the client API for Monitor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Monitor exposes the system probes
+type MonitorClient interface {
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*FullStats, error)
+	GetDiskUsage(ctx context.Context, in *GetDiskUsageRequest, opts ...grpc.CallOption) (*GetDiskUsageResponse, error)
+	GetRAMUsage(ctx context.Context, in *GetRAMUsageRequest, opts ...grpc.CallOption) (*RAMStats, error)
+	GetSystemInfo(ctx context.Context, in *GetSystemInfoRequest, opts ...grpc.CallOption) (*SystemInfo, error)
+	GetServicesStatus(ctx context.Context, in *GetServicesStatusRequest, opts ...grpc.CallOption) (*ServicesStatus, error)
+	GetUptime(ctx context.Context, in *GetUptimeRequest, opts ...grpc.CallOption) (*GetUptimeResponse, error)
+	GetCPUUsage(ctx context.Context, in *GetCPUUsageRequest, opts ...grpc.CallOption) (*GetCPUUsageResponse, error)
+	GetProcesses(ctx context.Context, in *GetProcessesRequest, opts ...grpc.CallOption) (*ProcessesStats, error)
+	// WatchStats streams the stats every time they are collected
+	WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (Monitor_WatchStatsClient, error)
+}
+
+type monitorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMonitorClient(cc grpc.ClientConnInterface) MonitorClient {
+	return &monitorClient{cc}
+}
+
+func (c *monitorClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*FullStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FullStats)
+	err := c.cc.Invoke(ctx, Monitor_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetDiskUsage(ctx context.Context, in *GetDiskUsageRequest, opts ...grpc.CallOption) (*GetDiskUsageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetDiskUsageResponse)
+	err := c.cc.Invoke(ctx, Monitor_GetDiskUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetRAMUsage(ctx context.Context, in *GetRAMUsageRequest, opts ...grpc.CallOption) (*RAMStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RAMStats)
+	err := c.cc.Invoke(ctx, Monitor_GetRAMUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetSystemInfo(ctx context.Context, in *GetSystemInfoRequest, opts ...grpc.CallOption) (*SystemInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SystemInfo)
+	err := c.cc.Invoke(ctx, Monitor_GetSystemInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetServicesStatus(ctx context.Context, in *GetServicesStatusRequest, opts ...grpc.CallOption) (*ServicesStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ServicesStatus)
+	err := c.cc.Invoke(ctx, Monitor_GetServicesStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetUptime(ctx context.Context, in *GetUptimeRequest, opts ...grpc.CallOption) (*GetUptimeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUptimeResponse)
+	err := c.cc.Invoke(ctx, Monitor_GetUptime_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetCPUUsage(ctx context.Context, in *GetCPUUsageRequest, opts ...grpc.CallOption) (*GetCPUUsageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetCPUUsageResponse)
+	err := c.cc.Invoke(ctx, Monitor_GetCPUUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) GetProcesses(ctx context.Context, in *GetProcessesRequest, opts ...grpc.CallOption) (*ProcessesStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProcessesStats)
+	err := c.cc.Invoke(ctx, Monitor_GetProcesses_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (Monitor_WatchStatsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Monitor_ServiceDesc.Streams[0], Monitor_WatchStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &monitorWatchStatsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Monitor_WatchStatsClient interface {
+	Recv() (*FullStats, error)
+	grpc.ClientStream
+}
+
+type monitorWatchStatsClient struct {
+	grpc.ClientStream
+}
+
+func (x *monitorWatchStatsClient) Recv() (*FullStats, error) {
+	m := new(FullStats)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MonitorServer is the server API for Monitor service.
+// All implementations must embed UnimplementedMonitorServer
+// for forward compatibility
+//
+// Monitor exposes the system probes
+type MonitorServer interface {
+	GetStats(context.Context, *GetStatsRequest) (*FullStats, error)
+	GetDiskUsage(context.Context, *GetDiskUsageRequest) (*GetDiskUsageResponse, error)
+	GetRAMUsage(context.Context, *GetRAMUsageRequest) (*RAMStats, error)
+	GetSystemInfo(context.Context, *GetSystemInfoRequest) (*SystemInfo, error)
+	GetServicesStatus(context.Context, *GetServicesStatusRequest) (*ServicesStatus, error)
+	GetUptime(context.Context, *GetUptimeRequest) (*GetUptimeResponse, error)
+	GetCPUUsage(context.Context, *GetCPUUsageRequest) (*GetCPUUsageResponse, error)
+	GetProcesses(context.Context, *GetProcessesRequest) (*ProcessesStats, error)
+	// WatchStats streams the stats every time they are collected
+	WatchStats(*WatchStatsRequest, Monitor_WatchStatsServer) error
+	mustEmbedUnimplementedMonitorServer()
+}
+
+// UnimplementedMonitorServer must be embedded to have forward compatible implementations.
+type UnimplementedMonitorServer struct {
+}
+
+func (UnimplementedMonitorServer) GetStats(context.Context, *GetStatsRequest) (*FullStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedMonitorServer) GetDiskUsage(context.Context, *GetDiskUsageRequest) (*GetDiskUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDiskUsage not implemented")
+}
+func (UnimplementedMonitorServer) GetRAMUsage(context.Context, *GetRAMUsageRequest) (*RAMStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRAMUsage not implemented")
+}
+func (UnimplementedMonitorServer) GetSystemInfo(context.Context, *GetSystemInfoRequest) (*SystemInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSystemInfo not implemented")
+}
+func (UnimplementedMonitorServer) GetServicesStatus(context.Context, *GetServicesStatusRequest) (*ServicesStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServicesStatus not implemented")
+}
+func (UnimplementedMonitorServer) GetUptime(context.Context, *GetUptimeRequest) (*GetUptimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUptime not implemented")
+}
+func (UnimplementedMonitorServer) GetCPUUsage(context.Context, *GetCPUUsageRequest) (*GetCPUUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCPUUsage not implemented")
+}
+func (UnimplementedMonitorServer) GetProcesses(context.Context, *GetProcessesRequest) (*ProcessesStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProcesses not implemented")
+}
+func (UnimplementedMonitorServer) WatchStats(*WatchStatsRequest, Monitor_WatchStatsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStats not implemented")
+}
+func (UnimplementedMonitorServer) mustEmbedUnimplementedMonitorServer() {}
+
+// UnsafeMonitorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MonitorServer will
+// result in compilation errors.
+type UnsafeMonitorServer interface {
+	mustEmbedUnimplementedMonitorServer()
+}
+
+func RegisterMonitorServer(s grpc.ServiceRegistrar, srv MonitorServer) {
+	s.RegisterService(&Monitor_ServiceDesc, srv)
+}
+
+func _Monitor_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetDiskUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDiskUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetDiskUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetDiskUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetDiskUsage(ctx, req.(*GetDiskUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetRAMUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRAMUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetRAMUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetRAMUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetRAMUsage(ctx, req.(*GetRAMUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetSystemInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSystemInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetSystemInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetSystemInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetSystemInfo(ctx, req.(*GetSystemInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetServicesStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServicesStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetServicesStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetServicesStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetServicesStatus(ctx, req.(*GetServicesStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetUptime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUptimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetUptime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetUptime_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetUptime(ctx, req.(*GetUptimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetCPUUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCPUUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetCPUUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetCPUUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetCPUUsage(ctx, req.(*GetCPUUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_GetProcesses_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProcessesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetProcesses(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetProcesses_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetProcesses(ctx, req.(*GetProcessesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_WatchStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MonitorServer).WatchStats(m, &monitorWatchStatsServer{ServerStream: stream})
+}
+
+type Monitor_WatchStatsServer interface {
+	Send(*FullStats) error
+	grpc.ServerStream
+}
+
+type monitorWatchStatsServer struct {
+	grpc.ServerStream
+}
+
+func (x *monitorWatchStatsServer) Send(m *FullStats) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Monitor_ServiceDesc is the grpc.ServiceDesc for Monitor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Monitor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "systemmonitor.v1.Monitor",
+	HandlerType: (*MonitorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    _Monitor_GetStats_Handler,
+		},
+		{
+			MethodName: "GetDiskUsage",
+			Handler:    _Monitor_GetDiskUsage_Handler,
+		},
+		{
+			MethodName: "GetRAMUsage",
+			Handler:    _Monitor_GetRAMUsage_Handler,
+		},
+		{
+			MethodName: "GetSystemInfo",
+			Handler:    _Monitor_GetSystemInfo_Handler,
+		},
+		{
+			MethodName: "GetServicesStatus",
+			Handler:    _Monitor_GetServicesStatus_Handler,
+		},
+		{
+			MethodName: "GetUptime",
+			Handler:    _Monitor_GetUptime_Handler,
+		},
+		{
+			MethodName: "GetCPUUsage",
+			Handler:    _Monitor_GetCPUUsage_Handler,
+		},
+		{
+			MethodName: "GetProcesses",
+			Handler:    _Monitor_GetProcesses_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStats",
+			Handler:       _Monitor_WatchStats_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "monitor.proto",
+}
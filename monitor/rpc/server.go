@@ -0,0 +1,328 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// monitorServer implements the Monitor gRPC service from the snapshots of the collector
+type monitorServer struct {
+	UnimplementedMonitorServer
+	collector *collector.Collector
+	latest    func() (collector.Snapshot, bool)
+	// done ends the streams when the server stops gracefully
+	done chan struct{}
+
+	mu     sync.RWMutex
+	config utils.ProbesConfig
+}
+
+// Server is a gRPC server exposing the probes, whose configuration can change while it serves
+type Server struct {
+	*grpc.Server
+	monitor  *monitorServer
+	stopOnce sync.Once
+}
+
+// NewServer creates a gRPC server exposing the last stats collected, the options
+// adding the credentials and interceptors of the server
+func NewServer(config utils.ProbesConfig, statsCollector *collector.Collector, options ...grpc.ServerOption) *Server {
+	monitor := &monitorServer{config: config, collector: statsCollector, latest: statsCollector.Latest, done: make(chan struct{})}
+	server := &Server{Server: grpc.NewServer(options...), monitor: monitor}
+	RegisterMonitorServer(server.Server, monitor)
+	return server
+}
+
+// Reconfigure changes the probes served, taking effect from the next call
+func (s *Server) Reconfigure(config utils.ProbesConfig) {
+	s.monitor.mu.Lock()
+	defer s.monitor.mu.Unlock()
+	s.monitor.config = config
+}
+
+// GracefulStop ends the streams, then stops accepting calls and waits for the
+// ones in flight
+func (s *Server) GracefulStop() {
+	s.stopOnce.Do(func() { close(s.monitor.done) })
+	s.Server.GracefulStop()
+}
+
+// Serve accepts the calls on a bound listener until the server is stopped
+func (s *Server) Serve(listener net.Listener) error {
+	log.Infof("gRPC server listening on %q", listener.Addr())
+	return s.Server.Serve(listener)
+}
+
+// ToProto converts the stats to their protobuf representation
+func ToProto(fullStats stats.FullStats, timestamp time.Time) *FullStats {
+	result := &FullStats{
+		DiskUsage:      deviceStatsToProto(fullStats.DiskUsage),
+		RamUsage:       ramStatsToProto(fullStats.RAMUsage),
+		SystemInfo:     systemInfoToProto(fullStats.SystemInfo),
+		ServicesStatus: &ServicesStatus{Services: fullStats.Services},
+		Uptime:         fullStats.Uptime,
+		Timestamp:      timestamp.Unix(),
+		CpuUsage:       fullStats.CPUUsage,
+	}
+	if fullStats.Processes != nil {
+		result.Processes = processesStatsToProto(*fullStats.Processes)
+	}
+	return result
+}
+
+func deviceStatsToProto(devices []probes.DeviceStat) []*DeviceStat {
+	result := make([]*DeviceStat, 0, len(devices))
+	for _, device := range devices {
+		stat := &DeviceStat{
+			Filesystem: device.Filesystem,
+			Mountpoint: device.MountPoint,
+			Size:       device.Size,
+			Used:       device.Used,
+			SizeBytes:  device.SizeBytes,
+			UsedBytes:  device.UsedBytes,
+		}
+		if device.Forecast != nil {
+			stat.Forecast = &DiskForecast{
+				FillRate:   device.Forecast.FillRate,
+				TimeToFull: device.Forecast.TimeToFull,
+				FullSoon:   device.Forecast.FullSoon,
+			}
+		}
+		result = append(result, stat)
+	}
+	return result
+}
+
+func ramStatsToProto(ram probes.RAMStats) *RAMStats {
+	return &RAMStats{Available: ram.Available, Used: ram.Used, Free: ram.Free, Shared: ram.Shared}
+}
+
+func processStatsToProto(processes []probes.ProcessStat) []*ProcessStat {
+	result := make([]*ProcessStat, 0, len(processes))
+	for _, process := range processes {
+		result = append(result, &ProcessStat{
+			Pid:        int32(process.PID),
+			User:       process.User,
+			Command:    process.Command,
+			State:      process.State,
+			Threads:    int32(process.Threads),
+			CpuPercent: process.CPU,
+			Rss:        process.RSS,
+			OpenFiles:  int32(process.OpenFiles),
+		})
+	}
+	return result
+}
+
+func processesStatsToProto(processes probes.ProcessesStats) *ProcessesStats {
+	return &ProcessesStats{
+		Count:       int32(processes.Count),
+		ByCpu:       processStatsToProto(processes.ByCPU),
+		ByMemory:    processStatsToProto(processes.ByMemory),
+		ByOpenFiles: processStatsToProto(processes.ByOpenFiles),
+	}
+}
+
+func systemInfoToProto(info probes.SystemInfo) *SystemInfo {
+	return &SystemInfo{
+		OperatingSystem: info.OperatingSystem,
+		Kernel:          info.Kernel,
+		Distro:          info.Distro,
+		Machine:         info.Machine,
+		Name:            info.Name,
+	}
+}
+
+// latestStats returns the last stats collected, unavailable before the first collection
+func (s *monitorServer) latestStats() (collector.Snapshot, error) {
+	snapshot, ok := s.latest()
+	if !ok {
+		return snapshot, status.Error(codes.Unavailable, "No stats collected yet")
+	}
+	return snapshot, nil
+}
+
+// probeStats returns the last stats collected when a probe is enabled
+func (s *monitorServer) probeStats(probe string) (stats.FullStats, error) {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+
+	enabled := false
+	for _, name := range stats.EnabledProbes(config) {
+		enabled = enabled || name == probe
+	}
+	if !enabled {
+		return stats.FullStats{}, status.Errorf(codes.FailedPrecondition, "Probe %q is disabled", probe)
+	}
+	snapshot, err := s.latestStats()
+	return snapshot.Stats, err
+}
+
+// GetStats returns the last results of all the enabled probes
+func (s *monitorServer) GetStats(ctx context.Context, request *GetStatsRequest) (*FullStats, error) {
+	snapshot, err := s.latestStats()
+	if err != nil {
+		return nil, err
+	}
+	return ToProto(snapshot.Stats, snapshot.Time), nil
+}
+
+// GetDiskUsage returns the last result of the disk usage probe
+func (s *monitorServer) GetDiskUsage(ctx context.Context, request *GetDiskUsageRequest) (*GetDiskUsageResponse, error) {
+	fullStats, err := s.probeStats("disk-usage")
+	if err != nil {
+		return nil, err
+	}
+	return &GetDiskUsageResponse{Devices: deviceStatsToProto(fullStats.DiskUsage)}, nil
+}
+
+// GetRAMUsage returns the last result of the RAM usage probe
+func (s *monitorServer) GetRAMUsage(ctx context.Context, request *GetRAMUsageRequest) (*RAMStats, error) {
+	fullStats, err := s.probeStats("ram-usage")
+	if err != nil {
+		return nil, err
+	}
+	return ramStatsToProto(fullStats.RAMUsage), nil
+}
+
+// GetSystemInfo returns the last result of the system info probe
+func (s *monitorServer) GetSystemInfo(ctx context.Context, request *GetSystemInfoRequest) (*SystemInfo, error) {
+	fullStats, err := s.probeStats("system-info")
+	if err != nil {
+		return nil, err
+	}
+	return systemInfoToProto(fullStats.SystemInfo), nil
+}
+
+// GetServicesStatus returns the last result of the systemd services probe
+func (s *monitorServer) GetServicesStatus(ctx context.Context, request *GetServicesStatusRequest) (*ServicesStatus, error) {
+	fullStats, err := s.probeStats("services-status")
+	if err != nil {
+		return nil, err
+	}
+	return &ServicesStatus{Services: fullStats.Services}, nil
+}
+
+// GetUptime returns the last result of the uptime probe
+func (s *monitorServer) GetUptime(ctx context.Context, request *GetUptimeRequest) (*GetUptimeResponse, error) {
+	fullStats, err := s.probeStats("uptime")
+	if err != nil {
+		return nil, err
+	}
+	return &GetUptimeResponse{Seconds: fullStats.Uptime}, nil
+}
+
+// GetCPUUsage returns the last result of the CPU usage probe
+func (s *monitorServer) GetCPUUsage(ctx context.Context, request *GetCPUUsageRequest) (*GetCPUUsageResponse, error) {
+	fullStats, err := s.probeStats("cpu-usage")
+	if err != nil {
+		return nil, err
+	}
+	if fullStats.CPUUsage == nil {
+		return nil, status.Error(codes.Unavailable, "No CPU usage collected yet")
+	}
+	return &GetCPUUsageResponse{Percent: *fullStats.CPUUsage}, nil
+}
+
+// GetProcesses returns the last result of the processes probe
+func (s *monitorServer) GetProcesses(ctx context.Context, request *GetProcessesRequest) (*ProcessesStats, error) {
+	fullStats, err := s.probeStats("processes")
+	if err != nil {
+		return nil, err
+	}
+	if fullStats.Processes == nil {
+		return nil, status.Error(codes.Unavailable, "No processes collected yet")
+	}
+	return processesStatsToProto(*fullStats.Processes), nil
+}
+
+// filterProbes keeps only the selected probes of the stats
+func filterProbes(fullStats stats.FullStats, selected map[string]bool) stats.FullStats {
+	if len(selected) == 0 {
+		return fullStats
+	}
+	filtered := stats.FullStats{}
+	if selected["disk-usage"] {
+		filtered.DiskUsage = fullStats.DiskUsage
+	}
+	if selected["ram-usage"] {
+		filtered.RAMUsage = fullStats.RAMUsage
+	}
+	if selected["system-info"] {
+		filtered.SystemInfo = fullStats.SystemInfo
+	}
+	if selected["services-status"] {
+		filtered.Services = fullStats.Services
+	}
+	if selected["uptime"] {
+		filtered.Uptime = fullStats.Uptime
+	}
+	if selected["cpu-usage"] {
+		filtered.CPUUsage = fullStats.CPUUsage
+	}
+	if selected["processes"] {
+		filtered.Processes = fullStats.Processes
+	}
+	return filtered
+}
+
+// WatchStats streams the collected stats until the client cancels the call
+func (s *monitorServer) WatchStats(request *WatchStatsRequest, stream Monitor_WatchStatsServer) error {
+	selected := make(map[string]bool)
+	for _, probe := range request.Probes {
+		if !stats.IsProbeName(probe) {
+			return status.Errorf(codes.InvalidArgument, "Unknown probe %q", probe)
+		}
+		selected[probe] = true
+	}
+	interval := s.collector.Interval()
+	if requested := time.Duration(request.Interval) * time.Second; requested > interval {
+		interval = requested
+	}
+
+	// Only the latest snapshot is kept when the client is slower than the collector
+	snapshots := make(chan collector.Snapshot, 1)
+	unsubscribe := s.collector.Subscribe(func(snapshot collector.Snapshot) {
+		select {
+		case <-snapshots:
+		default:
+		}
+		select {
+		case snapshots <- snapshot:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	var lastSent time.Time
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.done:
+			return nil
+		case snapshot := <-snapshots:
+			if snapshot.Time.Sub(lastSent) < interval-time.Second {
+				continue
+			}
+			lastSent = snapshot.Time
+			if err := stream.Send(ToProto(filterProbes(snapshot.Stats, selected), snapshot.Time)); err != nil {
+				return err
+			}
+		}
+	}
+}
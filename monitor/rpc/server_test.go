@@ -0,0 +1,201 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+func testCollect(config utils.ProbesConfig) stats.FullStats {
+	fullStats := stats.FullStats{}
+	if config.RAMUsage {
+		fullStats.RAMUsage = probes.RAMStats{Available: 16316868, Used: 5157872, Free: 7319832, Shared: 662180}
+	}
+	if config.DiskUsage {
+		fullStats.DiskUsage = []probes.DeviceStat{{Filesystem: "/dev/sda1", MountPoint: "/", Size: 41, Used: 34, SizeBytes: 43806814208, UsedBytes: 36507222016}}
+	}
+	if config.Uptime {
+		fullStats.Uptime = 3600
+	}
+	if config.CPUUsage {
+		usage := 12.5
+		fullStats.CPUUsage = &usage
+	}
+	if config.Processes.Enabled {
+		nginx := probes.ProcessStat{PID: 812, User: "www-data", Command: "nginx: worker process", State: "S", Threads: 1, CPU: 3.2, RSS: 10240, OpenFiles: 12}
+		fullStats.Processes = &probes.ProcessesStats{Count: 1, ByCPU: []probes.ProcessStat{nginx}, ByMemory: []probes.ProcessStat{nginx}, ByOpenFiles: []probes.ProcessStat{nginx}}
+	}
+	return fullStats
+}
+
+func startTestServer(t *testing.T, config utils.ProbesConfig, statsCollector *collector.Collector) (MonitorClient, func()) {
+	client, server := startTestServerWith(t, config, statsCollector)
+	return client, server.Stop
+}
+
+func startTestServerWith(t *testing.T, config utils.ProbesConfig, statsCollector *collector.Collector) (MonitorClient, *Server) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := NewServer(config, statsCollector)
+	server.monitor.latest = func() (collector.Snapshot, bool) {
+		return collector.Snapshot{Time: time.Now(), Stats: testCollect(config)}, true
+	}
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Impossible to connect: %q", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewMonitorClient(conn), server
+}
+
+// Test the unary calls
+func TestGetStats(t *testing.T) {
+	config := utils.ProbesConfig{RAMUsage: true, DiskUsage: true}
+	client, cleanup := startTestServer(t, config, collector.New(config))
+	defer cleanup()
+
+	fullStats, err := client.GetStats(context.Background(), &GetStatsRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if fullStats.RamUsage.Used != 5157872 || len(fullStats.DiskUsage) != 1 || fullStats.DiskUsage[0].Mountpoint != "/" {
+		t.Fatalf("Invalid stats %v", fullStats)
+	}
+
+	ram, err := client.GetRAMUsage(context.Background(), &GetRAMUsageRequest{})
+	if err != nil || ram.Available != 16316868 {
+		t.Fatalf("Invalid RAM stats %v (%v)", ram, err)
+	}
+
+	_, err = client.GetUptime(context.Background(), &GetUptimeRequest{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expecting the disabled probe to fail, got %v", err)
+	}
+}
+
+// Test that the calls fail before the first collection and follow the configuration changes
+func TestGetStatsLatest(t *testing.T) {
+	config := utils.ProbesConfig{RAMUsage: true}
+	client, server := startTestServerWith(t, config, collector.New(config))
+	defer server.Stop()
+
+	server.monitor.latest = func() (collector.Snapshot, bool) { return collector.Snapshot{}, false }
+	if _, err := client.GetStats(context.Background(), &GetStatsRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expecting the stats to be unavailable, got %v", err)
+	}
+
+	server.monitor.latest = func() (collector.Snapshot, bool) {
+		return collector.Snapshot{Time: time.Now(), Stats: stats.FullStats{Uptime: 60}}, true
+	}
+	if _, err := client.GetUptime(context.Background(), &GetUptimeRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expecting the disabled probe to fail, got %v", err)
+	}
+	server.Reconfigure(utils.ProbesConfig{Uptime: true})
+	if uptime, err := client.GetUptime(context.Background(), &GetUptimeRequest{}); err != nil || uptime.Seconds != 60 {
+		t.Fatalf("Invalid uptime %v (%v)", uptime, err)
+	}
+}
+
+// Test streaming the collected stats
+func TestWatchStats(t *testing.T) {
+	config := utils.ProbesConfig{RAMUsage: true, Uptime: true, Interval: 1}
+	statsCollector := collector.New(config)
+	client, cleanup := startTestServer(t, config, statsCollector)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchStats(ctx, &WatchStatsRequest{Probes: []string{"uptime"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	// The subscription is registered asynchronously, collect until a message arrives
+	received := make(chan *FullStats)
+	go func() {
+		message, err := stream.Recv()
+		if err == nil {
+			received <- message
+		}
+	}()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-received:
+			if message.Uptime == 0 || message.RamUsage.Used != 0 {
+				t.Fatalf("Invalid stats %v", message)
+			}
+			return
+		case <-ticker.C:
+			statsCollector.Collect()
+		case <-ctx.Done():
+			t.Fatal("No stats received")
+		}
+	}
+}
+
+// Test that unknown probes are rejected
+func TestWatchStatsUnknownProbe(t *testing.T) {
+	config := utils.ProbesConfig{RAMUsage: true}
+	client, cleanup := startTestServer(t, config, collector.New(config))
+	defer cleanup()
+
+	stream, _ := client.WatchStats(context.Background(), &WatchStatsRequest{Probes: []string{"cpu"}})
+	if _, err := stream.Recv(); err == io.EOF || status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expecting an invalid argument error, got %v", err)
+	}
+}
+
+// Test the probes added to the protobuf messages after the first ones
+func TestGetStatsProcesses(t *testing.T) {
+	config := utils.ProbesConfig{DiskUsage: true, CPUUsage: true, Processes: utils.ProcessesConfig{Enabled: true}}
+	client, cleanup := startTestServer(t, config, collector.New(config))
+	defer cleanup()
+
+	fullStats, err := client.GetStats(context.Background(), &GetStatsRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if fullStats.GetCpuUsage() != 12.5 || fullStats.Processes.GetCount() != 1 || fullStats.DiskUsage[0].UsedBytes != 36507222016 {
+		t.Fatalf("Invalid stats %v", fullStats)
+	}
+
+	usage, err := client.GetCPUUsage(context.Background(), &GetCPUUsageRequest{})
+	if err != nil || usage.Percent != 12.5 {
+		t.Fatalf("Invalid CPU usage %v (%v)", usage, err)
+	}
+	processes, err := client.GetProcesses(context.Background(), &GetProcessesRequest{})
+	if err != nil || len(processes.ByCpu) != 1 {
+		t.Fatalf("Invalid processes %v (%v)", processes, err)
+	}
+	if nginx := processes.ByCpu[0]; nginx.Pid != 812 || nginx.User != "www-data" || nginx.CpuPercent != 3.2 || nginx.Rss != 10240 || nginx.OpenFiles != 12 {
+		t.Fatalf("Invalid process %v", nginx)
+	}
+}
+
+// Test that the streams keep the selected probes only
+func TestFilterProbes(t *testing.T) {
+	fullStats := testCollect(utils.ProbesConfig{RAMUsage: true, CPUUsage: true, Processes: utils.ProcessesConfig{Enabled: true}})
+	filtered := ToProto(filterProbes(fullStats, map[string]bool{"processes": true}), time.Now())
+	if filtered.Processes.GetCount() != 1 || filtered.CpuUsage != nil || filtered.RamUsage.Used != 0 {
+		t.Fatalf("Invalid stats %v", filtered)
+	}
+	filtered = ToProto(filterProbes(fullStats, map[string]bool{"cpu-usage": true}), time.Now())
+	if filtered.GetCpuUsage() != 12.5 || filtered.Processes != nil {
+		t.Fatalf("Invalid stats %v", filtered)
+	}
+}
@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Alert is a condition detected in the stats, such as a disk about to be full
+type Alert struct {
+	Name    string `json:"name"`
+	Target  string `json:"target"`
+	Message string `json:"message"`
+	// Since is the time the alert started firing, as a Unix timestamp
+	Since int64 `json:"since,omitempty"`
+}
+
+// Key identifies the alert between two collections
+func (a Alert) Key() string {
+	return a.Name + "/" + a.Target
+}
+
+// Alert states sent in the alert events
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertEvent is an alert starting to fire or being resolved
+type AlertEvent struct {
+	Alert
+	State string `json:"state"`
+}
+
+// Alerts lists the conditions detected in the stats, their start time being left empty
+func (s FullStats) Alerts() []Alert {
+	alerts := []Alert{}
+	for _, device := range s.DiskUsage {
+		if device.Forecast == nil || !device.Forecast.FullSoon {
+			continue
+		}
+		message := fmt.Sprintf("%s is expected to be full", device.MountPoint)
+		if device.Forecast.TimeToFull != nil {
+			message += " in " + (time.Duration(*device.Forecast.TimeToFull) * time.Second).Round(time.Minute).String()
+		}
+		alerts = append(alerts, Alert{Name: "disk-full-soon", Target: device.MountPoint, Message: message})
+	}
+	return alerts
+}
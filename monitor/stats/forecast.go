@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// DiskUsedSeries returns the name of the history series holding the usage of a device, in bytes
+func DiskUsedSeries(device probes.DeviceStat) string {
+	sample := Sample{
+		Probe: "disk-usage",
+		Field: "used-bytes",
+		Tags:  map[string]string{"filesystem": device.Filesystem, "mountpoint": device.MountPoint},
+	}
+	return sample.Series()
+}
+
+// AddDiskForecasts computes the disk-full forecast of every device from its usage history
+func (s *FullStats) AddDiskForecasts(store history.Store, config utils.DiskForecastConfig, now time.Time) {
+	window := time.Duration(config.WindowHours) * time.Hour
+	alertWithin := time.Duration(config.AlertWithinHours) * time.Hour
+
+	for i := range s.DiskUsage {
+		device := &s.DiskUsage[i]
+		points, err := store.Query(DiskUsedSeries(*device), now.Add(-window), now)
+		if err != nil {
+			log.Errorf("Error reading disk usage history: %q", err)
+			continue
+		}
+
+		samples := make([]probes.UsageSample, 0, len(points))
+		for _, point := range points {
+			samples = append(samples, probes.UsageSample{Timestamp: point.Timestamp, Used: point.Value})
+		}
+		forecast, err := probes.ForecastDiskUsage(*device, samples, now)
+		if err != nil {
+			log.Debugf("No forecast for %q: %q", device.MountPoint, err)
+			continue
+		}
+		forecast.FullSoon = forecast.FullWithin(alertWithin)
+		device.Forecast = &forecast
+	}
+}
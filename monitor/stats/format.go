@@ -0,0 +1,194 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Formats lists the formats the stats can be printed in
+var Formats = []string{"json", "table", "yaml"}
+
+// EnabledProbes lists the names of the probes enabled by a configuration
+func EnabledProbes(config utils.ProbesConfig) []string {
+	names := []string{}
+	if config.DiskUsage {
+		names = append(names, "disk-usage")
+	}
+	if config.RAMUsage {
+		names = append(names, "ram-usage")
+	}
+	if config.SystemInfo {
+		names = append(names, "system-info")
+	}
+	if len(config.SystemdServices) > 0 {
+		names = append(names, "services-status")
+	}
+	if config.Uptime {
+		names = append(names, "uptime")
+	}
+	if config.CPUUsage {
+		names = append(names, "cpu-usage")
+	}
+	if config.Processes.Enabled {
+		names = append(names, "processes")
+	}
+	return names
+}
+
+// SelectProbes enables the given probes only, the services being the configured ones
+func SelectProbes(config utils.ProbesConfig, names []string) (utils.ProbesConfig, error) {
+	selected := config
+	selected.DiskUsage, selected.RAMUsage, selected.SystemInfo, selected.Uptime = false, false, false, false
+	selected.CPUUsage = false
+	selected.Processes.Enabled = false
+	selected.SystemdServices = nil
+	for _, name := range names {
+		switch name {
+		case "disk-usage":
+			selected.DiskUsage = true
+		case "ram-usage":
+			selected.RAMUsage = true
+		case "system-info":
+			selected.SystemInfo = true
+		case "services-status":
+			if len(config.SystemdServices) == 0 {
+				return utils.ProbesConfig{}, fmt.Errorf("No systemd services configured")
+			}
+			selected.SystemdServices = config.SystemdServices
+		case "uptime":
+			selected.Uptime = true
+		case "cpu-usage":
+			selected.CPUUsage = true
+		case "processes":
+			selected.Processes.Enabled = true
+		default:
+			return utils.ProbesConfig{}, fmt.Errorf("Unknown probe %q, expecting one of %q", name, ProbeNames)
+		}
+	}
+	return selected, nil
+}
+
+// Format prints the results of the given probes as json, yaml or as a table
+func (s FullStats) Format(names []string, format string) ([]byte, error) {
+	if format == "table" {
+		return s.table(names), nil
+	}
+
+	all, err := s.Probes()
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage)
+	for _, name := range names {
+		if raw, ok := all[name]; ok {
+			selected[name] = raw
+		} else {
+			selected[name] = json.RawMessage("null")
+		}
+	}
+
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(selected, "", "  ")
+		return append(b, '\n'), err
+	case "yaml":
+		// JSON being valid YAML, the integers are kept as such
+		b, err := json.Marshal(selected)
+		if err != nil {
+			return nil, err
+		}
+		var document interface{}
+		if err := yaml.Unmarshal(b, &document); err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(document)
+	}
+	return nil, fmt.Errorf("Unknown format %q, expecting one of %q", format, Formats)
+}
+
+// table prints the results of the given probes as human-readable sections
+func (s FullStats) table(names []string) []byte {
+	var buffer bytes.Buffer
+	w := tabwriter.NewWriter(&buffer, 0, 4, 2, ' ', 0)
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		switch name {
+		case "disk-usage":
+			fmt.Fprintln(w, "Disk usage")
+			for _, device := range s.DiskUsage {
+				fmt.Fprintf(w, "  %s\n", device.ToString())
+			}
+		case "ram-usage":
+			fmt.Fprintln(w, "RAM usage")
+			fmt.Fprintf(w, "  Available\t%d kB\n", s.RAMUsage.Available)
+			fmt.Fprintf(w, "  Used\t%d kB\n", s.RAMUsage.Used)
+			fmt.Fprintf(w, "  Free\t%d kB\n", s.RAMUsage.Free)
+			fmt.Fprintf(w, "  Shared\t%d kB\n", s.RAMUsage.Shared)
+		case "system-info":
+			fmt.Fprintln(w, "System info")
+			fmt.Fprintf(w, "  Name\t%s\n", strings.TrimSpace(s.SystemInfo.Name))
+			fmt.Fprintf(w, "  Operating system\t%s\n", strings.TrimSpace(s.SystemInfo.OperatingSystem))
+			fmt.Fprintf(w, "  Distribution\t%s\n", strings.TrimSpace(s.SystemInfo.Distro))
+			fmt.Fprintf(w, "  Kernel\t%s\n", strings.TrimSpace(s.SystemInfo.Kernel))
+			fmt.Fprintf(w, "  Machine\t%s\n", strings.TrimSpace(s.SystemInfo.Machine))
+		case "services-status":
+			fmt.Fprintln(w, "Services")
+			services := make([]string, 0, len(s.Services))
+			for service := range s.Services {
+				services = append(services, service)
+			}
+			sort.Strings(services)
+			for _, service := range services {
+				state := "inactive"
+				if s.Services[service] {
+					state = "active"
+				}
+				fmt.Fprintf(w, "  %s\t%s\n", service, state)
+			}
+		case "uptime":
+			fmt.Fprintln(w, "Uptime")
+			fmt.Fprintf(w, "  %s\n", time.Duration(s.Uptime)*time.Second)
+		case "cpu-usage":
+			fmt.Fprintln(w, "CPU usage")
+			if s.CPUUsage != nil {
+				fmt.Fprintf(w, "  %.1f%%\n", *s.CPUUsage)
+			}
+		case "processes":
+			if s.Processes == nil {
+				fmt.Fprintln(w, "Processes")
+				continue
+			}
+			for j, section := range []struct {
+				title     string
+				processes []probes.ProcessStat
+			}{
+				{"Top processes by CPU", s.Processes.ByCPU},
+				{"Top processes by memory", s.Processes.ByMemory},
+				{"Top processes by open files", s.Processes.ByOpenFiles},
+			} {
+				if j > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintf(w, "%s (%d processes)\n", section.title, s.Processes.Count)
+				fmt.Fprintln(w, "  PID\tUSER\tSTATE\tTHREADS\tCPU%\tRSS\tFILES\tCOMMAND")
+				for _, p := range section.processes {
+					fmt.Fprintf(w, "  %d\t%s\t%s\t%d\t%.1f\t%d kB\t%d\t%s\n", p.PID, p.User, p.State, p.Threads, p.CPU, p.RSS, p.OpenFiles, p.Command)
+				}
+			}
+		}
+	}
+	w.Flush()
+	return buffer.Bytes()
+}
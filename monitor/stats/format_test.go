@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the selection of the probes to run
+func TestSelectProbes(t *testing.T) {
+	config := utils.ProbesConfig{DiskUsage: true, Uptime: true, Interval: 10}
+	selected, err := SelectProbes(config, []string{"ram-usage"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if selected.DiskUsage || selected.Uptime || !selected.RAMUsage || selected.Interval != 10 {
+		t.Fatalf("Invalid selection %+v", selected)
+	}
+	if _, err := SelectProbes(config, []string{"services-status"}); err == nil {
+		t.Fatal("Expecting an error without configured services")
+	}
+	if _, err := SelectProbes(config, []string{"cpu"}); err == nil {
+		t.Fatal("Expecting an error for an unknown probe")
+	}
+}
+
+// Test the output formats of the stats
+func TestFormat(t *testing.T) {
+	s := FullStats{
+		DiskUsage: []probes.DeviceStat{{Filesystem: "/dev/sda1", MountPoint: "/", Size: 42, Used: 13}},
+		Services:  map[string]bool{"sshd": true, "nginx": false},
+		Uptime:    3700,
+	}
+	names := []string{"disk-usage", "services-status", "uptime"}
+
+	table, err := s.Format(names, "table")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	expected := "Disk usage\n  Device /dev/sda1 - mountpoint /  Total size 42GB - Used 13GB\n\n" +
+		"Services\n  nginx  inactive\n  sshd   active\n\n" +
+		"Uptime\n  1h1m40s\n"
+	if string(table) != expected {
+		t.Fatalf("Invalid table %q", table)
+	}
+
+	document, err := s.Format([]string{"uptime"}, "json")
+	if err != nil || string(document) != "{\n  \"uptime\": 3700\n}\n" {
+		t.Fatalf("Invalid JSON %q (%v)", document, err)
+	}
+	document, err = s.Format([]string{"uptime"}, "yaml")
+	if err != nil || string(document) != "uptime: 3700\n" {
+		t.Fatalf("Invalid YAML %q (%v)", document, err)
+	}
+	if _, err := s.Format(names, "xml"); err == nil {
+		t.Fatal("Expecting an error for an unknown format")
+	}
+}
+
+// Test the table of the top processes
+func TestFormatProcesses(t *testing.T) {
+	top := []probes.ProcessStat{{PID: 300, User: "www-data", Command: "nginx: worker", State: "S", Threads: 3, CPU: 2.5, RSS: 5000, OpenFiles: 20}}
+	s := FullStats{Processes: &probes.ProcessesStats{Count: 12, ByCPU: top, ByMemory: top}}
+	table, err := s.Format([]string{"processes"}, "table")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	expected := "Top processes by CPU (12 processes)\n" +
+		"  PID  USER      STATE  THREADS  CPU%  RSS      FILES  COMMAND\n" +
+		"  300  www-data  S      3        2.5   5000 kB  20     nginx: worker\n\n" +
+		"Top processes by memory (12 processes)\n" +
+		"  PID  USER      STATE  THREADS  CPU%  RSS      FILES  COMMAND\n" +
+		"  300  www-data  S      3        2.5   5000 kB  20     nginx: worker\n\n" +
+		"Top processes by open files (12 processes)\n" +
+		"  PID  USER  STATE  THREADS  CPU%  RSS  FILES  COMMAND\n"
+	if string(table) != expected {
+		t.Fatalf("Invalid table %q", table)
+	}
+}
+
+// Test printing the CPU usage as a table and as JSON
+func TestFormatCPUUsage(t *testing.T) {
+	usage := 12.5
+	s := FullStats{CPUUsage: &usage}
+	if table, err := s.Format([]string{"cpu-usage"}, "table"); err != nil || string(table) != "CPU usage\n  12.5%\n" {
+		t.Fatalf("Invalid table %q", table)
+	}
+	if output, err := s.Format([]string{"cpu-usage"}, "json"); err != nil || string(output) != "{\n  \"cpu-usage\": 12.5\n}\n" {
+		t.Fatalf("Invalid JSON %q", output)
+	}
+}
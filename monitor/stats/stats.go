@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// FullStats represent the complete stats returned to the user
+type FullStats struct {
+	DiskUsage  []probes.DeviceStat `json:"disk-usage,omitempty"`
+	RAMUsage   probes.RAMStats     `json:"ram-usage,omitempty"`
+	SystemInfo probes.SystemInfo   `json:"system-info,omitempty"`
+	Services   map[string]bool     `json:"services-status,omitempty"`
+	Uptime     int64               `json:"uptime,omitempty"`
+	// CPUUsage is the percentage of time the CPUs were busy since the previous collection
+	CPUUsage  *float64               `json:"cpu-usage,omitempty"`
+	Processes *probes.ProcessesStats `json:"processes,omitempty"`
+}
+
+// ProbeNames lists the names of the probes as they appear in the stats
+var ProbeNames = []string{"disk-usage", "ram-usage", "system-info", "services-status", "uptime", "cpu-usage", "processes"}
+
+// IsProbeName returns True if the name is the one of a probe
+func IsProbeName(name string) bool {
+	for _, probe := range ProbeNames {
+		if probe == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Sample is a single numeric value extracted from the stats
+type Sample struct {
+	Probe string
+	Field string
+	Tags  map[string]string
+	Value float64
+}
+
+// Series returns the unique name of the series the sample belongs to
+func (s Sample) Series() string {
+	if len(s.Tags) == 0 {
+		return s.Probe + "." + s.Field
+	}
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, k+"="+s.Tags[k])
+	}
+	return s.Probe + "." + s.Field + "{" + strings.Join(tags, ",") + "}"
+}
+
+// Probes splits the stats into one JSON document per probe
+func (s FullStats) Probes() (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	probes := make(map[string]json.RawMessage)
+	err = json.Unmarshal(b, &probes)
+	return probes, err
+}
+
+// Sampler runs the probes measuring a usage between two collections, keeping
+// their previous readings
+type Sampler struct {
+	processes *probes.ProcessSampler
+
+	mu          sync.Mutex
+	previousCPU probes.CPUTimes
+}
+
+// NewSampler creates a sampler, the first collection giving the usages since boot
+// or since the start of the processes
+func NewSampler() *Sampler {
+	return &Sampler{processes: probes.NewProcessSampler("/proc")}
+}
+
+// Collect runs the enabled probes once, the usages being averaged since boot
+func Collect(config utils.ProbesConfig) FullStats {
+	return NewSampler().Collect(config)
+}
+
+// Collect runs the enabled probes and returns their results
+func (s *Sampler) Collect(config utils.ProbesConfig) FullStats {
+	fullStats := FullStats{}
+
+	if len(config.SystemdServices) > 0 {
+		fullStats.Services = probes.GetServicesStatuses(probes.LinuxCommandRunner{}, config.SystemdServices)
+	}
+
+	if config.RAMUsage {
+		fullStats.RAMUsage = probes.GetRAMUsage(probes.LinuxCommandRunner{})
+	}
+
+	if config.DiskUsage {
+		fullStats.DiskUsage = probes.GetUsageStats(probes.LinuxCommandRunner{})
+	}
+
+	if config.SystemInfo {
+		fullStats.SystemInfo = probes.GetSystemInfo(probes.LinuxCommandRunner{})
+	}
+
+	if config.Uptime {
+		uptime, err := probes.GetUptime()
+		if err == nil {
+			fullStats.Uptime = uptime
+		}
+	}
+
+	if config.CPUUsage {
+		times, err := probes.GetCPUTimes()
+		if err == nil {
+			s.mu.Lock()
+			usage := math.Round(probes.CPUUsage(s.previousCPU, times)*10) / 10
+			s.previousCPU = times
+			s.mu.Unlock()
+			fullStats.CPUUsage = &usage
+		}
+	}
+
+	if config.Processes.Enabled {
+		options := probes.ProcessOptions{Top: config.Processes.Top, Names: config.Processes.Names}
+		processes, err := probes.GetTopProcesses(s.processes, options)
+		if err == nil {
+			fullStats.Processes = &processes
+		}
+	}
+	return fullStats
+}
+
+// Samples flattens the numeric values of the stats into samples
+func (s FullStats) Samples() []Sample {
+	samples := []Sample{}
+
+	for _, device := range s.DiskUsage {
+		tags := map[string]string{"filesystem": device.Filesystem, "mountpoint": device.MountPoint}
+		samples = append(samples,
+			Sample{Probe: "disk-usage", Field: "size", Tags: tags, Value: float64(device.Size)},
+			Sample{Probe: "disk-usage", Field: "used", Tags: tags, Value: float64(device.Used)},
+		)
+	}
+
+	if s.RAMUsage != (probes.RAMStats{}) {
+		samples = append(samples,
+			Sample{Probe: "ram-usage", Field: "available", Value: float64(s.RAMUsage.Available)},
+			Sample{Probe: "ram-usage", Field: "used", Value: float64(s.RAMUsage.Used)},
+			Sample{Probe: "ram-usage", Field: "free", Value: float64(s.RAMUsage.Free)},
+			Sample{Probe: "ram-usage", Field: "shared", Value: float64(s.RAMUsage.Shared)},
+		)
+	}
+
+	services := make([]string, 0, len(s.Services))
+	for service := range s.Services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		value := 0.0
+		if s.Services[service] {
+			value = 1
+		}
+		samples = append(samples, Sample{Probe: "services-status", Field: "active", Tags: map[string]string{"service": service}, Value: value})
+	}
+
+	if s.Uptime != 0 {
+		samples = append(samples, Sample{Probe: "uptime", Field: "seconds", Value: float64(s.Uptime)})
+	}
+
+	if s.CPUUsage != nil {
+		samples = append(samples, Sample{Probe: "cpu-usage", Field: "percent", Value: *s.CPUUsage})
+	}
+	return samples
+}
+
+// HistorySamples returns the samples recorded in the history, the disk usage being
+// kept in bytes as well for the forecasts
+func (s FullStats) HistorySamples() []Sample {
+	samples := s.Samples()
+	for _, device := range s.DiskUsage {
+		tags := map[string]string{"filesystem": device.Filesystem, "mountpoint": device.MountPoint}
+		samples = append(samples,
+			Sample{Probe: "disk-usage", Field: "size-bytes", Tags: tags, Value: float64(device.SizeBytes)},
+			Sample{Probe: "disk-usage", Field: "used-bytes", Tags: tags, Value: float64(device.UsedBytes)},
+		)
+	}
+	return samples
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aHugues/system-monitor/monitor/stats"
+)
+
+// runStats runs the probes once and prints their results
+func runStats(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	probeNames := flags.String("probe", "", fmt.Sprintf("Comma-separated probes to run, among %q, the configured ones by default", stats.ProbeNames))
+	format := flags.String("format", "table", fmt.Sprintf("Output format, among %q", stats.Formats))
+	options := newConfigOptions(flags)
+	flags.Parse(args)
+
+	useStderrLogger()
+	config, _, err := options.load()
+	if err != nil {
+		for _, message := range configErrors(err) {
+			fmt.Fprintln(os.Stderr, message)
+		}
+		return 1
+	}
+
+	names := stats.EnabledProbes(config.Probes)
+	if *probeNames != "" {
+		names = strings.Split(*probeNames, ",")
+	}
+	probes, err := stats.SelectProbes(config.Probes, names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	output, err := stats.Collect(probes).Format(names, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(output)
+	return 0
+}
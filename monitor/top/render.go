@@ -0,0 +1,333 @@
+package top
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/checks"
+)
+
+// Key is an action requested from the keyboard
+type Key int
+
+// Keys handled by the interface
+const (
+	KeyNone Key = iota
+	KeyQuit
+	KeyNext
+	KeyPrevious
+	KeyUp
+	KeyDown
+	KeyRefresh
+)
+
+// ParseKeys converts the bytes read from a terminal in raw mode to keys
+func ParseKeys(input []byte) []Key {
+	keys := []Key{}
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case 'q', 'Q', 3:
+			keys = append(keys, KeyQuit)
+		case '\t', 'l':
+			keys = append(keys, KeyNext)
+		case 'h':
+			keys = append(keys, KeyPrevious)
+		case 'k':
+			keys = append(keys, KeyUp)
+		case 'j':
+			keys = append(keys, KeyDown)
+		case 'r':
+			keys = append(keys, KeyRefresh)
+		case 27:
+			// Arrow keys are sent as ESC [ A to D, shift+tab as ESC [ Z
+			if i+2 < len(input) && input[i+1] == '[' {
+				switch input[i+2] {
+				case 'A':
+					keys = append(keys, KeyUp)
+				case 'B':
+					keys = append(keys, KeyDown)
+				case 'C':
+					keys = append(keys, KeyNext)
+				case 'D', 'Z':
+					keys = append(keys, KeyPrevious)
+				}
+				i += 2
+			} else if i+1 == len(input) {
+				keys = append(keys, KeyQuit)
+			}
+		}
+	}
+	return keys
+}
+
+// ANSI escape sequences used for the display
+const (
+	reset   = "\x1b[0m"
+	reverse = "\x1b[7m"
+	bold    = "\x1b[1m"
+	red     = "\x1b[31m"
+	green   = "\x1b[32m"
+	yellow  = "\x1b[33m"
+)
+
+// stateColors are the colors of the check states
+var stateColors = map[checks.State]string{
+	checks.OK:       green,
+	checks.Warning:  yellow,
+	checks.Critical: red,
+}
+
+// colored wraps a text in a color
+func colored(text string, color string) string {
+	if color == "" {
+		return text
+	}
+	return color + text + reset
+}
+
+// bar draws a percentage as a gauge of the given width
+func bar(percent float64, width int) string {
+	filled := int(percent*float64(width)/100 + 0.5)
+	if filled > width {
+		filled = width
+	}
+	if filled < 0 {
+		filled = 0
+	}
+	return strings.Repeat("|", filled) + strings.Repeat(" ", width-filled)
+}
+
+// humanRate formats a rate in bytes per second
+func humanRate(rate float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	unit := 0
+	for rate >= 1024 && unit < len(units)-1 {
+		rate /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", rate, units[unit])
+}
+
+// fit truncates or pads a line to the width of the terminal, ignoring the
+// escape sequences
+func fit(line string, width int) string {
+	var builder strings.Builder
+	visible := 0
+	escape := false
+	for _, r := range line {
+		switch {
+		case escape:
+			builder.WriteRune(r)
+			escape = r != 'm'
+		case r == '\x1b':
+			builder.WriteRune(r)
+			escape = true
+		case visible < width:
+			builder.WriteRune(r)
+			visible++
+		}
+	}
+	if visible < width {
+		builder.WriteString(strings.Repeat(" ", width-visible))
+	}
+	if strings.Contains(line, "\x1b") {
+		builder.WriteString(reset)
+	}
+	return builder.String()
+}
+
+// panelNames lists the scrollable panels in navigation order
+var panelNames = []string{"Disks", "Services", "Network", "Processes"}
+
+// Model holds the state of the interface
+type Model struct {
+	source  string
+	disk    checks.Thresholds
+	ram     checks.Thresholds
+	focus   int
+	offsets map[string]int
+
+	snapshot Snapshot
+	received bool
+	err      error
+}
+
+// NewModel creates the state of the interface, the usages being colored according
+// to the disk and RAM thresholds
+func NewModel(source string, disk checks.Thresholds, ram checks.Thresholds) *Model {
+	return &Model{source: source, disk: disk, ram: ram, offsets: make(map[string]int)}
+}
+
+// Update replaces the displayed values, the previous ones being kept on error
+func (m *Model) Update(snapshot Snapshot, err error) {
+	m.err = err
+	if err == nil {
+		m.snapshot, m.received = snapshot, true
+	}
+}
+
+// HandleKey applies a key, returning false when the interface must be closed
+func (m *Model) HandleKey(key Key) bool {
+	name := panelNames[m.focus]
+	switch key {
+	case KeyQuit:
+		return false
+	case KeyNext:
+		m.focus = (m.focus + 1) % len(panelNames)
+	case KeyPrevious:
+		m.focus = (m.focus + len(panelNames) - 1) % len(panelNames)
+	case KeyUp:
+		if m.offsets[name] > 0 {
+			m.offsets[name]--
+		}
+	case KeyDown:
+		m.offsets[name]++
+	}
+	return true
+}
+
+// panelLines returns the lines of a panel
+func (m *Model) panelLines(name string, width int) []string {
+	s := m.snapshot
+	lines := []string{}
+	switch name {
+	case "Disks":
+		for _, device := range s.Stats.DiskUsage {
+			// The percentage is computed in bytes, the sizes in GB being rounded
+			if device.SizeBytes == 0 {
+				continue
+			}
+			used := float64(device.UsedBytes) * 100 / float64(device.SizeBytes)
+			gauge := colored(bar(used, width), stateColors[m.disk.State(used)])
+			lines = append(lines, fmt.Sprintf("  %-16s [%s] %5.1f%%  %dGB / %dGB", device.MountPoint, gauge, used, device.Used, device.Size))
+		}
+	case "Services":
+		services := make([]string, 0, len(s.Stats.Services))
+		for service := range s.Stats.Services {
+			services = append(services, service)
+		}
+		sort.Strings(services)
+		for _, service := range services {
+			state := colored("inactive", red)
+			if s.Stats.Services[service] {
+				state = colored("active", green)
+			}
+			lines = append(lines, fmt.Sprintf("  %-24s %s", service, state))
+		}
+	case "Network":
+		if !s.HasNetwork {
+			return []string{"  Not reported by " + m.source}
+		}
+		for _, rate := range s.Network {
+			lines = append(lines, fmt.Sprintf("  %-16s rx %12s   tx %12s", rate.Name, humanRate(rate.Rx), humanRate(rate.Tx)))
+		}
+	case "Processes":
+		if s.Stats.Processes == nil {
+			return []string{"  Not reported by " + m.source}
+		}
+		for _, p := range s.Stats.Processes.ByCPU {
+			lines = append(lines, fmt.Sprintf("  %7d %-10s %s %5.1f%% %9d kB %5d fds  %s", p.PID, p.User, p.State, p.CPU, p.RSS, p.OpenFiles, p.Command))
+		}
+	}
+	return lines
+}
+
+// Render draws the interface for a terminal of the given size
+func (m *Model) Render(width int, height int) []string {
+	if height < 2 {
+		height = 2
+	}
+	s := m.snapshot
+	gaugeWidth := width - 40
+	if gaugeWidth > 50 {
+		gaugeWidth = 50
+	}
+	if gaugeWidth < 10 {
+		gaugeWidth = 10
+	}
+
+	title := []string{"system-monitor top", m.source}
+	if s.Stats.SystemInfo.Name != "" {
+		title = append(title, "host "+strings.TrimSpace(s.Stats.SystemInfo.Name))
+	}
+	if s.Stats.Uptime != 0 {
+		title = append(title, fmt.Sprintf("up %s", time.Duration(s.Stats.Uptime)*time.Second))
+	}
+	if m.received {
+		title = append(title, s.Time.Format("15:04:05"))
+	}
+	lines := []string{reverse + fit(" "+strings.Join(title, " | "), width)}
+
+	if !m.received && m.err == nil {
+		lines = append(lines, "Collecting...")
+	}
+	if m.err != nil {
+		lines = append(lines, colored("Error: "+m.err.Error(), red))
+	}
+
+	if s.HasCPU {
+		lines = append(lines, fmt.Sprintf("%sCPU%s [%s] %5.1f%%", bold, reset, colored(bar(s.CPU, gaugeWidth), green), s.CPU))
+	} else {
+		lines = append(lines, bold+"CPU"+reset+" n/a")
+	}
+	if ram := s.Stats.RAMUsage; ram.Available > 0 {
+		used := float64(ram.Used) * 100 / float64(ram.Available)
+		gauge := colored(bar(used, gaugeWidth), stateColors[m.ram.State(used)])
+		lines = append(lines, fmt.Sprintf("%sRAM%s [%s] %5.1f%%  %d / %d kB", bold, reset, gauge, used, ram.Used, ram.Available))
+	} else {
+		lines = append(lines, bold+"RAM"+reset+" n/a")
+	}
+
+	panelGauge := gaugeWidth - 10
+	if panelGauge < 5 {
+		panelGauge = 5
+	}
+
+	// The panels share the remaining lines, the footer excepted
+	available := height - len(lines) - 1
+	panelHeight := available / len(panelNames)
+	if panelHeight < 2 {
+		panelHeight = 2
+	}
+	for i, name := range panelNames {
+		items := m.panelLines(name, panelGauge)
+		visible := panelHeight - 1
+		maxOffset := len(items) - visible
+		if maxOffset < 0 {
+			maxOffset = 0
+		}
+		if m.offsets[name] > maxOffset {
+			m.offsets[name] = maxOffset
+		}
+		offset := m.offsets[name]
+
+		header := name
+		if len(items) > visible {
+			end := offset + visible
+			header = fmt.Sprintf("%s (%d-%d of %d)", name, offset+1, end, len(items))
+		}
+		if i == m.focus {
+			header = reverse + header + reset
+		} else {
+			header = bold + header + reset
+		}
+		lines = append(lines, header)
+		for j := offset; j < len(items) && j < offset+visible; j++ {
+			lines = append(lines, items[j])
+		}
+		for j := len(items) - offset; j < visible; j++ {
+			lines = append(lines, "")
+		}
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines[:height-1], reverse+fit(" q quit | tab/arrows switch panel | up/down scroll | r refresh", width))
+	for i := range lines {
+		lines[i] = fit(lines[i], width)
+	}
+	return lines
+}
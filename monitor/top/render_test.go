@@ -0,0 +1,116 @@
+package top
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aHugues/system-monitor/monitor/checks"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+var escapes = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+// plain removes the escape sequences and trailing spaces of the rendered lines
+func plain(lines []string) []string {
+	result := []string{}
+	for _, line := range lines {
+		result = append(result, strings.TrimRight(escapes.ReplaceAllString(line, ""), " "))
+	}
+	return result
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := ParseKeys([]byte("j\x1b[A\tq\x1b[Z"))
+	expected := []Key{KeyDown, KeyUp, KeyNext, KeyQuit, KeyPrevious}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Invalid keys %v", keys)
+	}
+}
+
+// Test the layout of the interface and the scrolling of the panels
+func TestRender(t *testing.T) {
+	thresholds, err := checks.NewThresholds(utils.ThresholdConfig{Warning: "80", Critical: "90"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := NewModel("local", thresholds, thresholds)
+	model.Update(Snapshot{
+		Stats: stats.FullStats{
+			DiskUsage: []probes.DeviceStat{
+				{MountPoint: "/boot", Size: 0, Used: 0, SizeBytes: 256 << 20, UsedBytes: 64 << 20},
+				{MountPoint: "/var", Size: 100, Used: 95, SizeBytes: 100 << 30, UsedBytes: 95 << 30},
+			},
+			RAMUsage:  probes.RAMStats{Available: 1000, Used: 250},
+			Services:  map[string]bool{"a": true, "b": false, "c": true, "d": true},
+			Processes: &probes.ProcessesStats{Count: 1, ByCPU: []probes.ProcessStat{{PID: 42, User: "root", Command: "nginx", State: "S", CPU: 7.5, RSS: 2048, OpenFiles: 12}}},
+		},
+		CPU:        12.5,
+		HasCPU:     true,
+		Network:    []NetworkRate{{Name: "eth0", Rx: 2048, Tx: 10}},
+		HasNetwork: true,
+	}, nil)
+
+	lines := plain(model.Render(60, 19))
+	if len(lines) != 19 {
+		t.Fatalf("Invalid height %d", len(lines))
+	}
+	if lines[1] != "CPU [|||                 ]  12.5%" || lines[2] != "RAM [|||||               ]  25.0%  250 / 1000 kB" {
+		t.Fatalf("Invalid gauges %q", lines[1:3])
+	}
+	if lines[3] != "Disks" || !strings.Contains(lines[4], "/boot") || !strings.Contains(lines[4], " 25.0%") || !strings.HasPrefix(strings.TrimSpace(lines[5]), "/var") {
+		t.Fatalf("Invalid disks %q", lines[3:6])
+	}
+	if !strings.HasPrefix(lines[6], "Services (1-2 of 4)") || strings.TrimSpace(lines[7]) != "a                        active" {
+		t.Fatalf("Invalid services %q", lines[6:9])
+	}
+	if strings.TrimSpace(lines[10]) != "eth0             rx    2.0 KiB/s   tx     10.0 B/s" {
+		t.Fatalf("Invalid network %q", lines[10])
+	}
+	if lines[12] != "Processes" || strings.TrimSpace(lines[13]) != "42 root       S   7.5%      2048 kB    12 fds  nginx" {
+		t.Fatalf("Invalid processes %q", lines[12:14])
+	}
+
+	// The offset of the focused panel is kept within its items
+	model.HandleKey(KeyNext)
+	for i := 0; i < 5; i++ {
+		model.HandleKey(KeyDown)
+	}
+	lines = plain(model.Render(60, 19))
+	if !strings.HasPrefix(lines[6], "Services (3-4 of 4)") || strings.TrimSpace(lines[7]) != "c                        active" {
+		t.Fatalf("Invalid scrolled services %q", lines[6:9])
+	}
+	if model.HandleKey(KeyQuit) {
+		t.Fatal("Expecting the interface to be closed")
+	}
+}
+
+// Test that the remote source reads the stats of an agent
+func TestRemoteSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/stats" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		usage := 25.0
+		json.NewEncoder(w).Encode(stats.FullStats{Uptime: 42, CPUUsage: &usage})
+	}))
+	defer server.Close()
+
+	snapshot, err := NewRemoteSource(server.URL+"/", "secret", server.Client()).Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if snapshot.Stats.Uptime != 42 || !snapshot.HasCPU || snapshot.CPU != 25 || snapshot.HasNetwork {
+		t.Fatalf("Invalid snapshot %+v", snapshot)
+	}
+	if _, err := NewRemoteSource(server.URL, "wrong", server.Client()).Snapshot(); err == nil {
+		t.Fatal("Expecting an error when unauthorized")
+	}
+}
@@ -0,0 +1,110 @@
+package top
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Terminal control sequences
+const (
+	alternateScreen = "\x1b[?1049h\x1b[?25l"
+	mainScreen      = "\x1b[?25h\x1b[?1049l"
+	home            = "\x1b[H"
+)
+
+// snapshotResult is a snapshot read in the background
+type snapshotResult struct {
+	snapshot Snapshot
+	err      error
+}
+
+// Run displays the interface full screen, refreshing the values of the source at
+// the given interval until the user quits
+func Run(source Source, model *Model, interval time.Duration) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	os.Stdout.WriteString(alternateScreen)
+	defer os.Stdout.WriteString(mainScreen)
+
+	keys := make(chan []Key)
+	go func() {
+		buffer := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buffer)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- ParseKeys(buffer[:n])
+		}
+	}()
+
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+
+	// The probes may be slow, so they run in the background without blocking the keys
+	snapshots := make(chan snapshotResult, 1)
+	refresh := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			snapshot, err := source.Snapshot()
+			select {
+			case snapshots <- snapshotResult{snapshot, err}:
+			case <-stop:
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-refresh:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	draw := func() {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		os.Stdout.WriteString(home + strings.Join(model.Render(width, height), "\r\n"))
+	}
+	draw()
+	for {
+		select {
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range pressed {
+				if !model.HandleKey(key) {
+					return nil
+				}
+				if key == KeyRefresh {
+					select {
+					case refresh <- struct{}{}:
+					default:
+					}
+				}
+			}
+		case result := <-snapshots:
+			model.Update(result.snapshot, result.err)
+		case <-resized:
+		}
+		draw()
+	}
+}
@@ -0,0 +1,139 @@
+package top
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// NetworkRate is the traffic of a network interface, in bytes per second
+type NetworkRate struct {
+	Name string
+	Rx   float64
+	Tx   float64
+}
+
+// Snapshot holds the values displayed at a refresh
+type Snapshot struct {
+	Time    time.Time
+	Stats   stats.FullStats
+	CPU     float64
+	HasCPU  bool
+	Network []NetworkRate
+	// HasNetwork is false when the source does not report the network traffic
+	HasNetwork bool
+}
+
+// Source provides the values displayed by the interface
+type Source interface {
+	// Name describes where the values come from
+	Name() string
+	// Snapshot reads the current values
+	Snapshot() (Snapshot, error)
+}
+
+// LocalSource runs the probes on the local host
+type LocalSource struct {
+	config  utils.ProbesConfig
+	sampler *stats.Sampler
+
+	previousTime    time.Time
+	previousNetwork map[string]probes.InterfaceCounters
+}
+
+// NewLocalSource creates a source running the configured probes
+func NewLocalSource(config utils.ProbesConfig) *LocalSource {
+	return &LocalSource{config: config, sampler: stats.NewSampler()}
+}
+
+// Name describes the local host
+func (s *LocalSource) Name() string {
+	return "local"
+}
+
+// Snapshot runs the probes, the CPU usage and network rates being computed
+// from the previous snapshot
+func (s *LocalSource) Snapshot() (Snapshot, error) {
+	now := time.Now()
+	snapshot := newSnapshot(now, s.sampler.Collect(s.config))
+	snapshot.HasNetwork = true
+
+	if counters, err := probes.GetNetworkCounters(); err == nil {
+		elapsed := now.Sub(s.previousTime).Seconds()
+		current := make(map[string]probes.InterfaceCounters)
+		for _, counter := range counters {
+			current[counter.Name] = counter
+			previous, ok := s.previousNetwork[counter.Name]
+			if counter.Name == "lo" || !ok || elapsed <= 0 || counter.RxBytes < previous.RxBytes || counter.TxBytes < previous.TxBytes {
+				continue
+			}
+			snapshot.Network = append(snapshot.Network, NetworkRate{
+				Name: counter.Name,
+				Rx:   float64(counter.RxBytes-previous.RxBytes) / elapsed,
+				Tx:   float64(counter.TxBytes-previous.TxBytes) / elapsed,
+			})
+		}
+		sort.Slice(snapshot.Network, func(i, j int) bool { return snapshot.Network[i].Name < snapshot.Network[j].Name })
+		s.previousNetwork = current
+	}
+	s.previousTime = now
+	return snapshot, nil
+}
+
+// newSnapshot builds the snapshot of the stats, with their CPU usage when reported
+func newSnapshot(now time.Time, fullStats stats.FullStats) Snapshot {
+	snapshot := Snapshot{Time: now, Stats: fullStats}
+	if fullStats.CPUUsage != nil {
+		snapshot.CPU, snapshot.HasCPU = *fullStats.CPUUsage, true
+	}
+	return snapshot
+}
+
+// RemoteSource reads the stats of a running agent from its API
+type RemoteSource struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewRemoteSource creates a source reading the stats of the agent at the given URL,
+// authenticated with a bearer token when not empty
+func NewRemoteSource(url string, token string, client *http.Client) *RemoteSource {
+	return &RemoteSource{url: strings.TrimRight(url, "/"), token: token, client: client}
+}
+
+// Name describes the remote agent
+func (s *RemoteSource) Name() string {
+	return s.url
+}
+
+// Snapshot reads the stats of the agent, which does not report the network usage
+func (s *RemoteSource) Snapshot() (Snapshot, error) {
+	request, err := http.NewRequest(http.MethodGet, s.url+"/api/stats", nil)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if s.token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Snapshot{}, fmt.Errorf("Unexpected status %q", response.Status)
+	}
+	var fullStats stats.FullStats
+	if err := json.NewDecoder(response.Body).Decode(&fullStats); err != nil {
+		return Snapshot{}, err
+	}
+	return newSnapshot(time.Now(), fullStats), nil
+}
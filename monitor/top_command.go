@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/aHugues/system-monitor/monitor/checks"
+	"github.com/aHugues/system-monitor/monitor/top"
+)
+
+// runTop displays the probes full screen, refreshed at an interval
+func runTop(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := flags.Duration("interval", time.Second, "Refresh interval")
+	remote := flags.String("remote", "", "URL of an agent to display, such as http://host:5000, the local host being displayed by default")
+	token := flags.String("token", "", "Bearer token sent to the remote agent")
+	insecure := flags.Bool("insecure", false, "Do not verify the certificate of the remote agent")
+	options := newConfigOptions(flags)
+	flags.Parse(args)
+
+	useStderrLogger()
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "monitor top requires a terminal")
+		return 1
+	}
+	config, _, err := options.load()
+	if err != nil {
+		for _, message := range configErrors(err) {
+			fmt.Fprintln(os.Stderr, message)
+		}
+		return 1
+	}
+	disk, err := checks.NewThresholds(config.Checks.Disk)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ram, err := checks.NewThresholds(config.Checks.RAM)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// The CPU usage and processes are always displayed locally, the configuration
+	// giving the number of processes and their filters
+	config.Probes.CPUUsage = true
+	config.Probes.Processes.Enabled = true
+	var source top.Source = top.NewLocalSource(config.Probes)
+	if *remote != "" {
+		client := &http.Client{Timeout: 5 * time.Second}
+		if *insecure {
+			client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		}
+		source = top.NewRemoteSource(*remote, *token, client)
+	}
+
+	if err := top.Run(source, top.NewModel(source.Name(), disk, ram), *interval); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
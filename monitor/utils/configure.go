@@ -1,18 +1,57 @@
 package utils
 
-import (
-	"encoding/json"
-	"io/ioutil"
-
-	log "github.com/cihub/seelog"
-)
-
 // ServerConfig handles the configuration for the web service
 type ServerConfig struct {
-	ListenMode string `json:"listen-mode"`
-	Host       string `json:"host"`
-	Port       int    `json:"port"`
-	Socket     string `json:"socket"`
+	ListenMode      string       `json:"listen-mode"`
+	Host            string       `json:"host"`
+	Port            int          `json:"port"`
+	Socket          string       `json:"socket"`
+	GRPCPort        int          `json:"grpc-port"`
+	Dashboard       bool         `json:"dashboard"`
+	ShutdownTimeout int          `json:"shutdown-timeout"`
+	WatchConfig     bool         `json:"watch-config"`
+	TLS             TLSConfig    `json:"tls"`
+	Auth            AuthConfig   `json:"auth"`
+	Access          AccessConfig `json:"access"`
+}
+
+// AccessConfig handles the network restrictions of the API
+type AccessConfig struct {
+	AllowedNetworks []string `json:"allowed-networks"`
+	TrustedProxies  []string `json:"trusted-proxies"`
+	RateLimit       float64  `json:"rate-limit"`
+	RateBurst       int      `json:"rate-burst"`
+}
+
+// AuthConfig handles the credentials allowed to use the API, authentication
+// being required as soon as a token or a user is configured
+type AuthConfig struct {
+	Tokens []TokenConfig `json:"tokens"`
+	Users  []UserConfig  `json:"users"`
+}
+
+// TokenConfig handles a static bearer token, identified by its SHA-256 hash
+type TokenConfig struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"sha256" secret:"true"`
+	Scopes []string `json:"scopes"`
+}
+
+// UserConfig handles a user authenticating with HTTP basic auth
+type UserConfig struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"bcrypt-hash" secret:"true"`
+	Scopes       []string `json:"scopes"`
+}
+
+// TLSConfig handles the TLS configuration of the web service
+type TLSConfig struct {
+	Cert           string `json:"cert"`
+	Key            string `json:"key"`
+	ClientCA       string `json:"client-ca"`
+	MinVersion     string `json:"min-version"`
+	CipherPolicy   string `json:"cipher-policy"`
+	ReloadInterval int    `json:"reload-interval"`
 }
 
 // LogConfig handles the configuration for the logger
@@ -22,28 +61,168 @@ type LogConfig struct {
 
 // ProbesConfig handles the configuration of system probes
 type ProbesConfig struct {
-	DiskUsage       bool     `json:"disk-usage"`
-	RAMUsage        bool     `json:"ram-usage"`
-	SystemInfo      bool     `json:"system-info"`
-	SystemdServices []string `json:"systemd-services"`
-	Uptime          bool     `json:"uptime"`
+	DiskUsage       bool               `json:"disk-usage"`
+	RAMUsage        bool               `json:"ram-usage"`
+	SystemInfo      bool               `json:"system-info"`
+	SystemdServices []string           `json:"systemd-services"`
+	Uptime          bool               `json:"uptime"`
+	CPUUsage        bool               `json:"cpu-usage"`
+	Interval        int                `json:"interval"`
+	DiskForecast    DiskForecastConfig `json:"disk-forecast"`
+	Processes       ProcessesConfig    `json:"processes"`
+}
+
+// DiskForecastConfig handles the configuration of the disk-full forecast
+type DiskForecastConfig struct {
+	Enabled          bool `json:"enabled"`
+	WindowHours      int  `json:"window-hours"`
+	AlertWithinHours int  `json:"alert-within-hours"`
+}
+
+// ProcessesConfig handles the configuration of the top processes probe
+type ProcessesConfig struct {
+	Enabled bool     `json:"enabled"`
+	Top     int      `json:"top"`
+	Names   []string `json:"names"`
+}
+
+// HistoryConfig handles the configuration of the metrics history
+type HistoryConfig struct {
+	Enabled            bool   `json:"enabled"`
+	Storage            string `json:"storage"`
+	DataDir            string `json:"data-dir"`
+	RetentionHours     int    `json:"retention-hours"`
+	MaxSizeMB          int    `json:"max-size-mb"`
+	DownsampleAfter    int    `json:"downsample-after-hours"`
+	DownsampleInterval int    `json:"downsample-interval"`
+}
+
+// InfluxConfig handles the InfluxDB line protocol output
+type InfluxConfig struct {
+	Endpoint     bool              `json:"endpoint"`
+	WriteURL     string            `json:"write-url"`
+	Token        string            `json:"token" secret:"true"`
+	PushInterval int               `json:"push-interval"`
+	BatchSize    int               `json:"batch-size"`
+	Gzip         bool              `json:"gzip"`
+	MaxRetries   int               `json:"max-retries"`
+	Timeout      int               `json:"timeout"`
+	Tags         map[string]string `json:"tags"`
+}
+
+// StatsdConfig handles the StatsD output
+type StatsdConfig struct {
+	Address       string            `json:"address"`
+	Prefix        string            `json:"prefix"`
+	DogStatsd     bool              `json:"dogstatsd-tags"`
+	MaxPacketSize int               `json:"max-packet-size"`
+	Mapping       map[string]string `json:"mapping"`
+	Tags          map[string]string `json:"tags"`
+}
+
+// GraphiteConfig handles the Graphite plaintext protocol output
+type GraphiteConfig struct {
+	Address      string            `json:"address"`
+	Prefix       string            `json:"prefix"`
+	Templates    map[string]string `json:"templates"`
+	PushInterval int               `json:"push-interval"`
+	MaxBuffer    int               `json:"max-buffer"`
+	Timeout      int               `json:"timeout"`
+}
+
+// OTLPConfig handles the OpenTelemetry metrics export
+type OTLPConfig struct {
+	Endpoint     string            `json:"endpoint"`
+	Protocol     string            `json:"protocol"`
+	Insecure     bool              `json:"insecure"`
+	Headers      map[string]string `json:"headers" secret:"true"`
+	PushInterval int               `json:"push-interval"`
+	Timeout      int               `json:"timeout"`
+}
+
+// MQTTConfig handles the MQTT publishing output
+type MQTTConfig struct {
+	Broker             string `json:"broker"`
+	ClientID           string `json:"client-id"`
+	Username           string `json:"username"`
+	Password           string `json:"password" secret:"true"`
+	Topic              string `json:"topic"`
+	StatusTopic        string `json:"status-topic"`
+	QoS                int    `json:"qos"`
+	Retain             bool   `json:"retain"`
+	CACert             string `json:"ca-cert"`
+	ClientCert         string `json:"client-cert"`
+	ClientKey          string `json:"client-key"`
+	InsecureSkipVerify bool   `json:"insecure-skip-verify"`
+	HomeAssistant      bool   `json:"home-assistant-discovery"`
+	DiscoveryPrefix    string `json:"discovery-prefix"`
+	Timeout            int    `json:"timeout"`
+}
+
+// OutputsConfig handles the configuration of the metrics outputs
+type OutputsConfig struct {
+	Influx   InfluxConfig   `json:"influxdb"`
+	Statsd   StatsdConfig   `json:"statsd"`
+	Graphite GraphiteConfig `json:"graphite"`
+	OTLP     OTLPConfig     `json:"otlp"`
+	MQTT     MQTTConfig     `json:"mqtt"`
+}
+
+// ThresholdConfig holds the Nagios ranges outside of which a check warns or fails,
+// the check never warning or failing when they are empty
+type ThresholdConfig struct {
+	Warning  string `json:"warning"`
+	Critical string `json:"critical"`
+}
+
+// ChecksConfig handles the thresholds of the check command
+type ChecksConfig struct {
+	Disk   ThresholdConfig `json:"disk"`
+	RAM    ThresholdConfig `json:"ram"`
+	Load   ThresholdConfig `json:"load"`
+	Uptime ThresholdConfig `json:"uptime"`
 }
 
 // FullConfiguration handles the entire configuration of the server
 type FullConfiguration struct {
-	Server ServerConfig `json:"server"`
-	Log    LogConfig    `json:"log"`
-	Probes ProbesConfig `json:"probes"`
+	Server  ServerConfig  `json:"server"`
+	Log     LogConfig     `json:"log"`
+	Probes  ProbesConfig  `json:"probes"`
+	History HistoryConfig `json:"history"`
+	Outputs OutputsConfig `json:"outputs"`
+	Checks  ChecksConfig  `json:"checks"`
 }
 
 // NewConfig creates a new configuration with default values
 func NewConfig() FullConfiguration {
 	return FullConfiguration{
 		Server: ServerConfig{
-			ListenMode: "port",
-			Host:       "127.0.0.1",
-			Port:       5000,
-			Socket:     "",
+			ListenMode:      "port",
+			Host:            "127.0.0.1",
+			Port:            5000,
+			Socket:          "",
+			GRPCPort:        0,
+			Dashboard:       true,
+			ShutdownTimeout: 10,
+			WatchConfig:     false,
+			TLS: TLSConfig{
+				Cert:           "",
+				Key:            "",
+				ClientCA:       "",
+				MinVersion:     "1.2",
+				CipherPolicy:   "intermediate",
+				ReloadInterval: 30,
+			},
+			Auth: AuthConfig{
+				Tokens: []TokenConfig{},
+				Users:  []UserConfig{},
+			},
+			Access: AccessConfig{
+				AllowedNetworks: []string{},
+				TrustedProxies:  []string{},
+				RateLimit:       5,
+				RateBurst:       20,
+			},
 		},
 		Log: LogConfig{
 			Level: "INFO",
@@ -54,22 +233,90 @@ func NewConfig() FullConfiguration {
 			SystemInfo:      true,
 			SystemdServices: []string{},
 			Uptime:          true,
+			CPUUsage:        true,
+			Interval:        10,
+			DiskForecast: DiskForecastConfig{
+				Enabled:          true,
+				WindowHours:      6,
+				AlertWithinHours: 24,
+			},
+			Processes: ProcessesConfig{
+				Enabled: false,
+				Top:     5,
+				Names:   []string{},
+			},
+		},
+		History: HistoryConfig{
+			Enabled:            true,
+			Storage:            "memory",
+			DataDir:            "/var/lib/system-monitor",
+			RetentionHours:     24 * 7,
+			MaxSizeMB:          100,
+			DownsampleAfter:    24,
+			DownsampleInterval: 300,
+		},
+		Outputs: OutputsConfig{
+			Influx: InfluxConfig{
+				Endpoint:     true,
+				WriteURL:     "",
+				PushInterval: 10,
+				BatchSize:    5000,
+				Gzip:         true,
+				MaxRetries:   3,
+				Timeout:      5,
+				Tags:         map[string]string{},
+			},
+			Statsd: StatsdConfig{
+				Address:       "",
+				Prefix:        "system_monitor",
+				DogStatsd:     false,
+				MaxPacketSize: 1432,
+				Mapping:       map[string]string{},
+				Tags:          map[string]string{},
+			},
+			Graphite: GraphiteConfig{
+				Address: "",
+				Prefix:  "servers.{hostname}",
+				Templates: map[string]string{
+					"disk-usage.size":        "servers.{hostname}.disk.{mountpoint}.size",
+					"disk-usage.used":        "servers.{hostname}.disk.{mountpoint}.used",
+					"services-status.active": "servers.{hostname}.services.{service}.active",
+				},
+				PushInterval: 10,
+				MaxBuffer:    10000,
+				Timeout:      5,
+			},
+			OTLP: OTLPConfig{
+				Endpoint:     "",
+				Protocol:     "http/protobuf",
+				Insecure:     false,
+				Headers:      map[string]string{},
+				PushInterval: 60,
+				Timeout:      10,
+			},
+			MQTT: MQTTConfig{
+				Broker:          "",
+				ClientID:        "",
+				Topic:           "heimdall/{hostname}/{probe}",
+				StatusTopic:     "heimdall/{hostname}/status",
+				QoS:             0,
+				Retain:          true,
+				HomeAssistant:   false,
+				DiscoveryPrefix: "homeassistant",
+				Timeout:         5,
+			},
+		},
+		Checks: ChecksConfig{
+			Disk:   ThresholdConfig{Warning: "80", Critical: "90"},
+			RAM:    ThresholdConfig{Warning: "80", Critical: "90"},
+			Load:   ThresholdConfig{Warning: "", Critical: ""},
+			Uptime: ThresholdConfig{Warning: "", Critical: ""},
 		},
 	}
 }
 
-// ReadConfigJSON reads a JSON config file and returns the parsed configuration
+// ReadConfigJSON reads a JSON config file and returns the parsed configuration,
+// failing on unknown settings and invalid values
 func ReadConfigJSON(configPath string) (FullConfiguration, error) {
-	log.Debugf("Reading configuration from %q", configPath)
-	conf, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		log.Errorf("Error reading configuration file: %q", err)
-		return FullConfiguration{}, err
-	}
-	parsedConfig := NewConfig()
-	parsingError := json.Unmarshal(conf, &parsedConfig)
-	if parsingError != nil {
-		log.Errorf("Error parsing JSON configuration: %q", parsingError)
-	}
-	return parsedConfig, parsingError
+	return ReadConfig(configPath, "json")
 }
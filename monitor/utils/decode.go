@@ -0,0 +1,460 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	log "github.com/cihub/seelog"
+)
+
+// ConfigFormats lists the supported configuration formats
+var ConfigFormats = []string{"json", "yaml", "toml"}
+
+// configNode is a value of a configuration document with the source and line it was read from
+type configNode struct {
+	source string
+	line   int
+	keys   []string
+	fields map[string]*configNode
+	items  []*configNode
+	value  interface{}
+}
+
+func newObjectNode(line int) *configNode {
+	return &configNode{line: line, fields: make(map[string]*configNode)}
+}
+
+// set adds a field to an object node, keeping the document order
+func (n *configNode) set(key string, child *configNode) {
+	if _, ok := n.fields[key]; !ok {
+		n.keys = append(n.keys, key)
+	}
+	n.fields[key] = child
+}
+
+// setSource records the source of the node and of its children
+func (n *configNode) setSource(source string) {
+	n.source = source
+	for _, child := range n.fields {
+		child.setSource(source)
+	}
+	for _, item := range n.items {
+		item.setSource(source)
+	}
+}
+
+// locate sets the source and line of an error from the node of the setting
+func (n *configNode) locate(err ValidationError) ValidationError {
+	if n != nil {
+		err.Source, err.Line = n.source, n.line
+	}
+	return err
+}
+
+// interfaceValue converts the node to the values produced by encoding/json
+func (n *configNode) interfaceValue() interface{} {
+	switch {
+	case n.fields != nil:
+		result := make(map[string]interface{})
+		for key, child := range n.fields {
+			result[key] = child.interfaceValue()
+		}
+		return result
+	case n.items != nil:
+		result := make([]interface{}, 0, len(n.items))
+		for _, item := range n.items {
+			result = append(result, item.interfaceValue())
+		}
+		return result
+	}
+	return n.value
+}
+
+// joinPath appends a key to the path of a setting
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// lineAt returns the line of an offset in a document
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return 1 + bytes.Count(data[:offset], []byte("\n"))
+}
+
+// parseJSONNode reads the next value of a JSON document
+func parseJSONNode(data []byte, decoder *json.Decoder) (*configNode, error) {
+	line := lineAt(data, decoder.InputOffset())
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		node := newObjectNode(line)
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			// The line of a setting is the one of its key
+			keyLine := lineAt(data, decoder.InputOffset())
+			child, err := parseJSONNode(data, decoder)
+			if err != nil {
+				return nil, err
+			}
+			child.line = keyLine
+			node.set(token.(string), child)
+		}
+		_, err = decoder.Token()
+		return node, err
+	case json.Delim('['):
+		node := &configNode{line: line, items: []*configNode{}}
+		for decoder.More() {
+			child, err := parseJSONNode(data, decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, child)
+		}
+		_, err = decoder.Token()
+		return node, err
+	}
+	return &configNode{line: line, value: token}, nil
+}
+
+// parseJSON reads a JSON document
+func parseJSON(data []byte) (*configNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := parseJSONNode(data, decoder)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return nil, ValidationErrors{{Line: lineAt(data, syntaxError.Offset), Message: err.Error()}}
+		}
+		return nil, ValidationErrors{{Line: lineAt(data, decoder.InputOffset()), Message: err.Error()}}
+	}
+	if decoder.More() {
+		return nil, ValidationErrors{{Line: lineAt(data, decoder.InputOffset()), Message: "unexpected data after the configuration"}}
+	}
+	return root, nil
+}
+
+// yamlToNode converts a YAML node, following the aliases
+func yamlToNode(node *yaml.Node) (*configNode, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return newObjectNode(node.Line), nil
+		}
+		return yamlToNode(node.Content[0])
+	case yaml.AliasNode:
+		return yamlToNode(node.Alias)
+	case yaml.MappingNode:
+		result := newObjectNode(node.Line)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				return nil, ValidationErrors{{Line: key.Line, Message: "merge keys are not supported"}}
+			}
+			child, err := yamlToNode(value)
+			if err != nil {
+				return nil, err
+			}
+			child.line = key.Line
+			result.set(key.Value, child)
+		}
+		return result, nil
+	case yaml.SequenceNode:
+		result := &configNode{line: node.Line, items: []*configNode{}}
+		for _, item := range node.Content {
+			child, err := yamlToNode(item)
+			if err != nil {
+				return nil, err
+			}
+			result.items = append(result.items, child)
+		}
+		return result, nil
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, ValidationErrors{{Line: node.Line, Message: err.Error()}}
+	}
+	return &configNode{line: node.Line, value: value}, nil
+}
+
+// parseYAML reads a YAML document
+func parseYAML(data []byte) (*configNode, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, ValidationErrors{{Message: err.Error()}}
+	}
+	return yamlToNode(&document)
+}
+
+var (
+	tomlTablePattern = regexp.MustCompile(`^\s*(\[\[?)\s*([^\]]+?)\s*\]`)
+	tomlKeyPattern   = regexp.MustCompile(`^\s*([A-Za-z0-9_."' -]+?)\s*=`)
+)
+
+// tomlKey splits a dotted TOML key and removes its quotes
+func tomlKey(key string) string {
+	parts := []string{}
+	for _, part := range strings.Split(key, ".") {
+		parts = append(parts, strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return strings.Join(parts, ".")
+}
+
+// tomlLines finds the line of the tables and keys of a TOML document. The TOML
+// decoder does not expose them, so the document is scanned line by line, which
+// is enough for tables and keys written one per line.
+func tomlLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	arrayCounts := make(map[string]int)
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if match := tomlTablePattern.FindStringSubmatch(text); match != nil {
+			table = tomlKey(match[2])
+			if match[1] == "[[" {
+				if _, ok := lines[table]; !ok {
+					lines[table] = line
+				}
+				index := arrayCounts[table]
+				arrayCounts[table]++
+				table = fmt.Sprintf("%s[%d]", table, index)
+			}
+			lines[table] = line
+			continue
+		}
+		if match := tomlKeyPattern.FindStringSubmatch(text); match != nil {
+			lines[joinPath(table, tomlKey(match[1]))] = line
+		}
+	}
+	return lines
+}
+
+// tomlToNode converts a decoded TOML value, looking up the lines by path
+func tomlToNode(value interface{}, path string, lines map[string]int, parentLine int) *configNode {
+	line, ok := lines[path]
+	if !ok {
+		line = parentLine
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := newObjectNode(line)
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return lines[joinPath(path, keys[i])] < lines[joinPath(path, keys[j])]
+		})
+		for _, key := range keys {
+			result.set(key, tomlToNode(typed[key], joinPath(path, key), lines, line))
+		}
+		return result
+	case []map[string]interface{}:
+		result := &configNode{line: line, items: []*configNode{}}
+		for i, item := range typed {
+			result.items = append(result.items, tomlToNode(item, fmt.Sprintf("%s[%d]", path, i), lines, line))
+		}
+		return result
+	case []interface{}:
+		result := &configNode{line: line, items: []*configNode{}}
+		for i, item := range typed {
+			result.items = append(result.items, tomlToNode(item, fmt.Sprintf("%s[%d]", path, i), lines, line))
+		}
+		return result
+	}
+	return &configNode{line: line, value: value}
+}
+
+// parseTOML reads a TOML document
+func parseTOML(data []byte) (*configNode, error) {
+	document := make(map[string]interface{})
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		var parseError toml.ParseError
+		if errors.As(err, &parseError) {
+			return nil, ValidationErrors{{Line: parseError.Position.Line, Message: parseError.Message}}
+		}
+		return nil, ValidationErrors{{Message: err.Error()}}
+	}
+	return tomlToNode(document, "", tomlLines(data), 0), nil
+}
+
+// fieldType returns the type of the setting stored under a key, nil meaning that
+// the value is not checked. It returns false when the key is unknown.
+func fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	if t == nil {
+		return nil, true
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem(), true
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if name := strings.Split(field.Tag.Get("json"), ",")[0]; name == key {
+				return field.Type, true
+			}
+		}
+		return nil, false
+	}
+	// The type mismatch is reported when decoding
+	return nil, true
+}
+
+// checkSettings records the node of every setting and reports the unknown ones
+func checkSettings(node *configNode, path string, t reflect.Type, nodes map[string]*configNode, errors *ValidationErrors) {
+	nodes[path] = node
+	for _, key := range node.keys {
+		child := node.fields[key]
+		childType, known := fieldType(t, key)
+		if !known {
+			*errors = append(*errors, child.locate(ValidationError{Path: joinPath(path, key), Message: "unknown setting"}))
+		}
+		checkSettings(child, joinPath(path, key), childType, nodes, errors)
+	}
+	var elementType reflect.Type
+	if t != nil && t.Kind() == reflect.Slice {
+		elementType = t.Elem()
+	}
+	for i, item := range node.items {
+		checkSettings(item, fmt.Sprintf("%s[%d]", path, i), elementType, nodes, errors)
+	}
+}
+
+// parseDocument reads a configuration document in the given format
+func parseDocument(data []byte, format string) (*configNode, error) {
+	switch format {
+	case "json":
+		return parseJSON(data)
+	case "yaml":
+		return parseYAML(data)
+	case "toml":
+		return parseTOML(data)
+	}
+	return nil, fmt.Errorf("Unknown configuration format %q, expecting one of %q", format, ConfigFormats)
+}
+
+// decodeTree decodes the settings of a document tree on top of the default values.
+// It rejects unknown settings and invalid values, returning ValidationErrors located
+// at their source, and the nodes of the settings by path.
+func decodeTree(root *configNode) (FullConfiguration, map[string]*configNode, error) {
+	nodes := make(map[string]*configNode)
+	validationErrors := ValidationErrors{}
+	checkSettings(root, "", reflect.TypeOf(FullConfiguration{}), nodes, &validationErrors)
+
+	// All the formats are decoded through their JSON equivalent, so that they
+	// share the same setting names and conversions
+	normalized, err := json.Marshal(root.interfaceValue())
+	if err != nil {
+		return FullConfiguration{}, nil, err
+	}
+	config := NewConfig()
+	if err := json.Unmarshal(normalized, &config); err != nil {
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			validationErrors = append(validationErrors, nodes[typeError.Field].locate(ValidationError{
+				Path:    typeError.Field,
+				Message: fmt.Sprintf("expected %s, got %s", typeError.Type, typeError.Value),
+			}))
+			return FullConfiguration{}, nil, validationErrors
+		}
+		return FullConfiguration{}, nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		for _, validationError := range err.(ValidationErrors) {
+			validationErrors = append(validationErrors, nodes[validationError.Path].locate(validationError))
+		}
+	}
+	if len(validationErrors) > 0 {
+		return FullConfiguration{}, nil, validationErrors
+	}
+	return config, nodes, nil
+}
+
+// DecodeConfig parses a configuration in the given format on top of the default
+// values. It rejects unknown settings and invalid values, returning ValidationErrors
+// with their lines.
+func DecodeConfig(data []byte, format string) (FullConfiguration, error) {
+	root, err := parseDocument(data, format)
+	if err != nil {
+		return FullConfiguration{}, err
+	}
+	config, _, err := decodeTree(root)
+	return config, err
+}
+
+// DecodeConfigJSON parses a JSON configuration on top of the default values
+func DecodeConfigJSON(data []byte) (FullConfiguration, error) {
+	return DecodeConfig(data, "json")
+}
+
+// ConfigFormat returns the format of a configuration file from its extension
+func ConfigFormat(configPath string) (string, error) {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	}
+	return "", fmt.Errorf("Unknown configuration format for %q, expecting one of %q", configPath, ConfigFormats)
+}
+
+// readDocument reads a configuration file in the given format, guessed from the
+// extension when empty
+func readDocument(configPath string, format string) (*configNode, error) {
+	if format == "" {
+		var err error
+		if format, err = ConfigFormat(configPath); err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("Reading %s configuration from %q", format, configPath)
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseDocument(data, format)
+	if err != nil {
+		var validationErrors ValidationErrors
+		if errors.As(err, &validationErrors) {
+			for i := range validationErrors {
+				validationErrors[i].Source = configPath
+			}
+		}
+		return nil, err
+	}
+	root.setSource(configPath)
+	return root, nil
+}
+
+// ReadConfig reads a configuration file in the given format, guessed from the
+// extension when empty, and returns the parsed configuration
+func ReadConfig(configPath string, format string) (FullConfiguration, error) {
+	return LoadConfig(ConfigSources{File: configPath, Format: format})
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test that the settings of the file are applied on top of the defaults
+func TestDecodeConfigJSON(t *testing.T) {
+	config, err := DecodeConfigJSON([]byte(`{
+  "server": {"port": 8080, "auth": {"tokens": [{"name": "ci", "sha256": "00", "scopes": ["admin"]}]}},
+  "probes": {"systemd-services": ["nginx"]},
+  "outputs": {"statsd": {"tags": {"any-key": "value"}}}
+}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if config.Server.Port != 8080 || config.Server.Host != "127.0.0.1" || config.Probes.SystemdServices[0] != "nginx" {
+		t.Fatalf("Invalid configuration %+v", config)
+	}
+}
+
+// Test that the errors are reported with their path and line
+func TestDecodeConfigJSONErrors(t *testing.T) {
+	for _, test := range []struct {
+		document string
+		errors   ValidationErrors
+	}{
+		{
+			"{\n  \"server\": {\n    \"prot\": 8080\n  },\n  \"unknown\": {\"nested\": 1}\n}",
+			ValidationErrors{
+				{Path: "server.prot", Line: 3, Message: "unknown setting"},
+				{Path: "unknown", Line: 5, Message: "unknown setting"},
+			},
+		},
+		{
+			"{\n  \"server\": {\n    \"port\": \"8080\"\n  }\n}",
+			ValidationErrors{{Path: "server.port", Line: 3, Message: "expected int, got string"}},
+		},
+		{
+			"{\n  \"server\": {\"port\": -1, \"host\": \"\"},\n  \"log\": {\n    \"level\": \"loud\"\n  }\n}",
+			ValidationErrors{
+				{Path: "server.host", Line: 2, Message: "must not be empty"},
+				{Path: "server.port", Line: 2, Message: "must be between 1 and 65535, got -1"},
+				{Path: "log.level", Line: 4, Message: `must be one of ["trace" "debug" "info" "warn" "error" "critical" "off"], got "loud"`},
+			},
+		},
+		{
+			"{\n  \"server\": {\n    \"port\": 80,\n  }\n}",
+			ValidationErrors{{Line: 3, Message: "invalid character ',' looking for beginning of value"}},
+		},
+	} {
+		_, err := DecodeConfigJSON([]byte(test.document))
+		if !reflect.DeepEqual(err, test.errors) {
+			t.Fatalf("Invalid errors for %q: %q", test.document, err)
+		}
+	}
+}
+
+// Test that the YAML and TOML configurations get the same settings and errors as JSON
+func TestDecodeConfigFormats(t *testing.T) {
+	documents := map[string]string{
+		"json": `{"server": {"port": 8080, "auth": {"tokens": [{"name": "ci", "sha256": "00"}]}}, "probes": {"systemd-services": ["nginx"]}}`,
+		"yaml": "server:\n  port: 8080\n  auth:\n    tokens:\n      - name: ci\n        sha256: \"00\"\nprobes:\n  systemd-services: [nginx]\n",
+		"toml": "[server]\nport = 8080\n\n[[server.auth.tokens]]\nname = \"ci\"\nsha256 = \"00\"\n\n[probes]\nsystemd-services = [\"nginx\"]\n",
+	}
+	expected, err := DecodeConfig([]byte(documents["json"]), "json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	for _, format := range []string{"yaml", "toml"} {
+		config, err := DecodeConfig([]byte(documents[format]), format)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %q", format, err)
+		}
+		if !reflect.DeepEqual(config, expected) {
+			t.Fatalf("Invalid %s configuration %+v", format, config)
+		}
+	}
+
+	invalid := map[string]string{
+		"yaml": "server:\n  port: 8080\n  prot: 1\nprobes:\n  interval: 0\n",
+		"toml": "[server]\nport = 8080\nprot = 1\n\n[probes]\ninterval = 0\n",
+	}
+	for format, document := range invalid {
+		_, err := DecodeConfig([]byte(document), format)
+		expectedErrors := ValidationErrors{
+			{Path: "server.prot", Line: 3, Message: "unknown setting"},
+			{Path: "probes.interval", Line: 5, Message: "must be positive"},
+		}
+		if format == "toml" {
+			expectedErrors[1].Line = 6
+		}
+		if !reflect.DeepEqual(err, expectedErrors) {
+			t.Fatalf("Invalid errors for %s: %q", format, err)
+		}
+	}
+
+	if _, err := DecodeConfig([]byte("server:\n  port: [1]\n"), "yaml"); err == nil || err.Error() != "line 2: server.port: expected int, got array" {
+		t.Fatalf("Invalid error %q", err)
+	}
+}
+
+// Test the detection of the format from the extension
+func TestConfigFormat(t *testing.T) {
+	for path, expected := range map[string]string{"config.json": "json", "config.YML": "yaml", "config.yaml": "yaml", "config.toml": "toml"} {
+		if format, err := ConfigFormat(path); err != nil || format != expected {
+			t.Fatalf("Invalid format %q for %q", format, path)
+		}
+	}
+	if _, err := ConfigFormat("config.ini"); err == nil {
+		t.Fatal("Expecting an error for an unknown extension")
+	}
+}
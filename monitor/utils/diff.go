@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretSettings lists the paths of the settings tagged as secret, the elements
+// of lists being written as path[]. All the values under a secret map are secret.
+func secretSettings(path string, t reflect.Type, result map[string]bool) map[string]bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" {
+				result[joinPath(path, name)] = true
+			}
+			secretSettings(joinPath(path, name), field.Type, result)
+		}
+	case reflect.Slice:
+		secretSettings(path+"[]", t.Elem(), result)
+	}
+	return result
+}
+
+// secretPaths are the settings whose values are never shown
+var secretPaths = secretSettings("", reflect.TypeOf(FullConfiguration{}), make(map[string]bool))
+
+// listIndex matches the index of a list element in a path
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// flatten lists the leaf values of a JSON document by their path
+func flatten(path string, value interface{}, result map[string]string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if path == "" {
+				flatten(key, child, result)
+			} else {
+				flatten(path+"."+key, child, result)
+			}
+		}
+	case []interface{}:
+		if len(typed) == 0 {
+			result[path] = "[]"
+		}
+		for i, child := range typed {
+			flatten(fmt.Sprintf("%s[%d]", path, i), child, result)
+		}
+	default:
+		b, _ := json.Marshal(typed)
+		result[path] = string(b)
+	}
+}
+
+// flattenConfig lists the values of a configuration by their path
+func flattenConfig(config FullConfiguration) map[string]string {
+	var document interface{}
+	b, _ := json.Marshal(config)
+	json.Unmarshal(b, &document)
+	result := make(map[string]string)
+	flatten("", document, result)
+	return result
+}
+
+// isSecret checks whether the setting at a path holds a secret, or is a value
+// of a secret map
+func isSecret(path string) bool {
+	path = listIndex.ReplaceAllString(path, "[]")
+	for {
+		if secretPaths[path] {
+			return true
+		}
+		end := strings.LastIndex(path, ".")
+		if end < 0 {
+			return false
+		}
+		path = path[:end]
+	}
+}
+
+// DiffConfig lists the settings changed between two configurations, as
+// "path: old -> new" lines sorted by path. Secrets are never shown.
+func DiffConfig(old FullConfiguration, new FullConfiguration) []string {
+	oldValues, newValues := flattenConfig(old), flattenConfig(new)
+	paths := make(map[string]bool)
+	for path := range oldValues {
+		paths[path] = true
+	}
+	for path := range newValues {
+		paths[path] = true
+	}
+
+	changes := []string{}
+	for path := range paths {
+		oldValue, hadOld := oldValues[path]
+		newValue, hasNew := newValues[path]
+		if hadOld && hasNew && oldValue == newValue {
+			continue
+		}
+		if !hadOld {
+			oldValue = "<unset>"
+		}
+		if !hasNew {
+			newValue = "<unset>"
+		}
+		if isSecret(path) {
+			changes = append(changes, fmt.Sprintf("%s: changed", path))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", path, oldValue, newValue))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// redact replaces the secrets of a JSON document, empty secrets being kept to
+// show that they are not set
+func redact(path string, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			typed[key] = redact(joinPath(path, key), child)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			typed[i] = redact(fmt.Sprintf("%s[%d]", path, i), child)
+		}
+	case string:
+		if typed != "" && isSecret(path) {
+			return "<redacted>"
+		}
+	}
+	return value
+}
+
+// RedactConfig returns the JSON document of a configuration with the secrets hidden
+func RedactConfig(config FullConfiguration) map[string]interface{} {
+	var document map[string]interface{}
+	b, _ := json.Marshal(config)
+	json.Unmarshal(b, &document)
+	redact("", document)
+	return document
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test the listing of changed settings
+func TestDiffConfig(t *testing.T) {
+	old := NewConfig()
+	new := NewConfig()
+	if changes := DiffConfig(old, new); len(changes) != 0 {
+		t.Fatalf("Expecting no changes, got %q", changes)
+	}
+
+	new.Server.Port = 5001
+	new.Probes.SystemdServices = []string{"nginx"}
+	new.Outputs.MQTT.Password = "secret"
+	new.Outputs.Statsd.Tags = map[string]string{"env": "prod"}
+	new.Outputs.OTLP.Headers = map[string]string{"Authorization": "Bearer secret"}
+	expected := []string{
+		`outputs.mqtt.password: changed`,
+		`outputs.otlp.headers.Authorization: changed`,
+		`outputs.statsd.tags.env: <unset> -> "prod"`,
+		`probes.systemd-services: [] -> <unset>`,
+		`probes.systemd-services[0]: <unset> -> "nginx"`,
+		`server.port: 5000 -> 5001`,
+	}
+	if changes := DiffConfig(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Invalid changes %q", changes)
+	}
+}
+
+// Test that the secrets are hidden from the printed configuration
+func TestRedactConfig(t *testing.T) {
+	config := NewConfig()
+	config.Outputs.MQTT.Password = "secret"
+	config.Server.Auth.Tokens = []TokenConfig{{Name: "ci", Hash: "00"}}
+	config.Outputs.OTLP.Headers = map[string]string{"Authorization": "Bearer secret", "X-Empty": ""}
+	document := RedactConfig(config)
+	mqtt := document["outputs"].(map[string]interface{})["mqtt"].(map[string]interface{})
+	if mqtt["password"] != "<redacted>" || mqtt["username"] != "" {
+		t.Fatalf("Invalid MQTT settings %v", mqtt)
+	}
+	headers := document["outputs"].(map[string]interface{})["otlp"].(map[string]interface{})["headers"].(map[string]interface{})
+	if headers["Authorization"] != "<redacted>" || headers["X-Empty"] != "" {
+		t.Fatalf("Invalid OTLP headers %v", headers)
+	}
+	token := document["server"].(map[string]interface{})["auth"].(map[string]interface{})["tokens"].([]interface{})[0].(map[string]interface{})
+	if token["sha256"] != "<redacted>" || token["name"] != "ci" {
+		t.Fatalf("Invalid token %v", token)
+	}
+}
+
+// Test that the secrets are found from the tags of the settings
+func TestIsSecret(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"outputs.mqtt.password":              true,
+		"outputs.mqtt.username":              false,
+		"outputs.otlp.headers.Authorization": true,
+		"outputs.otlp.headers.x.api.key":     true,
+		"outputs.otlp.endpoint":              false,
+		"server.auth.tokens[2].sha256":       true,
+		"server.auth.tokens[2].name":         false,
+		"server.auth.users[0].bcrypt-hash":   true,
+		"outputs.influxdb.token":             true,
+		"outputs.statsd.tags.token":          false,
+	} {
+		if isSecret(path) != expected {
+			t.Fatalf("Invalid secret status for %q", path)
+		}
+	}
+}
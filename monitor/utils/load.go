@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// ConfigSources lists where a configuration is read from. The settings of the
+// flags override the ones of the environment, which override the ones of the
+// files, which override the default values.
+type ConfigSources struct {
+	// File is the configuration file, none being read when empty
+	File string
+	// Format is the format of the file, guessed from its extension when empty
+	Format string
+	// Dir holds fragments merged on top of the file in lexical order, none being
+	// read when empty
+	Dir string
+	// Env lists the environment as "key=value" entries, as returned by os.Environ
+	Env []string
+	// Flags maps the paths of the settings to the values given on the command line
+	Flags map[string]string
+}
+
+// Origins maps the path of each effective setting to where it was read from: a
+// file and its line, an environment variable, a flag or the default values
+type Origins map[string]string
+
+// defaultOrigin is the origin of the settings that were not read from any source
+const defaultOrigin = "default"
+
+// mergeNode merges a fragment on top of a document tree. Objects are merged key
+// by key, lists are appended and the other values are replaced.
+func mergeNode(base *configNode, overlay *configNode) *configNode {
+	switch {
+	case base.fields != nil && overlay.fields != nil:
+		for _, key := range overlay.keys {
+			if existing, ok := base.fields[key]; ok {
+				base.set(key, mergeNode(existing, overlay.fields[key]))
+			} else {
+				base.set(key, overlay.fields[key])
+			}
+		}
+		return base
+	case base.items != nil && overlay.items != nil:
+		base.items = append(base.items, overlay.items...)
+		return base
+	}
+	return overlay
+}
+
+// readDir reads the fragments of a drop-in directory in lexical order, ignoring
+// the hidden files and the files in an unknown format
+func readDir(dir string) ([]*configNode, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fragments := []*configNode{}
+	validationErrors := ValidationErrors{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if _, err := ConfigFormat(path); err != nil {
+			log.Debugf("Ignoring configuration fragment %q: %q", path, err)
+			continue
+		}
+		fragment, err := readDocument(path, "")
+		if err != nil {
+			var fragmentErrors ValidationErrors
+			if !errors.As(err, &fragmentErrors) {
+				return nil, err
+			}
+			validationErrors = append(validationErrors, fragmentErrors...)
+			continue
+		}
+		fragments = append(fragments, fragment)
+	}
+	if len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+	return fragments, nil
+}
+
+// origin describes where a node was read from
+func (n *configNode) origin() string {
+	switch {
+	case n == nil || n.source == "":
+		return defaultOrigin
+	case n.line > 0:
+		return fmt.Sprintf("%s:%d", n.source, n.line)
+	}
+	return n.source
+}
+
+// LoadConfig reads a configuration from its sources on top of the default values.
+// It rejects unknown settings and invalid values, returning ValidationErrors
+// located at their source.
+func LoadConfig(sources ConfigSources) (FullConfiguration, error) {
+	config, _, err := LoadConfigOrigins(sources)
+	return config, err
+}
+
+// LoadConfigOrigins reads a configuration like LoadConfig and also returns where
+// each of its settings was read from
+func LoadConfigOrigins(sources ConfigSources) (FullConfiguration, Origins, error) {
+	root := newObjectNode(0)
+	if sources.File != "" {
+		var err error
+		if root, err = readDocument(sources.File, sources.Format); err != nil {
+			return FullConfiguration{}, nil, err
+		}
+	}
+	if sources.Dir != "" {
+		fragments, err := readDir(sources.Dir)
+		if err != nil {
+			return FullConfiguration{}, nil, err
+		}
+		for _, fragment := range fragments {
+			root = mergeNode(root, fragment)
+		}
+	}
+
+	overrideErrors := applyOverrides(root, sources)
+	config, nodes, err := decodeTree(root)
+	if overrideErrors != nil {
+		if decodeErrors, ok := err.(ValidationErrors); ok {
+			return FullConfiguration{}, nil, append(overrideErrors.(ValidationErrors), decodeErrors...)
+		}
+		return FullConfiguration{}, nil, overrideErrors
+	}
+	if err != nil {
+		return FullConfiguration{}, nil, err
+	}
+
+	origins := make(Origins)
+	for path := range flattenConfig(config) {
+		origins[path] = nodes[path].origin()
+	}
+	return config, origins, nil
+}
+
+// FormatOrigins lists the settings of a configuration as "path = value (origin)"
+// lines sorted by path. Secrets are never shown.
+func FormatOrigins(config FullConfiguration, origins Origins) []string {
+	lines := []string{}
+	for path, value := range flattenConfig(config) {
+		if isSecret(path) && value != `""` {
+			value = `"<redacted>"`
+		}
+		origin, ok := origins[path]
+		if !ok {
+			origin = defaultOrigin
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s (%s)", path, value, origin))
+	}
+	sort.Strings(lines)
+	return lines
+}
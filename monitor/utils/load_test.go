@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Test that the fragments are merged in lexical order, lists being appended
+func TestLoadConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	confDir := filepath.Join(dir, "conf.d")
+	os.Mkdir(confDir, 0700)
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte("{\n  \"server\": {\"port\": 8000},\n  \"probes\": {\"systemd-services\": [\"nginx\"]}\n}"), 0600)
+	ioutil.WriteFile(filepath.Join(confDir, "20-backup.json"), []byte(`{"probes": {"systemd-services": ["restic"]}, "outputs": {"statsd": {"tags": {"team": "backup"}}}}`), 0600)
+	ioutil.WriteFile(filepath.Join(confDir, "10-web.yaml"), []byte("server:\n  port: 8100\nprobes:\n  systemd-services: [php-fpm]\n"), 0600)
+	ioutil.WriteFile(filepath.Join(confDir, "README"), []byte("not a fragment"), 0600)
+
+	config, origins, err := LoadConfigOrigins(ConfigSources{
+		File:  filepath.Join(dir, "config.json"),
+		Dir:   confDir,
+		Env:   []string{"SYSMON_LOG_LEVEL=debug"},
+		Flags: map[string]string{"probes.interval": "10"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if config.Server.Port != 8100 || config.Outputs.Statsd.Tags["team"] != "backup" {
+		t.Fatalf("Invalid configuration %+v", config)
+	}
+	if !reflect.DeepEqual(config.Probes.SystemdServices, []string{"nginx", "php-fpm", "restic"}) {
+		t.Fatalf("Invalid services %q", config.Probes.SystemdServices)
+	}
+
+	for path, expected := range map[string]string{
+		"server.port":                filepath.Join(confDir, "10-web.yaml") + ":2",
+		"server.host":                "default",
+		"probes.systemd-services[0]": filepath.Join(dir, "config.json") + ":3",
+		"probes.systemd-services[2]": filepath.Join(confDir, "20-backup.json") + ":1",
+		"outputs.statsd.tags.team":   filepath.Join(confDir, "20-backup.json") + ":1",
+		"log.level":                  "env SYSMON_LOG_LEVEL",
+		"probes.interval":            "flag --probes.interval",
+	} {
+		if origins[path] != expected {
+			t.Fatalf("Invalid origin %q for %s, expecting %q", origins[path], path, expected)
+		}
+	}
+	expected := "server.port = 8100 (" + filepath.Join(confDir, "10-web.yaml") + ":2)"
+	found := false
+	for _, line := range FormatOrigins(config, origins) {
+		found = found || line == expected
+	}
+	if !found {
+		t.Fatalf("Missing origin %q", expected)
+	}
+}
+
+// Test that the errors of the fragments are reported with their file
+func TestLoadConfigDirErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "10-web.yaml"), []byte("server:\n  prot: 8100\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "20-probes.json"), []byte("{\n  \"probes\": {\"interval\": 0}\n}"), 0600)
+
+	_, err = LoadConfig(ConfigSources{Dir: dir})
+	expected := ValidationErrors{
+		{Path: "server.prot", Source: filepath.Join(dir, "10-web.yaml"), Line: 2, Message: "unknown setting"},
+		{Path: "probes.interval", Source: filepath.Join(dir, "20-probes.json"), Line: 2, Message: "must be positive"},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Invalid errors %q", err)
+	}
+}
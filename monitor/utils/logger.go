@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// NewLogger creates the logger writing the messages of the configured level and
+// above to the standard output
+func NewLogger(config LogConfig) (log.LoggerInterface, error) {
+	level, ok := log.LogLevelFromString(strings.ToLower(config.Level))
+	if !ok {
+		return nil, fmt.Errorf("Invalid log level %q", config.Level)
+	}
+	if level == log.Off {
+		return log.Disabled, nil
+	}
+	return log.LoggerFromWriterWithMinLevel(os.Stdout, level)
+}
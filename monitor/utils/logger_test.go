@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"testing"
+
+	log "github.com/cihub/seelog"
+)
+
+// Test the creation of the logger from the configured level
+func TestNewLogger(t *testing.T) {
+	for _, level := range []string{"trace", "DEBUG", "Info", "warn", "error", "critical", "off"} {
+		if _, err := NewLogger(LogConfig{Level: level}); err != nil {
+			t.Fatalf("Unexpected error for %q: %q", level, err)
+		}
+	}
+	if logger, _ := NewLogger(LogConfig{Level: "off"}); logger != log.Disabled {
+		t.Fatal("Expecting the logs to be disabled")
+	}
+	if _, err := NewLogger(LogConfig{Level: "verbose"}); err == nil {
+		t.Fatal("Expecting an error for an unknown level")
+	}
+}
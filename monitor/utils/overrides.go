@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the name of the environment variables overriding the settings
+const EnvPrefix = "SYSMON_"
+
+// setting is a value of the configuration that can be overridden
+type setting struct {
+	path      string
+	valueType reflect.Type
+}
+
+// configSettings lists the settings of a configuration type by path
+func configSettings(path string, t reflect.Type, result []setting) []setting {
+	if t.Kind() != reflect.Struct {
+		return append(result, setting{path: path, valueType: t})
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		result = configSettings(joinPath(path, name), field.Type, result)
+	}
+	return result
+}
+
+// Settings lists the paths of all the settings of the configuration
+func Settings() []string {
+	paths := []string{}
+	for _, s := range configSettings("", reflect.TypeOf(FullConfiguration{}), nil) {
+		paths = append(paths, s.path)
+	}
+	return paths
+}
+
+// EnvName returns the environment variable overriding the setting at a path
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// parseOverride converts the text of an override to a value of the setting type.
+// Lists are separated by commas, maps are written as key=value pairs separated by
+// commas and lists of objects are written in JSON.
+func parseOverride(text string, t reflect.Type) (*configNode, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return &configNode{value: text}, nil
+	case reflect.Int:
+		if _, err := strconv.Atoi(strings.TrimSpace(text)); err != nil {
+			return nil, fmt.Errorf("expected int, got %q", text)
+		}
+		return &configNode{value: json.Number(strings.TrimSpace(text))}, nil
+	case reflect.Float64:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil {
+			return nil, fmt.Errorf("expected float64, got %q", text)
+		}
+		return &configNode{value: json.Number(strings.TrimSpace(text))}, nil
+	case reflect.Bool:
+		value, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("expected bool, got %q", text)
+		}
+		return &configNode{value: value}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.String {
+			node, err := parseJSON([]byte(text))
+			if err != nil {
+				return nil, fmt.Errorf("expected a JSON list: %s", err)
+			}
+			return node, nil
+		}
+		node := &configNode{items: []*configNode{}}
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				node.items = append(node.items, &configNode{value: item})
+			}
+		}
+		return node, nil
+	case reflect.Map:
+		node := newObjectNode(0)
+		for _, pair := range strings.Split(text, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+				return nil, fmt.Errorf("expected key=value pairs, got %q", pair)
+			}
+			node.set(strings.TrimSpace(parts[0]), &configNode{value: strings.TrimSpace(parts[1])})
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("cannot be overridden")
+}
+
+// setPath replaces the value at a path of a document tree, creating the missing objects
+func setPath(root *configNode, path string, value *configNode) {
+	keys := strings.Split(path, ".")
+	node := root
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := node.fields[key]
+		if !ok || child.fields == nil {
+			child = newObjectNode(0)
+			child.source = value.source
+			node.set(key, child)
+		}
+		node = child
+	}
+	node.set(keys[len(keys)-1], value)
+}
+
+// applyOverride parses an override and sets it in a document tree
+func applyOverride(root *configNode, s setting, text string, source string, errors *ValidationErrors) {
+	value, err := parseOverride(text, s.valueType)
+	if err != nil {
+		*errors = append(*errors, ValidationError{Path: s.path, Source: source, Message: err.Error()})
+		return
+	}
+	value.setSource(source)
+	setPath(root, s.path, value)
+}
+
+// applyOverrides sets the settings of the environment and of the flags in a document tree
+func applyOverrides(root *configNode, sources ConfigSources) error {
+	settings := make(map[string]setting)
+	envSettings := make(map[string]setting)
+	for _, s := range configSettings("", reflect.TypeOf(FullConfiguration{}), nil) {
+		settings[s.path] = s
+		envSettings[EnvName(s.path)] = s
+	}
+
+	validationErrors := ValidationErrors{}
+	env := append([]string{}, sources.Env...)
+	sort.Strings(env)
+	for _, entry := range env {
+		parts := strings.SplitN(entry, "=", 2)
+		if !strings.HasPrefix(parts[0], EnvPrefix) || len(parts) != 2 {
+			continue
+		}
+		source := "env " + parts[0]
+		s, ok := envSettings[parts[0]]
+		if !ok {
+			validationErrors = append(validationErrors, ValidationError{Source: source, Message: "unknown setting"})
+			continue
+		}
+		applyOverride(root, s, parts[1], source, &validationErrors)
+	}
+
+	paths := make([]string, 0, len(sources.Flags))
+	for path := range sources.Flags {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		source := "flag --" + path
+		s, ok := settings[path]
+		if !ok {
+			validationErrors = append(validationErrors, ValidationError{Source: source, Message: "unknown setting"})
+			continue
+		}
+		applyOverride(root, s, sources.Flags[path], source, &validationErrors)
+	}
+
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+// overrideFlag is a command-line flag overriding a setting
+type overrideFlag struct {
+	setting
+	values map[string]string
+}
+
+func (f *overrideFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return f.values[f.path]
+}
+
+func (f *overrideFlag) Set(value string) error {
+	f.values[f.path] = value
+	return nil
+}
+
+// IsBoolFlag lets the boolean settings be enabled without a value
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.valueType.Kind() == reflect.Bool
+}
+
+// ConfigFlags registers a flag for every setting, named after its path, and
+// returns the values given on the command line by path
+func ConfigFlags(flags *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	for _, s := range configSettings("", reflect.TypeOf(FullConfiguration{}), nil) {
+		usage := fmt.Sprintf("Override the %s setting (environment variable %s)", s.path, EnvName(s.path))
+		flags.Var(&overrideFlag{setting: s, values: values}, s.path, usage)
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Test that the flags override the environment, which overrides the file
+func TestLoadConfigOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(path, []byte("server:\n  port: 8000\n  host: 0.0.0.0\nprobes:\n  systemd-services: [nginx]\n"), 0600)
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	values := ConfigFlags(flags)
+	if err := flags.Parse([]string{"--server.port", "9100", "--probes.ram-usage=false", "--outputs.statsd.tags", "env=prod,dc=paris"}); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	config, err := LoadConfig(ConfigSources{
+		File:  path,
+		Env:   []string{"SYSMON_SERVER_PORT=9000", "SYSMON_PROBES_SYSTEMD_SERVICES=a, b", "SYSMON_LOG_LEVEL=debug", "HOME=/root"},
+		Flags: values,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if config.Server.Port != 9100 || config.Server.Host != "0.0.0.0" || config.Log.Level != "debug" || config.Probes.RAMUsage {
+		t.Fatalf("Invalid configuration %+v", config)
+	}
+	if !reflect.DeepEqual(config.Probes.SystemdServices, []string{"a", "b"}) {
+		t.Fatalf("Invalid services %q", config.Probes.SystemdServices)
+	}
+	if !reflect.DeepEqual(config.Outputs.Statsd.Tags, map[string]string{"env": "prod", "dc": "paris"}) {
+		t.Fatalf("Invalid tags %q", config.Outputs.Statsd.Tags)
+	}
+
+	// The environment alone applies on top of the defaults
+	config, err = LoadConfig(ConfigSources{Env: []string{`SYSMON_SERVER_AUTH_TOKENS=[{"name": "ci", "sha256": "00"}]`}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if config.Server.Port != NewConfig().Server.Port || len(config.Server.Auth.Tokens) != 1 || config.Server.Auth.Tokens[0].Name != "ci" {
+		t.Fatalf("Invalid configuration %+v", config)
+	}
+}
+
+// Test that the invalid overrides are reported with their source
+func TestLoadConfigOverrideErrors(t *testing.T) {
+	_, err := LoadConfig(ConfigSources{
+		Env:   []string{"SYSMON_SERVER_PORT=http", "SYSMON_SERVER_PROT=1", "SYSMON_PROBES_INTERVAL=0"},
+		Flags: map[string]string{"server.dashboard": "maybe"},
+	})
+	expected := ValidationErrors{
+		{Path: "server.port", Source: "env SYSMON_SERVER_PORT", Message: `expected int, got "http"`},
+		{Source: "env SYSMON_SERVER_PROT", Message: "unknown setting"},
+		{Path: "server.dashboard", Source: "flag --server.dashboard", Message: `expected bool, got "maybe"`},
+		{Path: "probes.interval", Source: "env SYSMON_PROBES_INTERVAL", Message: "must be positive"},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Invalid errors %q", err)
+	}
+}
+
+// Test that every setting has its own environment variable
+func TestEnvNames(t *testing.T) {
+	names := make(map[string]string)
+	for _, path := range Settings() {
+		name := EnvName(path)
+		if previous, ok := names[name]; ok {
+			t.Fatalf("Settings %q and %q share the environment variable %s", previous, path, name)
+		}
+		names[name] = path
+	}
+	if name := EnvName("probes.systemd-services"); name != "SYSMON_PROBES_SYSTEMD_SERVICES" {
+		t.Fatalf("Invalid name %s", name)
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Range is a Nagios threshold range. A value outside of the range raises an
+// alert, or inside of it when the range starts with @.
+type Range struct {
+	Text   string
+	Start  float64
+	End    float64
+	Inside bool
+}
+
+// parseBound reads a bound of a range, ~ being infinite and an empty bound
+// taking the default value
+func parseBound(text string, empty float64, infinite float64) (float64, error) {
+	switch text {
+	case "":
+		return empty, nil
+	case "~":
+		return infinite, nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+// ParseRange reads a Nagios threshold range such as "10", "10:", "~:10", "10:20"
+// or "@10:20". It returns nil for an empty range, which never raises an alert.
+func ParseRange(text string) (*Range, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	r := &Range{Text: text}
+	definition := text
+	if strings.HasPrefix(definition, "@") {
+		r.Inside = true
+		definition = definition[1:]
+	}
+
+	var err error
+	if index := strings.Index(definition, ":"); index >= 0 {
+		if r.Start, err = parseBound(definition[:index], 0, math.Inf(-1)); err != nil {
+			return nil, fmt.Errorf("invalid range %q", text)
+		}
+		if r.End, err = parseBound(definition[index+1:], math.Inf(1), math.Inf(1)); err != nil {
+			return nil, fmt.Errorf("invalid range %q", text)
+		}
+	} else if r.End, err = strconv.ParseFloat(definition, 64); err != nil {
+		return nil, fmt.Errorf("invalid range %q", text)
+	}
+
+	if r.Start > r.End {
+		return nil, fmt.Errorf("invalid range %q, the start is greater than the end", text)
+	}
+	return r, nil
+}
+
+// Alerts checks whether a value raises an alert, never being the case for a nil range
+func (r *Range) Alerts(value float64) bool {
+	if r == nil {
+		return false
+	}
+	inside := value >= r.Start && value <= r.End
+	return inside == r.Inside
+}
+
+// String returns the range as written in the configuration
+func (r *Range) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.Text
+}
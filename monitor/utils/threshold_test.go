@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+// Test the Nagios threshold ranges
+func TestParseRange(t *testing.T) {
+	for text, cases := range map[string]map[float64]bool{
+		"":       {-1: false, 100: false},
+		"10":     {-1: true, 0: false, 10: false, 11: true},
+		"10:":    {9: true, 10: false, 1000: false},
+		"~:10":   {-100: false, 10: false, 11: true},
+		"10:20":  {9: true, 15: false, 21: true},
+		"@10:20": {9: false, 10: true, 20: true, 21: false},
+	} {
+		r, err := ParseRange(text)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %q", text, err)
+		}
+		for value, expected := range cases {
+			if r.Alerts(value) != expected {
+				t.Fatalf("Invalid alert for %v in %q", value, text)
+			}
+		}
+	}
+	for _, text := range []string{"ten", "20:10", "1:2:3", "@"} {
+		if _, err := ParseRange(text); err == nil {
+			t.Fatalf("Expecting an error for %q", text)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ValidationError is an invalid value of the configuration, located by its path
+// and by the source it was read from: a file and its line, an environment
+// variable or a command-line flag
+type ValidationError struct {
+	Path    string
+	Source  string
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	message := e.Message
+	if e.Path != "" {
+		message = fmt.Sprintf("%s: %s", e.Path, message)
+	}
+	location := e.Source
+	if e.Line > 0 && location == "" {
+		location = fmt.Sprintf("line %d", e.Line)
+	} else if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, e.Line)
+	}
+	if location != "" {
+		message = fmt.Sprintf("%s: %s", location, message)
+	}
+	return message
+}
+
+// ValidationErrors holds all the invalid values of a configuration
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validator accumulates the errors found in a configuration
+type validator struct {
+	errors ValidationErrors
+}
+
+func (v *validator) check(valid bool, path string, format string, args ...interface{}) {
+	if !valid {
+		v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *validator) checkRange(value int, min int, max int, path string) {
+	v.check(value >= min && value <= max, path, "must be between %d and %d, got %d", min, max, value)
+}
+
+func (v *validator) checkOneOf(value string, allowed []string, path string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+	v.check(false, path, "must be one of %q, got %q", allowed, value)
+}
+
+func (v *validator) checkThreshold(threshold ThresholdConfig, path string) {
+	if _, err := ParseRange(threshold.Warning); err != nil {
+		v.check(false, path+".warning", "%s", err)
+	}
+	if _, err := ParseRange(threshold.Critical); err != nil {
+		v.check(false, path+".critical", "%s", err)
+	}
+}
+
+func (v *validator) checkURL(value string, schemes []string, path string) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		v.check(false, path, "must be a valid URL, got %q", value)
+		return
+	}
+	v.checkOneOf(parsed.Scheme, schemes, path)
+}
+
+func (v *validator) checkAddress(value string, path string) {
+	_, port, err := net.SplitHostPort(value)
+	v.check(err == nil && port != "", path, "must be a host:port address, got %q", value)
+}
+
+// Validate checks the values of the configuration, returning ValidationErrors when any is invalid
+func (config FullConfiguration) Validate() error {
+	v := &validator{}
+
+	server := config.Server
+	v.check(server.Host != "", "server.host", "must not be empty")
+	v.checkRange(server.Port, 1, 65535, "server.port")
+	v.checkRange(server.GRPCPort, 0, 65535, "server.grpc-port")
+	v.check(server.GRPCPort == 0 || server.GRPCPort != server.Port, "server.grpc-port", "must be different from server.port")
+	v.check(server.ShutdownTimeout >= 0, "server.shutdown-timeout", "must not be negative")
+	v.check((server.TLS.Cert == "") == (server.TLS.Key == ""), "server.tls", "cert and key must be set together")
+	v.check(server.TLS.ClientCA == "" || server.TLS.Cert != "", "server.tls.client-ca", "requires a server certificate")
+	v.checkOneOf(server.TLS.MinVersion, []string{"1.0", "1.1", "1.2", "1.3"}, "server.tls.min-version")
+	v.checkOneOf(server.TLS.CipherPolicy, []string{"intermediate", "modern"}, "server.tls.cipher-policy")
+	v.check(server.TLS.ReloadInterval >= 0, "server.tls.reload-interval", "must not be negative")
+	for i, token := range server.Auth.Tokens {
+		v.check(token.Name != "", fmt.Sprintf("server.auth.tokens[%d].name", i), "must not be empty")
+	}
+	for i, user := range server.Auth.Users {
+		v.check(user.Username != "", fmt.Sprintf("server.auth.users[%d].username", i), "must not be empty")
+	}
+	v.check(server.Access.RateLimit >= 0, "server.access.rate-limit", "must not be negative")
+	v.check(server.Access.RateBurst >= 0, "server.access.rate-burst", "must not be negative")
+
+	v.checkOneOf(strings.ToLower(config.Log.Level), []string{"trace", "debug", "info", "warn", "error", "critical", "off"}, "log.level")
+
+	probes := config.Probes
+	v.check(probes.Interval > 0, "probes.interval", "must be positive")
+	for i, service := range probes.SystemdServices {
+		v.check(strings.TrimSpace(service) != "", fmt.Sprintf("probes.systemd-services[%d]", i), "must not be empty")
+	}
+	if probes.DiskForecast.Enabled {
+		v.check(probes.DiskForecast.WindowHours > 0, "probes.disk-forecast.window-hours", "must be positive")
+		v.check(probes.DiskForecast.AlertWithinHours > 0, "probes.disk-forecast.alert-within-hours", "must be positive")
+	}
+	if probes.Processes.Enabled {
+		v.check(probes.Processes.Top > 0, "probes.processes.top", "must be positive")
+	}
+	for i, name := range probes.Processes.Names {
+		_, err := filepath.Match(name, "")
+		v.check(strings.TrimSpace(name) != "" && err == nil, fmt.Sprintf("probes.processes.names[%d]", i), "must be a valid pattern")
+	}
+
+	if config.History.Enabled {
+		history := config.History
+		v.checkOneOf(history.Storage, []string{"memory", "disk"}, "history.storage")
+		v.check(history.RetentionHours > 0, "history.retention-hours", "must be positive")
+		if history.Storage == "disk" {
+			v.check(history.DataDir != "", "history.data-dir", "must not be empty")
+			v.check(history.MaxSizeMB >= 0, "history.max-size-mb", "must not be negative")
+			v.check(history.DownsampleAfter >= 0, "history.downsample-after-hours", "must not be negative")
+			v.check(history.DownsampleInterval > 0, "history.downsample-interval", "must be positive")
+		}
+	}
+
+	outputs := config.Outputs
+	if outputs.Influx.WriteURL != "" {
+		v.checkURL(outputs.Influx.WriteURL, []string{"http", "https"}, "outputs.influxdb.write-url")
+		v.check(outputs.Influx.PushInterval > 0, "outputs.influxdb.push-interval", "must be positive")
+		v.check(outputs.Influx.BatchSize > 0, "outputs.influxdb.batch-size", "must be positive")
+		v.check(outputs.Influx.MaxRetries >= 0, "outputs.influxdb.max-retries", "must not be negative")
+		v.check(outputs.Influx.Timeout > 0, "outputs.influxdb.timeout", "must be positive")
+	}
+	if outputs.Statsd.Address != "" {
+		v.checkAddress(outputs.Statsd.Address, "outputs.statsd.address")
+		v.check(outputs.Statsd.MaxPacketSize > 0, "outputs.statsd.max-packet-size", "must be positive")
+	}
+	if outputs.Graphite.Address != "" {
+		v.checkAddress(outputs.Graphite.Address, "outputs.graphite.address")
+		v.check(outputs.Graphite.PushInterval > 0, "outputs.graphite.push-interval", "must be positive")
+		v.check(outputs.Graphite.MaxBuffer >= 0, "outputs.graphite.max-buffer", "must not be negative")
+		v.check(outputs.Graphite.Timeout > 0, "outputs.graphite.timeout", "must be positive")
+	}
+	if outputs.OTLP.Endpoint != "" {
+		v.checkOneOf(outputs.OTLP.Protocol, []string{"http/protobuf", "grpc"}, "outputs.otlp.protocol")
+		v.check(outputs.OTLP.PushInterval > 0, "outputs.otlp.push-interval", "must be positive")
+		v.check(outputs.OTLP.Timeout > 0, "outputs.otlp.timeout", "must be positive")
+	}
+	if outputs.MQTT.Broker != "" {
+		v.checkURL(outputs.MQTT.Broker, []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}, "outputs.mqtt.broker")
+		v.check(outputs.MQTT.Topic != "", "outputs.mqtt.topic", "must not be empty")
+		v.check(outputs.MQTT.Timeout > 0, "outputs.mqtt.timeout", "must be positive")
+	}
+	v.checkRange(outputs.MQTT.QoS, 0, 2, "outputs.mqtt.qos")
+
+	v.checkThreshold(config.Checks.Disk, "checks.disk")
+	v.checkThreshold(config.Checks.RAM, "checks.ram")
+	v.checkThreshold(config.Checks.Load, "checks.load")
+	v.checkThreshold(config.Checks.Uptime, "checks.uptime")
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+)
+
+// Test that the default configuration is valid and that every invalid value is reported
+func TestValidate(t *testing.T) {
+	config := NewConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	config.Server.Port = 70000
+	config.Server.TLS.Cert = "cert.pem"
+	config.Probes.Interval = 0
+	err := config.Validate()
+	errors, ok := err.(ValidationErrors)
+	if !ok || len(errors) != 3 {
+		t.Fatalf("Invalid errors %q", err)
+	}
+	if errors[0].Path != "server.port" || errors[1].Path != "server.tls" || errors[2].Path != "probes.interval" {
+		t.Fatalf("Invalid paths %q", err)
+	}
+}
+
+// Test the validation of the processes probe
+func TestValidateProcesses(t *testing.T) {
+	config := NewConfig()
+	config.Probes.Processes = ProcessesConfig{Enabled: true, Top: 0, Names: []string{"nginx*", "[invalid"}}
+	errors, ok := config.Validate().(ValidationErrors)
+	if !ok || len(errors) != 2 || errors[0].Path != "probes.processes.top" || errors[1].Path != "probes.processes.names[1]" {
+		t.Fatalf("Invalid errors %q", errors)
+	}
+}
@@ -0,0 +1,215 @@
+package webserver
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+const rateLimiterIdle = 10 * time.Minute
+
+// parseNetworks parses a list of CIDR ranges, single addresses being accepted as well
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(networks))
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid address %q", network)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, parsed, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// containsIP checks whether an address belongs to any of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket holds the tokens left to a client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket rate limiter keyed by client
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// allow consumes a token of the client, returning the time to wait for the next
+// one when the bucket is empty
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune forgets the clients idle for longer than the given duration
+func (l *rateLimiter) prune(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Run prunes the idle clients until stop is closed
+func (l *rateLimiter) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(rateLimiterIdle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.prune(rateLimiterIdle)
+		}
+	}
+}
+
+// accessControl restricts the API to the allowed networks and rate limits its clients
+type accessControl struct {
+	allowed []*net.IPNet
+	proxies []*net.IPNet
+	limiter *rateLimiter
+}
+
+// newAccessControl parses the access configuration
+func newAccessControl(config utils.AccessConfig) (*accessControl, error) {
+	allowed, err := parseNetworks(config.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid allowed network: %w", err)
+	}
+	proxies, err := parseNetworks(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid trusted proxy: %w", err)
+	}
+	access := &accessControl{allowed: allowed, proxies: proxies}
+	if config.RateLimit > 0 {
+		access.limiter = newRateLimiter(config.RateLimit, config.RateBurst)
+	}
+	return access, nil
+}
+
+// clientIP returns the address of the client, read from the X-Forwarded-For
+// header when the request comes from a trusted proxy
+func (a *accessControl) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(a.proxies, ip) {
+		return ip
+	}
+
+	// Every proxy appends the address it received the request from, so the
+	// client is the last address that is not a trusted proxy
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(a.proxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// admit checks the client of a request, returning the status and the reason of the
+// denial, or the time to wait when the client is rate limited
+func (a *accessControl) admit(r *http.Request) (int, string, time.Duration) {
+	ip := a.clientIP(r)
+	if ip == nil {
+		return http.StatusForbidden, "Unknown client address", 0
+	}
+	if len(a.allowed) > 0 && !containsIP(a.allowed, ip) {
+		return http.StatusForbidden, fmt.Sprintf("Address %s is not allowed", ip), 0
+	}
+	if a.limiter != nil {
+		if ok, wait := a.limiter.allow(ip.String()); !ok {
+			log.Debugf("Rate limiting %s %s from %s", r.Method, r.URL.Path, ip)
+			return http.StatusTooManyRequests, "Too many requests", wait
+		}
+	}
+	return http.StatusOK, "", 0
+}
+
+// Handler checks the client of the API requests before handing them to next
+func (a *accessControl) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch status, reason, wait := a.admit(r); status {
+		case http.StatusForbidden:
+			auditDenied(r, status, reason)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
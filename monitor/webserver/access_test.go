@@ -0,0 +1,108 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the token bucket refill
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	limiter := newRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("client"); !ok {
+			t.Fatalf("Request %d should be allowed by the burst", i)
+		}
+	}
+	ok, wait := limiter.allow("client")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("Expecting to wait 500ms, got %s", wait)
+	}
+	if ok, _ := limiter.allow("other"); !ok {
+		t.Fatal("Clients should have their own buckets")
+	}
+
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("client"); !ok {
+			t.Fatalf("Request %d should be allowed after refill", i)
+		}
+	}
+	if ok, _ := limiter.allow("client"); ok {
+		t.Fatal("Expecting the bucket to be empty")
+	}
+
+	now = now.Add(time.Hour)
+	limiter.prune(time.Minute)
+	if len(limiter.buckets) != 0 {
+		t.Fatal("Expecting idle clients to be pruned")
+	}
+}
+
+// Test the resolution of the client address behind proxies
+func TestClientIP(t *testing.T) {
+	access, err := newAccessControl(utils.AccessConfig{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	for _, test := range []struct {
+		remote    string
+		forwarded string
+		expected  string
+	}{
+		{"203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"192.168.1.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"192.168.1.1:1234", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"192.168.1.1:1234", "198.51.100.9, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"192.168.1.1:1234", "", "192.168.1.1"},
+		{"192.168.1.1:1234", "invalid, 10.0.0.2", "10.0.0.2"},
+	} {
+		r := httptest.NewRequest("GET", "/api/stats", nil)
+		r.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if ip := access.clientIP(r); ip.String() != test.expected {
+			t.Fatalf("Expecting %s for %q, got %s", test.expected, test.forwarded, ip)
+		}
+	}
+}
+
+// Test that only the API is restricted to the allowed networks and rate limited
+func TestAccessHandler(t *testing.T) {
+	access, err := newAccessControl(utils.AccessConfig{AllowedNetworks: []string{"127.0.0.0/8", "::1"}, RateLimit: 1, RateBurst: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	handler := access.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range []struct {
+		remote string
+		path   string
+		status int
+	}{
+		{"127.0.0.1:1234", "/api/stats", http.StatusOK},
+		{"127.0.0.1:1234", "/api/stats", http.StatusTooManyRequests},
+		{"[::1]:1234", "/api/stats", http.StatusOK},
+		{"203.0.113.5:1234", "/api/stats", http.StatusForbidden},
+		{"203.0.113.5:1234", "/", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = test.remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Fatalf("Expecting status %d for %s on %s, got %d", test.status, test.remote, test.path, w.Code)
+		}
+	}
+
+	if _, err := newAccessControl(utils.AccessConfig{AllowedNetworks: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("Expecting an error for an invalid network")
+	}
+}
@@ -0,0 +1,480 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/rpc"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// front holds the components answering the HTTP requests for a configuration
+type front struct {
+	authenticators []authMethod
+	access         *accessControl
+	handler        http.Handler
+	tls            *certReloader
+	limiter        *rateLimiter
+	stop           chan struct{}
+}
+
+// start runs the background tasks of the front until its stop channel is closed
+func (f *front) start(background *sync.WaitGroup) {
+	tasks := []func(stop <-chan struct{}){}
+	if f.limiter != nil {
+		tasks = append(tasks, f.limiter.Run)
+	}
+	if f.tls != nil {
+		tasks = append(tasks, f.tls.Run)
+	}
+	for _, task := range tasks {
+		background.Add(1)
+		go func(task func(stop <-chan struct{})) {
+			defer background.Done()
+			task(f.stop)
+		}(task)
+	}
+}
+
+// httpServer is a server bound to the listening address
+type httpServer struct {
+	address  string
+	listener net.Listener
+	server   *http.Server
+}
+
+// tlsSwitchListener wraps the accepted connections in TLS when the current front requires it,
+// so that enabling or disabling TLS does not require to bind the address again
+type tlsSwitchListener struct {
+	net.Listener
+	current func() *front
+}
+
+func (l *tlsSwitchListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if reloader := l.current().tls; reloader != nil {
+		return tls.Server(conn, reloader.TLSConfig()), nil
+	}
+	return conn, nil
+}
+
+// agent runs the server components and applies the configuration changes
+type agent struct {
+	config    utils.FullConfiguration
+	collector *collector.Collector
+	front     atomic.Value
+
+	// stop ends the streams and the collection when the agent shuts down
+	stop        chan struct{}
+	background  sync.WaitGroup
+	serveErrors chan error
+
+	store              history.Store
+	unsubscribeHistory func()
+	outputs            *outputGroup
+	grpc               *grpcServer
+	http               *httpServer
+}
+
+// grpcServer is a gRPC server bound to the listening address
+type grpcServer struct {
+	address string
+	server  *rpc.Server
+}
+
+// newAgent creates an agent without any component, started by applying a configuration
+func newAgent(config utils.FullConfiguration) *agent {
+	return &agent{
+		collector:   collector.New(config.Probes),
+		stop:        make(chan struct{}),
+		serveErrors: make(chan error, 1),
+	}
+}
+
+// currentFront returns the front of the applied configuration
+func (a *agent) currentFront() *front {
+	return a.front.Load().(*front)
+}
+
+// ServeHTTP hands the requests to the current front
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.currentFront().handler.ServeHTTP(w, r)
+}
+
+// newFront checks the authentication, access and TLS settings of a configuration,
+// the handler being set once the history store is known
+func (a *agent) newFront(config utils.FullConfiguration) (*front, error) {
+	authenticators, err := newAuthenticators(config.Server.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid authentication configuration: %w", err)
+	}
+	access, err := newAccessControl(config.Server.Access)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid access configuration: %w", err)
+	}
+	f := &front{authenticators: authenticators, access: access, limiter: access.limiter, stop: make(chan struct{})}
+	if config.Server.TLS.Cert != "" {
+		if f.tls, err = newCertReloader(config.Server.TLS); err != nil {
+			return nil, fmt.Errorf("Impossible to load TLS certificates: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// routes registers the endpoints enabled by the configuration
+func (a *agent) routes(config utils.FullConfiguration, store history.Store, authenticators []authMethod) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/stats", requireScope(authenticators, scopeReadStats, func(w http.ResponseWriter, r *http.Request) {
+		statsHandler(a.collector, w, r)
+	}))
+	mux.HandleFunc("/api/stats/", requireScope(authenticators, scopeReadStats, func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(config.Probes, a.collector, w, r)
+	}))
+
+	if store != nil {
+		mux.HandleFunc("/api/history", requireScope(authenticators, scopeReadStats, func(w http.ResponseWriter, r *http.Request) {
+			historyHandler(store, w, r)
+		}))
+	}
+
+	mux.HandleFunc("/api/alerts", requireScope(authenticators, scopeReadAlerts, func(w http.ResponseWriter, r *http.Request) {
+		alertsHandler(a.collector, w, r)
+	}))
+
+	mux.HandleFunc("/api/config", requireScope(authenticators, scopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		configHandler(config, w, r)
+	}))
+
+	if config.Server.Dashboard {
+		mux.Handle("/", dashboardHandler())
+	}
+
+	if config.Outputs.Influx.Endpoint {
+		mux.HandleFunc("/api/influx", requireScope(authenticators, scopeReadStats, func(w http.ResponseWriter, r *http.Request) {
+			influxHandler(config, a.collector, w, r)
+		}))
+	}
+
+	mux.HandleFunc("/api/v1/stream", requireScope(authenticators, scopeReadStats, func(w http.ResponseWriter, r *http.Request) {
+		streamHandler(a.collector, a.stop, w, r)
+	}))
+	mux.HandleFunc("/api/v1/ws", requireAnyScope(authenticators, []string{scopeReadStats, scopeReadAlerts}, func(w http.ResponseWriter, r *http.Request) {
+		websocketHandler(a.collector, a.stop, w, r)
+	}))
+	return mux
+}
+
+// listen binds the address of a configuration, requests being served once serve is called
+func (a *agent) listen(address string) (*httpServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &httpServer{address: address, listener: listener, server: &http.Server{Handler: a}}, nil
+}
+
+// serve handles the requests of a bound server until it is shut down
+func (a *agent) serve(s *httpServer) {
+	log.Debugf("Server listening on %q", s.address)
+	go func() {
+		err := s.server.Serve(&tlsSwitchListener{Listener: s.listener, current: a.currentFront})
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case a.serveErrors <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// serveGRPC handles the gRPC calls on a bound listener until the server is stopped,
+// the connections being wrapped in TLS like the HTTP ones
+func (a *agent) serveGRPC(server *rpc.Server, listener net.Listener) {
+	go func() {
+		if err := server.Serve(&tlsSwitchListener{Listener: listener, current: a.currentFront}); err != nil {
+			select {
+			case a.serveErrors <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// stopGRPC stops a gRPC server, waiting for the calls in flight until the timeout
+// and closing the remaining connections afterwards
+func stopGRPC(server *rpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		log.Warnf("gRPC calls still in flight after %s, closing connections", timeout)
+		server.Stop()
+		<-stopped
+	}
+	log.Info("gRPC server stopped")
+}
+
+// openStore opens the history store of a new configuration. The current store is
+// closed first when both use the same directory, and reopened if the new one fails.
+func (a *agent) openStore(previous utils.HistoryConfig, config utils.HistoryConfig, initial bool) (history.Store, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	sameDir := a.store != nil && previous.Storage == "disk" && config.Storage == "disk" && previous.DataDir == config.DataDir
+	if sameDir {
+		a.unsubscribeHistory()
+		a.collector.SetHistory(nil)
+		a.store.Close()
+		a.unsubscribeHistory, a.store = nil, nil
+	}
+
+	store, err := openHistoryStore(config)
+	if err == nil {
+		return store, nil
+	}
+	if initial {
+		log.Errorf("Impossible to open history store, history disabled: %q", err)
+		return nil, nil
+	}
+	if sameDir {
+		reopened, reopenErr := openHistoryStore(previous)
+		if reopenErr != nil {
+			log.Errorf("Impossible to reopen history store, history disabled: %q", reopenErr)
+		} else {
+			a.store = reopened
+			a.unsubscribeHistory = a.collector.Subscribe(recordHistory(a.store))
+			a.collector.SetHistory(a.store)
+		}
+	}
+	return nil, fmt.Errorf("Impossible to open history store: %w", err)
+}
+
+// apply validates a configuration and swaps it in place of the current one. Nothing
+// is changed when an error is returned.
+func (a *agent) apply(config utils.FullConfiguration) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	initial := a.http == nil
+	previous := a.config
+
+	// Prepare the components that may fail before changing anything
+	f, err := a.newFront(config)
+	if err != nil {
+		return err
+	}
+	var logger log.LoggerInterface
+	if initial || previous.Log.Level != config.Log.Level {
+		if logger, err = utils.NewLogger(config.Log); err != nil {
+			return err
+		}
+	}
+
+	address := fmt.Sprintf("%s:%d", config.Server.Host, config.Server.Port)
+	server := a.http
+	if initial || address != a.http.address {
+		// The new address is bound before releasing the previous one, so that
+		// the server keeps listening when the new address is not available
+		if server, err = a.listen(address); err != nil {
+			return err
+		}
+	}
+
+	grpcAddress := ""
+	if config.Server.GRPCPort != 0 {
+		grpcAddress = fmt.Sprintf("%s:%d", config.Server.Host, config.Server.GRPCPort)
+	}
+	var grpcListener net.Listener
+	if grpcAddress != "" && (a.grpc == nil || grpcAddress != a.grpc.address) {
+		if grpcListener, err = net.Listen("tcp", grpcAddress); err != nil {
+			if server != a.http {
+				server.listener.Close()
+			}
+			return err
+		}
+	}
+
+	// The store is only opened again when its backend or directory changes, the
+	// other settings being applied to the open store
+	store := a.store
+	historyChanged := initial || !reflect.DeepEqual(previous.History, config.History)
+	reopenHistory := historyChanged && (initial || a.store == nil || !sameHistoryStore(previous.History, config.History))
+	if reopenHistory {
+		if store, err = a.openStore(previous.History, config.History, initial); err != nil {
+			if server != a.http {
+				server.listener.Close()
+			}
+			if grpcListener != nil {
+				grpcListener.Close()
+			}
+			return err
+		}
+	}
+	f.handler = f.access.Handler(a.routes(config, store, f.authenticators))
+
+	// Swap the components
+	if logger != nil {
+		log.ReplaceLogger(logger)
+	}
+	if !initial && !reflect.DeepEqual(previous.Probes, config.Probes) {
+		a.collector.Reconfigure(config.Probes)
+	}
+
+	if reopenHistory {
+		if a.unsubscribeHistory != nil {
+			a.unsubscribeHistory()
+			a.unsubscribeHistory = nil
+		}
+		a.collector.SetHistory(store)
+		if a.store != nil {
+			if previous.History.Storage != "disk" {
+				log.Warn("Discarding the history kept in memory")
+			}
+			a.store.Close()
+		}
+		a.store = store
+		if store != nil {
+			a.unsubscribeHistory = a.collector.Subscribe(recordHistory(store))
+		}
+	} else if historyChanged && store != nil {
+		reconfigureHistoryStore(store, config.History)
+	}
+
+	var previousFront *front
+	if !initial {
+		previousFront = a.currentFront()
+	}
+	a.front.Store(f)
+	f.start(&a.background)
+	if previousFront != nil {
+		close(previousFront.stop)
+	}
+
+	if server != a.http {
+		if a.http != nil {
+			log.Infof("Moving server from %q to %q", a.http.address, server.address)
+			previousServer := a.http.server
+			timeout := time.Duration(config.Server.ShutdownTimeout) * time.Second
+			a.background.Add(1)
+			go func() {
+				defer a.background.Done()
+				shutdown(previousServer, func() {}, timeout)
+			}()
+		}
+		a.http = server
+		a.serve(server)
+	}
+
+	if initial || !reflect.DeepEqual(previous.Outputs, config.Outputs) {
+		if a.outputs != nil {
+			a.outputs.Stop()
+		}
+		a.outputs = startOutputs(config.Outputs, a.collector)
+	}
+
+	if a.grpc != nil && grpcAddress != a.grpc.address {
+		log.Infof("Stopping gRPC server on %q", a.grpc.address)
+		previousServer := a.grpc.server
+		timeout := time.Duration(config.Server.ShutdownTimeout) * time.Second
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			stopGRPC(previousServer, timeout)
+		}()
+		a.grpc = nil
+	}
+	if grpcListener != nil {
+		a.grpc = &grpcServer{address: grpcAddress, server: rpc.NewServer(config.Probes, a.collector, grpcOptions(a.currentFront)...)}
+		a.serveGRPC(a.grpc.server, grpcListener)
+	} else if a.grpc != nil && !reflect.DeepEqual(previous.Probes, config.Probes) {
+		// The calls in flight are kept when only the probes change
+		a.grpc.server.Reconfigure(config.Probes)
+	}
+
+	if initial {
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			a.collector.Run(a.stop)
+		}()
+	}
+	a.config = config
+	return nil
+}
+
+// reload reads the configuration again and applies it, keeping the current one on error
+func (a *agent) reload(load func() (utils.FullConfiguration, error)) {
+	if load == nil {
+		log.Warn("Configuration reload is not available")
+		return
+	}
+	log.Info("Reloading configuration")
+	config, err := load()
+	if err != nil {
+		log.Errorf("Impossible to read configuration, keeping the previous one: %q", err)
+		return
+	}
+
+	changes := utils.DiffConfig(a.config, config)
+	if len(changes) == 0 {
+		log.Info("Configuration unchanged")
+		return
+	}
+	if err := a.apply(config); err != nil {
+		log.Errorf("Invalid configuration, keeping the previous one: %q", err)
+		for _, change := range changes {
+			log.Warnf("Rejected change %s", change)
+		}
+		return
+	}
+	for _, change := range changes {
+		log.Infof("Applied change %s", change)
+	}
+}
+
+// shutdown stops all the components, waiting for the requests in flight until the timeout
+func (a *agent) shutdown() {
+	// Streams only end when the background tasks stop, so they are stopped first
+	stopFront := func() {
+		close(a.stop)
+		close(a.currentFront().stop)
+	}
+	timeout := time.Duration(a.config.Server.ShutdownTimeout) * time.Second
+	grpcStopped := make(chan struct{})
+	go func() {
+		if a.grpc != nil {
+			stopGRPC(a.grpc.server, timeout)
+		}
+		close(grpcStopped)
+	}()
+	shutdown(a.http.server, stopFront, timeout)
+	<-grpcStopped
+	a.outputs.Stop()
+	a.background.Wait()
+	if a.unsubscribeHistory != nil {
+		a.unsubscribeHistory()
+	}
+	if a.store != nil {
+		a.store.Close()
+	}
+}
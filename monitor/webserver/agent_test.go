@@ -0,0 +1,213 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// freePort returns a port available on the loopback interface
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// testAgentConfig returns a configuration without probes or outputs
+func testAgentConfig(t *testing.T) utils.FullConfiguration {
+	config := utils.NewConfig()
+	config.Server.Port = freePort(t)
+	config.Probes = utils.ProbesConfig{Interval: 60}
+	config.Outputs.Influx.Endpoint = false
+	config.Server.ShutdownTimeout = 1
+	return config
+}
+
+// getStatus returns the status of a request, or 0 when the server cannot be reached
+func getStatus(client *http.Client, url string) int {
+	response, err := client.Get(url)
+	if err != nil {
+		return 0
+	}
+	response.Body.Close()
+	return response.StatusCode
+}
+
+// Test that the configuration changes are applied without stopping the server,
+// and that invalid ones are rejected
+func TestAgentApply(t *testing.T) {
+	config := testAgentConfig(t)
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+	firstURL := fmt.Sprintf("http://127.0.0.1:%d/api/stats", config.Server.Port)
+	if status := getStatus(http.DefaultClient, firstURL); status != http.StatusOK {
+		t.Fatalf("Invalid status %d", status)
+	}
+
+	// Authentication is enabled on the same listener
+	reloaded := config
+	reloaded.Server.Auth = utils.AuthConfig{Tokens: []utils.TokenConfig{{Name: "test", Hash: hashToken("token"), Scopes: []string{scopeReadStats}}}}
+	reloaded.Probes.Interval = 30
+	if err := a.apply(reloaded); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if status := getStatus(http.DefaultClient, firstURL); status != http.StatusUnauthorized {
+		t.Fatalf("Expecting authentication to be required, got %d", status)
+	}
+	if a.collector.Interval() != 30*time.Second {
+		t.Fatal("Probes not reconfigured")
+	}
+
+	// Invalid configurations are rejected
+	invalid := reloaded
+	invalid.Server.Auth = utils.AuthConfig{Tokens: []utils.TokenConfig{{Name: "test", Hash: "token"}}}
+	if err := a.apply(invalid); err == nil {
+		t.Fatal("Expecting an error for an invalid token hash")
+	}
+	invalid = reloaded
+	invalid.Probes.Interval = 0
+	if err := a.apply(invalid); err == nil {
+		t.Fatal("Expecting a validation error")
+	}
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+	invalid = reloaded
+	invalid.Server.Port = occupied.Addr().(*net.TCPAddr).Port
+	if err := a.apply(invalid); err == nil {
+		t.Fatal("Expecting an error when the port is in use")
+	}
+	if status := getStatus(http.DefaultClient, firstURL); status != http.StatusUnauthorized || a.config.Server.Port != config.Server.Port {
+		t.Fatal("Expecting the previous configuration to be kept")
+	}
+
+	// The server moves to the new port
+	moved := reloaded
+	moved.Server.Port = freePort(t)
+	if err := a.apply(moved); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	secondURL := fmt.Sprintf("http://127.0.0.1:%d/api/stats", moved.Server.Port)
+	if status := getStatus(http.DefaultClient, secondURL); status != http.StatusUnauthorized {
+		t.Fatalf("Expecting the server on the new port, got %d", status)
+	}
+	for i := 0; getStatus(http.DefaultClient, firstURL) != 0; i++ {
+		if i == 20 {
+			t.Fatal("Expecting the previous port to be released")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Test that TLS is enabled without binding the address again
+func TestAgentEnableTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey, _, _ := testCertificate(t, 1, nil, nil)
+	_, _, certPEM, keyPEM := testCertificate(t, 2, ca, caKey)
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600)
+
+	config := testAgentConfig(t)
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+
+	secure := config
+	secure.Server.TLS.Cert = filepath.Join(dir, "cert.pem")
+	secure.Server.TLS.Key = filepath.Join(dir, "key.pem")
+	if err := a.apply(secure); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if status := getStatus(client, fmt.Sprintf("https://127.0.0.1:%d/api/stats", config.Server.Port)); status != http.StatusOK {
+		t.Fatalf("Invalid status %d", status)
+	}
+}
+
+// Test that reloading keeps the current configuration when the new one cannot be read
+func TestAgentReload(t *testing.T) {
+	config := testAgentConfig(t)
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+
+	a.reload(func() (utils.FullConfiguration, error) {
+		return utils.FullConfiguration{}, fmt.Errorf("Unreadable")
+	})
+	if a.config.Probes.Interval != 60 {
+		t.Fatal("Expecting the configuration to be kept")
+	}
+
+	reloaded := config
+	reloaded.Probes.RAMUsage = true
+	a.reload(func() (utils.FullConfiguration, error) {
+		return reloaded, nil
+	})
+	if !a.config.Probes.RAMUsage {
+		t.Fatal("Expecting the configuration to be reloaded")
+	}
+}
+
+// Test that reloading keeps the history store unless its backend or directory changes
+func TestAgentReloadHistory(t *testing.T) {
+	config := testAgentConfig(t)
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+	store := a.store
+	store.Append([]history.Entry{{Series: "uptime.seconds", Point: history.Point{Timestamp: time.Now().Unix(), Value: 60}}})
+
+	reloaded := config
+	reloaded.History.RetentionHours = 48
+	reloaded.History.DownsampleInterval = 600
+	if err := a.apply(reloaded); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if a.store != store {
+		t.Fatal("Expecting the history store to be kept")
+	}
+	if series, _ := a.store.Series(); len(series) != 1 {
+		t.Fatalf("Expecting the history to be kept, got %q", series)
+	}
+
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	reloaded.History.Storage = "disk"
+	reloaded.History.DataDir = dir
+	if err := a.apply(reloaded); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if _, ok := a.store.(*history.DiskStore); !ok {
+		t.Fatal("Expecting the history store to be opened again")
+	}
+}
@@ -0,0 +1,280 @@
+package webserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// Scopes granted to the API credentials
+const (
+	scopeReadStats  = "read:stats"
+	scopeReadAlerts = "read:alerts"
+	scopeAdmin      = "admin"
+)
+
+var errInvalidCredentials = errors.New("Invalid credentials")
+
+// identity is an authenticated client of the API
+type identity struct {
+	name   string
+	scopes map[string]bool
+}
+
+// allows checks whether the identity was granted a scope, admin granting all of them
+func (i *identity) allows(scope string) bool {
+	return i.scopes[scope] || i.scopes[scopeAdmin]
+}
+
+// authMethod identifies the client of a request. It returns a nil identity
+// when the request does not carry its kind of credentials, and an error when
+// they are invalid.
+type authMethod interface {
+	Authenticate(r *http.Request) (*identity, error)
+	// Challenge is the WWW-Authenticate header sent to unauthenticated clients
+	Challenge() string
+}
+
+// parseScopes validates the configured scopes
+func parseScopes(scopes []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, scope := range scopes {
+		switch scope {
+		case scopeReadStats, scopeReadAlerts, scopeAdmin:
+			result[scope] = true
+		default:
+			return nil, fmt.Errorf("Unknown scope %q", scope)
+		}
+	}
+	return result, nil
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of a token, as stored in the configuration
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenAuthenticator accepts static bearer tokens
+type tokenAuthenticator struct {
+	tokens map[string]*identity
+}
+
+func newTokenAuthenticator(tokens []utils.TokenConfig) (*tokenAuthenticator, error) {
+	authenticator := &tokenAuthenticator{tokens: make(map[string]*identity)}
+	for _, token := range tokens {
+		hash, err := hex.DecodeString(token.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("Invalid SHA-256 hash for token %q", token.Name)
+		}
+		scopes, err := parseScopes(token.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("Token %q: %w", token.Name, err)
+		}
+		authenticator.tokens[strings.ToLower(token.Hash)] = &identity{name: "token:" + token.Name, scopes: scopes}
+	}
+	return authenticator, nil
+}
+
+// Authenticate looks up the hash of the bearer token of the request
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (*identity, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, nil
+	}
+	client, ok := a.tokens[hashToken(strings.TrimPrefix(header, "Bearer "))]
+	if !ok {
+		return nil, errInvalidCredentials
+	}
+	return client, nil
+}
+
+// Challenge asks for a bearer token
+func (a *tokenAuthenticator) Challenge() string {
+	return `Bearer realm="system-monitor"`
+}
+
+// basicUser is a user allowed to authenticate with HTTP basic auth
+type basicUser struct {
+	identity
+	hash []byte
+}
+
+// basicAuthenticator accepts users with bcrypt-hashed passwords
+type basicAuthenticator struct {
+	users map[string]*basicUser
+	// dummyHash is checked for unknown users, so that they take as long to be
+	// rejected as wrong passwords and cannot be told apart
+	dummyHash []byte
+
+	// bcrypt is purposely slow, so the last valid password of every user is
+	// remembered to avoid checking it on every request
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte
+}
+
+func newBasicAuthenticator(users []utils.UserConfig) (*basicAuthenticator, error) {
+	authenticator := &basicAuthenticator{users: make(map[string]*basicUser), verified: make(map[string][sha256.Size]byte)}
+	maxCost := bcrypt.MinCost
+	for _, user := range users {
+		cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bcrypt hash for user %q: %w", user.Username, err)
+		}
+		if cost > maxCost {
+			maxCost = cost
+		}
+		scopes, err := parseScopes(user.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("User %q: %w", user.Username, err)
+		}
+		authenticator.users[user.Username] = &basicUser{
+			identity: identity{name: "user:" + user.Username, scopes: scopes},
+			hash:     []byte(user.PasswordHash),
+		}
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("system-monitor"), maxCost)
+	if err != nil {
+		return nil, err
+	}
+	authenticator.dummyHash = dummyHash
+	return authenticator, nil
+}
+
+// Authenticate checks the username and password of the request
+func (a *basicAuthenticator) Authenticate(r *http.Request) (*identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	user, ok := a.users[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, errInvalidCredentials
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	a.mu.Lock()
+	verified, ok := a.verified[username]
+	a.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(sum[:], verified[:]) == 1 {
+		return &user.identity, nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.hash, []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+	a.mu.Lock()
+	a.verified[username] = sum
+	a.mu.Unlock()
+	return &user.identity, nil
+}
+
+// Challenge asks for a username and password
+func (a *basicAuthenticator) Challenge() string {
+	return `Basic realm="system-monitor"`
+}
+
+// newAuthenticators creates the authenticators for the configured credentials,
+// returning none when authentication is disabled
+func newAuthenticators(config utils.AuthConfig) ([]authMethod, error) {
+	authenticators := []authMethod{}
+	if len(config.Tokens) > 0 {
+		tokens, err := newTokenAuthenticator(config.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if len(config.Users) > 0 {
+		users, err := newBasicAuthenticator(config.Users)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, users)
+	}
+	return authenticators, nil
+}
+
+// auditDenied logs a request rejected by the authentication
+func auditDenied(r *http.Request, status int, reason string) {
+	log.Warnf("Denied %s %s from %q with status %d: %s", r.Method, r.URL.Path, r.RemoteAddr, status, reason)
+}
+
+// identityKey is the context key of the identity of an authenticated request
+type identityKey struct{}
+
+// authorize identifies the client of a request and checks that it has one of the
+// scopes, returning the status and the reason of the denial otherwise
+func authorize(authenticators []authMethod, r *http.Request, scopes []string) (*identity, int, string) {
+	for _, authenticator := range authenticators {
+		client, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, http.StatusUnauthorized, err.Error()
+		}
+		if client == nil {
+			continue
+		}
+		for _, scope := range scopes {
+			if client.allows(scope) {
+				return client, http.StatusOK, ""
+			}
+		}
+		return nil, http.StatusForbidden, fmt.Sprintf("%s is missing scope %q", client.name, strings.Join(scopes, `" or "`))
+	}
+	return nil, http.StatusUnauthorized, "Missing credentials"
+}
+
+// requireScope only lets through the requests authenticated with the given scope
+func requireScope(authenticators []authMethod, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return requireAnyScope(authenticators, []string{scope}, next)
+}
+
+// requireAnyScope only lets through the requests authenticated with one of the
+// scopes, the identity of the client being kept in the request context
+func requireAnyScope(authenticators []authMethod, scopes []string, next http.HandlerFunc) http.HandlerFunc {
+	if len(authenticators) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, status, reason := authorize(authenticators, r, scopes)
+		switch status {
+		case http.StatusOK:
+			next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, client)))
+		case http.StatusForbidden:
+			auditDenied(r, status, reason)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			auditDenied(r, status, reason)
+			unauthorized(authenticators, w)
+		}
+	}
+}
+
+// requestAllows checks whether the client of a request has a scope, all of them
+// being granted when authentication is disabled
+func requestAllows(r *http.Request, scope string) bool {
+	client, ok := r.Context().Value(identityKey{}).(*identity)
+	return !ok || client.allows(scope)
+}
+
+// unauthorized asks the client to authenticate with any of the methods
+func unauthorized(authenticators []authMethod, w http.ResponseWriter) {
+	for _, authenticator := range authenticators {
+		w.Header().Add("WWW-Authenticate", authenticator.Challenge())
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,94 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the status returned for the various credentials
+func TestRequireScope(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	authenticators, err := newAuthenticators(utils.AuthConfig{
+		Tokens: []utils.TokenConfig{
+			{Name: "reader", Hash: hashToken("reader-token"), Scopes: []string{scopeReadStats}},
+			{Name: "alerts", Hash: hashToken("alerts-token"), Scopes: []string{scopeReadAlerts}},
+			{Name: "admin", Hash: hashToken("admin-token"), Scopes: []string{scopeAdmin}},
+		},
+		Users: []utils.UserConfig{{Username: "user", PasswordHash: string(hash), Scopes: []string{scopeReadStats}}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	handler := requireScope(authenticators, scopeReadStats, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, test := range []struct {
+		setup  func(r *http.Request)
+		status int
+	}{
+		{func(r *http.Request) {}, http.StatusUnauthorized},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer reader-token") }, http.StatusOK},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin-token") }, http.StatusOK},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer alerts-token") }, http.StatusForbidden},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong-token") }, http.StatusUnauthorized},
+		{func(r *http.Request) { r.SetBasicAuth("user", "secret") }, http.StatusOK},
+		{func(r *http.Request) { r.SetBasicAuth("user", "secret") }, http.StatusOK},
+		{func(r *http.Request) { r.SetBasicAuth("user", "wrong") }, http.StatusUnauthorized},
+		{func(r *http.Request) { r.SetBasicAuth("other", "secret") }, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/api/stats", nil)
+		test.setup(r)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.status {
+			t.Fatalf("Expecting status %d for %q, got %d", test.status, r.Header.Get("Authorization"), w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && len(w.Header()["Www-Authenticate"]) != 2 {
+			t.Fatal("Missing authentication challenges")
+		}
+	}
+}
+
+// Test that authentication is disabled without credentials, and that invalid ones are rejected
+func TestNewAuthenticators(t *testing.T) {
+	authenticators, err := newAuthenticators(utils.AuthConfig{})
+	if err != nil || len(authenticators) != 0 {
+		t.Fatal("Expecting authentication to be disabled")
+	}
+
+	for _, config := range []utils.AuthConfig{
+		{Tokens: []utils.TokenConfig{{Name: "token", Hash: "plain-token"}}},
+		{Tokens: []utils.TokenConfig{{Name: "token", Hash: hashToken("token"), Scopes: []string{"write"}}}},
+		{Users: []utils.UserConfig{{Username: "user", PasswordHash: "secret"}}},
+	} {
+		if _, err := newAuthenticators(config); err == nil {
+			t.Fatalf("Expecting an error for %+v", config)
+		}
+	}
+}
+
+// Test that the handlers can check the scopes of the authenticated client
+func TestRequireAnyScope(t *testing.T) {
+	authenticators, _ := newAuthenticators(utils.AuthConfig{
+		Tokens: []utils.TokenConfig{{Name: "alerts", Hash: hashToken("alerts-token"), Scopes: []string{scopeReadAlerts}}},
+	})
+	var readStats, readAlerts bool
+	handler := requireAnyScope(authenticators, []string{scopeReadStats, scopeReadAlerts}, func(w http.ResponseWriter, r *http.Request) {
+		readStats, readAlerts = requestAllows(r, scopeReadStats), requestAllows(r, scopeReadAlerts)
+	})
+	r := httptest.NewRequest("GET", "/api/v1/ws", nil)
+	r.Header.Set("Authorization", "Bearer alerts-token")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK || readStats || !readAlerts {
+		t.Fatalf("Invalid scopes, status %d", w.Code)
+	}
+
+	if !requestAllows(httptest.NewRequest("GET", "/api/v1/ws", nil), scopeAdmin) {
+		t.Fatal("Expecting every scope to be granted without authentication")
+	}
+}
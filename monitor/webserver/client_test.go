@@ -0,0 +1,74 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/client"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the client package against a running agent
+func TestClient(t *testing.T) {
+	config := testAgentConfig(t)
+	config.Probes.RAMUsage = true
+	config.Probes.Uptime = true
+	config.Probes.Processes = utils.ProcessesConfig{Enabled: true, Top: 3}
+	config.Server.Auth = utils.AuthConfig{Tokens: []utils.TokenConfig{{Name: "test", Hash: hashToken("token"), Scopes: []string{scopeReadStats}}}}
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+
+	ctx := context.Background()
+	c, err := client.New(fmt.Sprintf("http://127.0.0.1:%d", config.Server.Port), client.Options{Token: "token", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Stats(ctx)
+	if err != nil || result.Uptime == 0 || result.DiskUsage != nil {
+		t.Fatalf("Invalid stats %+v: %v", result, err)
+	}
+	if uptime, err := c.Uptime(ctx); err != nil || uptime < time.Second {
+		t.Fatalf("Invalid uptime %s: %v", uptime, err)
+	}
+
+	if processes, err := c.Processes(ctx); err != nil || processes.Count == 0 || len(processes.ByMemory) != 3 {
+		t.Fatalf("Invalid processes %+v: %v", processes, err)
+	}
+
+	// Disabled probes are not found
+	var statusErr *client.StatusError
+	if _, err := c.DiskUsage(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expecting a not found error, got %v", err)
+	}
+
+	if _, err := c.Series(ctx); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	points, err := c.History(ctx, "uptime", time.Now().Add(-time.Minute), time.Time{})
+	if err != nil || points.Series != "uptime" {
+		t.Fatalf("Invalid history %+v: %v", points, err)
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var event client.Event
+	err = c.Stream(streamCtx, client.StreamOptions{Probes: []string{"uptime"}}, func(e client.Event) error {
+		event = e
+		return client.ErrStopStream
+	})
+	if err != nil || event.Type != "snapshot" || len(event.Probes) != 1 || event.Probes["uptime"] == nil {
+		t.Fatalf("Invalid event %+v: %v", event, err)
+	}
+
+	unauthorized, _ := client.New(fmt.Sprintf("http://127.0.0.1:%d", config.Server.Port), client.Options{Token: "wrong"})
+	if err := unauthorized.Stream(ctx, client.StreamOptions{}, func(client.Event) error { return nil }); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expecting an unauthorized error, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+"use strict";
+
+const refreshSeconds = Number(new URLSearchParams(window.location.search).get("refresh")) || 10;
+let historyAvailable = true;
+
+// The API token is given once in the fragment of the URL, which is never sent to
+// the server, and kept for the session. Without it, the browser asks for the
+// username and password when basic auth is enabled.
+const fragment = new URLSearchParams(window.location.hash.slice(1));
+if (fragment.has("token")) {
+  sessionStorage.setItem("token", fragment.get("token"));
+  history.replaceState(null, "", window.location.pathname + window.location.search);
+}
+
+// apiFetch requests a path of the API, sending the token when one was given
+function apiFetch(path) {
+  const token = sessionStorage.getItem("token");
+  return fetch(path, token ? { headers: { Authorization: "Bearer " + token } } : {});
+}
+
+function formatDuration(seconds) {
+  const days = Math.floor(seconds / 86400);
+  const hours = Math.floor((seconds % 86400) / 3600);
+  const minutes = Math.floor((seconds % 3600) / 60);
+  return (days > 0 ? days + "d " : "") + hours + "h " + minutes + "m";
+}
+
+function formatKiB(kib) {
+  return (kib / 1024 / 1024).toFixed(1) + " GiB";
+}
+
+function setGauge(element, ratio) {
+  element.style.width = Math.min(100, ratio * 100).toFixed(1) + "%";
+  element.classList.toggle("warning", ratio >= 0.8 && ratio < 0.9);
+  element.classList.toggle("critical", ratio >= 0.9);
+}
+
+// diskSeries returns the history series of a device, as named by the server
+function diskSeries(device) {
+  return "disk-usage.used{filesystem=" + device.filesystem + ",mountpoint=" + device.mountpoint + "}";
+}
+
+async function drawSparkline(svg, series) {
+  if (!historyAvailable) {
+    return;
+  }
+  const response = await apiFetch("api/history?series=" + encodeURIComponent(series));
+  if (!response.ok) {
+    historyAvailable = response.status !== 404;
+    return;
+  }
+  const history = await response.json();
+  const points = history.points || [];
+  if (points.length < 2) {
+    return;
+  }
+
+  const minTime = points[0].timestamp;
+  const maxTime = points[points.length - 1].timestamp;
+  const values = points.map((point) => point.value);
+  const minValue = Math.min(...values);
+  const maxValue = Math.max(...values);
+  const coordinates = points.map((point) => {
+    const x = ((point.timestamp - minTime) / (maxTime - minTime || 1)) * 100;
+    const y = 20 - ((point.value - minValue) / (maxValue - minValue || 1)) * 18 - 1;
+    return x.toFixed(2) + "," + y.toFixed(2);
+  });
+
+  svg.innerHTML = '<polyline points="' + coordinates.join(" ") + '"></polyline>';
+  svg.classList.add("visible");
+}
+
+function renderSystem(stats) {
+  const info = stats["system-info"] || {};
+  if (info.name) {
+    document.getElementById("hostname").textContent = info.name;
+    document.title = info.name + " - System monitor";
+  }
+  const list = document.getElementById("system-info");
+  list.innerHTML = "";
+  for (const [label, value] of [["OS", info["operating-system"]], ["Distro", info.distro], ["Kernel", info.kernel], ["Machine", info.machine]]) {
+    if (!value) {
+      continue;
+    }
+    const term = document.createElement("dt");
+    term.textContent = label;
+    const definition = document.createElement("dd");
+    definition.textContent = value;
+    list.append(term, definition);
+  }
+  document.getElementById("uptime").textContent = stats.uptime ? formatDuration(stats.uptime) : "-";
+}
+
+function renderRAM(stats) {
+  const ram = stats["ram-usage"];
+  const section = document.getElementById("ram");
+  if (!ram || !ram.available) {
+    section.hidden = true;
+    return;
+  }
+  section.hidden = false;
+  setGauge(document.getElementById("ram-gauge"), ram.used / ram.available);
+  document.getElementById("ram-text").textContent = formatKiB(ram.used) + " used of " + formatKiB(ram.available);
+  drawSparkline(document.getElementById("ram-sparkline"), "ram-usage.used");
+}
+
+function renderDisks(stats) {
+  const devices = stats["disk-usage"] || [];
+  const list = document.getElementById("disk-list");
+  document.getElementById("disks").hidden = devices.length === 0;
+  list.innerHTML = "";
+  for (const device of devices) {
+    const item = document.createElement("div");
+    item.className = "disk";
+
+    const text = document.createElement("p");
+    text.textContent = device.mountpoint + " (" + device.filesystem + ") - " + device.used + " GB / " + device.size + " GB";
+    if (device.forecast && device.forecast["full-soon"]) {
+      text.textContent += " - full in " + formatDuration(device.forecast["time-to-full"]);
+    }
+
+    const gauge = document.createElement("div");
+    gauge.className = "gauge";
+    const fill = document.createElement("div");
+    fill.className = "fill";
+    gauge.append(fill);
+    setGauge(fill, device.size ? device.used / device.size : 0);
+
+    const sparkline = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+    sparkline.setAttribute("class", "sparkline");
+    sparkline.setAttribute("viewBox", "0 0 100 20");
+    sparkline.setAttribute("preserveAspectRatio", "none");
+
+    item.append(text, gauge, sparkline);
+    list.append(item);
+    drawSparkline(sparkline, diskSeries(device));
+  }
+}
+
+function renderServices(stats) {
+  const services = stats["services-status"] || {};
+  const names = Object.keys(services).sort();
+  const list = document.getElementById("service-list");
+  document.getElementById("services").hidden = names.length === 0;
+  list.innerHTML = "";
+  for (const name of names) {
+    const badge = document.createElement("span");
+    badge.className = "badge " + (services[name] ? "active" : "inactive");
+    badge.textContent = name;
+    list.append(badge);
+  }
+}
+
+async function refresh() {
+  try {
+    const response = await apiFetch("api/stats");
+    if (response.status === 401) {
+      throw new Error("authentication required, open the dashboard with #token=<token>");
+    }
+    if (!response.ok) {
+      throw new Error(response.statusText);
+    }
+    const stats = await response.json();
+    renderSystem(stats);
+    renderRAM(stats);
+    renderDisks(stats);
+    renderServices(stats);
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (error) {
+    document.getElementById("updated").textContent = "Update failed: " + error.message;
+  }
+}
+
+refresh();
+setInterval(refresh, refreshSeconds * 1000);
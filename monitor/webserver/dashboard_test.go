@@ -0,0 +1,31 @@
+package webserver
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test that the embedded dashboard files are served
+func TestDashboardHandler(t *testing.T) {
+	handler := dashboardHandler()
+	for path, expected := range map[string]string{
+		"/":          "<!DOCTYPE html>",
+		"/app.js":    "api/stats",
+		"/style.css": ".gauge",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		if w.Code != 200 || !strings.Contains(string(body), expected) {
+			t.Fatalf("Invalid response for %q: %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/missing.js", nil))
+	if w.Code != 404 {
+		t.Fatalf("Expecting a 404 status, got %d", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package webserver
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcRequest describes a gRPC call as an HTTP request, so that it goes through the
+// same access control and authentication as the API
+func grpcRequest(ctx context.Context, method string) *http.Request {
+	r := &http.Request{Method: http.MethodPost, URL: &url.URL{Path: method}, Header: make(http.Header)}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			r.Header.Add("Authorization", value)
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+// checkGRPC applies the access control and the authentication of a front to a gRPC
+// call, which requires the read:stats scope
+func checkGRPC(f *front, ctx context.Context, method string) error {
+	r := grpcRequest(ctx, method)
+	switch code, reason, wait := f.access.admit(r); code {
+	case http.StatusForbidden:
+		auditDenied(r, code, reason)
+		return status.Error(codes.PermissionDenied, "Forbidden")
+	case http.StatusTooManyRequests:
+		return status.Errorf(codes.ResourceExhausted, "Too many requests, retry in %.0fs", math.Ceil(wait.Seconds()))
+	}
+	if len(f.authenticators) == 0 {
+		return nil
+	}
+	switch _, code, reason := authorize(f.authenticators, r, []string{scopeReadStats}); code {
+	case http.StatusForbidden:
+		auditDenied(r, code, reason)
+		return status.Error(codes.PermissionDenied, "Forbidden")
+	case http.StatusUnauthorized:
+		auditDenied(r, code, reason)
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return nil
+}
+
+// grpcOptions checks the gRPC calls with the current front, so that the access and
+// authentication changes apply without restarting the server
+func grpcOptions(current func() *front) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkGRPC(current(), ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, request)
+		}),
+		grpc.StreamInterceptor(func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkGRPC(current(), stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(server, stream)
+		}),
+	}
+}
@@ -0,0 +1,228 @@
+package webserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/aHugues/system-monitor/monitor/rpc"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// getGRPCStats calls GetStats with a token, retrying while the server is not available
+func getGRPCStats(client rpc.MonitorClient, token string) error {
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	var err error
+	for i := 0; i < 20; i++ {
+		callCtx, cancel := context.WithTimeout(ctx, time.Second)
+		_, err = client.GetStats(callCtx, &rpc.GetStatsRequest{})
+		cancel()
+		if status.Code(err) != codes.Unavailable {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return err
+}
+
+// Test that the gRPC server uses the TLS, authentication and access settings of the API
+func TestAgentGRPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey, _, _ := testCertificate(t, 1, nil, nil)
+	_, _, certPEM, keyPEM := testCertificate(t, 2, ca, caKey)
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600)
+
+	config := testAgentConfig(t)
+	config.Server.GRPCPort = freePort(t)
+	config.Server.TLS.Cert = filepath.Join(dir, "cert.pem")
+	config.Server.TLS.Key = filepath.Join(dir, "key.pem")
+	config.Server.Auth = utils.AuthConfig{Tokens: []utils.TokenConfig{
+		{Name: "reader", Hash: hashToken("reader-token"), Scopes: []string{scopeReadStats}},
+		{Name: "alerts", Hash: hashToken("alerts-token"), Scopes: []string{scopeReadAlerts}},
+	}}
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+
+	address := fmt.Sprintf("127.0.0.1:%d", config.Server.GRPCPort)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := rpc.NewMonitorClient(conn)
+
+	if err := getGRPCStats(client, "reader-token"); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if err := getGRPCStats(client, ""); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expecting an unauthenticated error, got %v", err)
+	}
+	if err := getGRPCStats(client, "alerts-token"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expecting a permission denied error, got %v", err)
+	}
+
+	plain, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if err := getGRPCStats(rpc.NewMonitorClient(plain), "reader-token"); err == nil {
+		t.Fatal("Expecting plaintext calls to fail")
+	}
+
+	// The access changes apply without restarting the server
+	restricted := config
+	restricted.Server.Access.AllowedNetworks = []string{"10.0.0.0/8"}
+	if err := a.apply(restricted); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if err := getGRPCStats(client, "reader-token"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expecting a permission denied error, got %v", err)
+	}
+}
+
+// Test that the agent fails to start when the gRPC port is in use, releasing the HTTP port
+func TestAgentGRPCPortInUse(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+
+	config := testAgentConfig(t)
+	config.Server.Host = "127.0.0.1"
+	config.Server.GRPCPort = occupied.Addr().(*net.TCPAddr).Port
+	if err := newAgent(config).apply(config); err == nil {
+		t.Fatal("Expecting an error when the gRPC port is in use")
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", config.Server.Port))
+	if err != nil {
+		t.Fatal("Expecting the HTTP port to be released")
+	}
+	listener.Close()
+}
+
+// Test that the streams end when the agent shuts down, before the timeout
+func TestAgentGRPCShutdown(t *testing.T) {
+	config := testAgentConfig(t)
+	config.Server.GRPCPort = freePort(t)
+	config.Server.ShutdownTimeout = 10
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", config.Server.GRPCPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := rpc.NewMonitorClient(conn).WatchStats(context.Background(), &rpc.WatchStatsRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	// The subscription is registered asynchronously, collect until a message arrives
+	received := make(chan error)
+	go func() {
+		_, err := stream.Recv()
+		received <- err
+	}()
+	for waiting := true; waiting; {
+		select {
+		case err := <-received:
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			waiting = false
+		case <-time.After(50 * time.Millisecond):
+			a.collector.Collect()
+		}
+	}
+
+	start := time.Now()
+	a.shutdown()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Shutdown waited %s for the stream", elapsed)
+	}
+}
+
+// Test that reloading changes the gRPC probes without restarting the server, and
+// keeps the server when the new port cannot be bound
+func TestAgentGRPCReload(t *testing.T) {
+	config := testAgentConfig(t)
+	config.Server.GRPCPort = freePort(t)
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer a.shutdown()
+	a.collector.Collect()
+	server := a.grpc.server
+
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", config.Server.GRPCPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := rpc.NewMonitorClient(conn)
+	if _, err := client.GetUptime(context.Background(), &rpc.GetUptimeRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expecting the disabled probe to fail, got %v", err)
+	}
+
+	reloaded := config
+	reloaded.Probes.Uptime = true
+	if err := a.apply(reloaded); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if a.grpc.server != server {
+		t.Fatal("Expecting the gRPC server to be kept")
+	}
+	if _, err := client.GetUptime(context.Background(), &rpc.GetUptimeRequest{}); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+	invalid := reloaded
+	invalid.Probes.RAMUsage = true
+	invalid.Server.GRPCPort = occupied.Addr().(*net.TCPAddr).Port
+	if err := a.apply(invalid); err == nil {
+		t.Fatal("Expecting an error when the gRPC port is in use")
+	}
+	if a.config.Server.GRPCPort != config.Server.GRPCPort || a.config.Probes.RAMUsage {
+		t.Fatal("Expecting the previous configuration to be kept")
+	}
+	if _, err := client.GetUptime(context.Background(), &rpc.GetUptimeRequest{}); err != nil {
+		t.Fatalf("Expecting the gRPC server to keep serving, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/history"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// openHistoryStore creates the history store described by the configuration
+func openHistoryStore(config utils.HistoryConfig) (history.Store, error) {
+	retention := time.Duration(config.RetentionHours) * time.Hour
+	if config.Storage != "disk" {
+		log.Debug("Keeping history in memory")
+		return history.NewMemoryStore(retention), nil
+	}
+
+	log.Infof("Keeping history on disk in %q", config.DataDir)
+	return history.OpenDiskStore(config.DataDir, diskOptions(config))
+}
+
+// diskOptions returns the options of a disk store from the history configuration
+func diskOptions(config utils.HistoryConfig) history.DiskOptions {
+	return history.DiskOptions{
+		Retention:          time.Duration(config.RetentionHours) * time.Hour,
+		MaxSize:            int64(config.MaxSizeMB) * 1024 * 1024,
+		DownsampleAfter:    time.Duration(config.DownsampleAfter) * time.Hour,
+		DownsampleInterval: time.Duration(config.DownsampleInterval) * time.Second,
+		CompactInterval:    time.Minute,
+	}
+}
+
+// sameHistoryStore checks whether two history configurations use the same store,
+// which can then be reconfigured instead of being opened again
+func sameHistoryStore(previous utils.HistoryConfig, config utils.HistoryConfig) bool {
+	if previous.Enabled != config.Enabled || (previous.Storage == "disk") != (config.Storage == "disk") {
+		return false
+	}
+	return config.Storage != "disk" || previous.DataDir == config.DataDir
+}
+
+// reconfigureHistoryStore applies the retention and downsampling settings to an open store
+func reconfigureHistoryStore(store history.Store, config utils.HistoryConfig) {
+	switch s := store.(type) {
+	case *history.MemoryStore:
+		s.SetRetention(time.Duration(config.RetentionHours) * time.Hour)
+	case *history.DiskStore:
+		s.SetOptions(diskOptions(config))
+	}
+}
+
+// recordHistory returns a collector subscriber writing every snapshot to the store
+func recordHistory(store history.Store) func(collector.Snapshot) {
+	return func(snapshot collector.Snapshot) {
+		samples := snapshot.Stats.HistorySamples()
+		entries := make([]history.Entry, 0, len(samples))
+		for _, sample := range samples {
+			entries = append(entries, history.Entry{
+				Series: sample.Series(),
+				Point:  history.Point{Timestamp: snapshot.Time.Unix(), Value: sample.Value},
+			})
+		}
+		if err := store.Append(entries); err != nil {
+			log.Errorf("Error writing history: %q", err)
+		}
+	}
+}
+
+// parseTimeParam reads a unix timestamp from the query, using the fallback when missing
+func parseTimeParam(r *http.Request, name string, fallback time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// historyHandler returns the points of a series, or the list of series when none is given
+func historyHandler(store history.Store, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	series := r.URL.Query().Get("series")
+	if series == "" {
+		names, err := store.Series()
+		if err != nil {
+			log.Errorf("Error listing history series: %q", err)
+			http.Error(w, "Error reading history", http.StatusInternalServerError)
+			return
+		}
+		b, _ := json.Marshal(names)
+		w.Write(b)
+		return
+	}
+
+	now := time.Now()
+	to, err := parseTimeParam(r, "to", now)
+	if err != nil {
+		http.Error(w, "Invalid 'to' parameter", http.StatusBadRequest)
+		return
+	}
+	from, err := parseTimeParam(r, "from", to.Add(-time.Hour))
+	if err != nil {
+		http.Error(w, "Invalid 'from' parameter", http.StatusBadRequest)
+		return
+	}
+
+	points, err := store.Query(series, from, to)
+	if err != nil {
+		log.Errorf("Error querying history: %q", err)
+		http.Error(w, "Error reading history", http.StatusInternalServerError)
+		return
+	}
+
+	b, _ := json.Marshal(history.SeriesPoints{Series: series, From: from.Unix(), To: to.Unix(), Points: points})
+	w.Write(b)
+}
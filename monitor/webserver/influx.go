@@ -0,0 +1,19 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/outputs"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// influxHandler returns the stats rendered as InfluxDB line protocol
+func influxHandler(config utils.FullConfiguration, statsCollector *collector.Collector, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	snapshot := statsCollector.Current()
+	lines := outputs.RenderInflux(snapshot.Stats, snapshot.Time, outputs.InfluxHostTags(config.Outputs.Influx))
+	w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
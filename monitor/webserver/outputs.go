@@ -0,0 +1,90 @@
+package webserver
+
+import (
+	"sync"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/outputs"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+// outputGroup holds the outputs pushing the collected stats
+type outputGroup struct {
+	stop        chan struct{}
+	running     sync.WaitGroup
+	unsubscribe []func()
+	closers     []func()
+}
+
+// run starts a background task of the group
+func (g *outputGroup) run(task func(stop <-chan struct{})) {
+	g.running.Add(1)
+	go func() {
+		defer g.running.Done()
+		task(g.stop)
+	}()
+}
+
+// startOutputs subscribes the configured outputs to the collector
+func startOutputs(config utils.OutputsConfig, statsCollector *collector.Collector) *outputGroup {
+	g := &outputGroup{stop: make(chan struct{})}
+
+	if config.Influx.WriteURL != "" {
+		pusher := outputs.NewInfluxPusher(config.Influx)
+		g.unsubscribe = append(g.unsubscribe, statsCollector.Subscribe(pusher.Add))
+		g.run(pusher.Run)
+	}
+
+	if config.Statsd.Address != "" {
+		emitter, err := outputs.NewStatsdEmitter(config.Statsd)
+		if err != nil {
+			log.Errorf("Impossible to create StatsD emitter: %q", err)
+		} else {
+			g.unsubscribe = append(g.unsubscribe, statsCollector.Subscribe(emitter.Emit))
+			g.closers = append(g.closers, func() { emitter.Close() })
+		}
+	}
+
+	if config.Graphite.Address != "" {
+		pusher := outputs.NewGraphitePusher(config.Graphite)
+		g.unsubscribe = append(g.unsubscribe, statsCollector.Subscribe(pusher.Add))
+		g.run(pusher.Run)
+	}
+
+	if config.OTLP.Endpoint != "" {
+		exporter, err := outputs.NewOTLPExporter(config.OTLP, probes.GetSystemInfo(probes.LinuxCommandRunner{}))
+		if err != nil {
+			log.Errorf("Impossible to create OTLP exporter: %q", err)
+		} else {
+			g.unsubscribe = append(g.unsubscribe, statsCollector.Subscribe(exporter.Add))
+			g.run(exporter.Run)
+		}
+	}
+
+	if config.MQTT.Broker != "" {
+		publisher, err := outputs.NewMQTTPublisher(config.MQTT)
+		if err != nil {
+			log.Errorf("Impossible to connect to MQTT broker: %q", err)
+		} else {
+			g.unsubscribe = append(g.unsubscribe, statsCollector.Subscribe(publisher.Add))
+			g.run(publisher.Run)
+			g.closers = append(g.closers, publisher.Close)
+		}
+	}
+	return g
+}
+
+// Stop flushes and closes the outputs
+func (g *outputGroup) Stop() {
+	for _, unsubscribe := range g.unsubscribe {
+		unsubscribe()
+	}
+	close(g.stop)
+	g.running.Wait()
+	for _, closer := range g.closers {
+		closer()
+	}
+}
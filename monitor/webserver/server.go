@@ -1,23 +1,28 @@
 package webserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/stats"
 	"github.com/aHugues/system-monitor/monitor/utils"
 
 	log "github.com/cihub/seelog"
 )
 
 // statsHandler returns a JSON array with the data from the various system probes
-func statsHandler(config utils.ProbesConfig, w http.ResponseWriter, r *http.Request) {
+func statsHandler(statsCollector *collector.Collector, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	fullStats := getFullStats(config)
-
-	b, err := json.Marshal(fullStats)
+	b, err := json.Marshal(statsCollector.Current().Stats)
 	if err != nil {
 		log.Error(err)
 		os.Exit(1)
@@ -25,17 +30,124 @@ func statsHandler(config utils.ProbesConfig, w http.ResponseWriter, r *http.Requ
 	w.Write(b)
 }
 
-// RunServer run the main API to expose server usage
-func RunServer(config utils.FullConfiguration) {
+// probeHandler returns the last result of a single enabled probe
+func probeHandler(config utils.ProbesConfig, statsCollector *collector.Collector, w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/stats/")
+	enabled := false
+	for _, probe := range stats.EnabledProbes(config) {
+		enabled = enabled || probe == name
+	}
+	if !enabled {
+		http.Error(w, fmt.Sprintf("Unknown or disabled probe %q", name), http.StatusNotFound)
+		return
+	}
+
+	probes, err := statsCollector.Current().Stats.Probes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if value, ok := probes[name]; ok {
+		w.Write(value)
+		return
+	}
+	w.Write([]byte("null"))
+}
+
+// alertsHandler returns the alerts firing at the last collection
+func alertsHandler(statsCollector *collector.Collector, w http.ResponseWriter, r *http.Request) {
+	alerts := statsCollector.Current().Alerts
+	if alerts == nil {
+		alerts = []stats.Alert{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, err := json.Marshal(alerts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
+// configHandler returns the effective configuration, secrets hidden
+func configHandler(config utils.FullConfiguration, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	b, err := json.Marshal(utils.RedactConfig(config))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
+// ReloadOptions tells the server how to reload its configuration
+type ReloadOptions struct {
+	// Load reads the configuration again, reloading being disabled when nil
+	Load func() (utils.FullConfiguration, error)
+	// Files trigger a reload when they change and the watch-config setting is enabled
+	Files []string
+	// Dirs trigger a reload when any of their files changes and the watch-config setting is enabled
+	Dirs []string
+}
+
+// RunServer run the main API to expose server usage until a termination signal
+// is received, returning an error when the server cannot start. The configuration
+// is reloaded on SIGHUP.
+func RunServer(config utils.FullConfiguration, reload ReloadOptions) error {
 	defer log.Flush()
 
 	log.Info("Starting server")
-	http.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
-		statsHandler(config.Probes, w, r)
-	})
 
-	listenFullHost := fmt.Sprintf("%s:%d", config.Server.Host, config.Server.Port)
-	log.Debugf("Server listening on %q", listenFullHost)
+	a := newAgent(config)
+	if err := a.apply(config); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	changes := make(chan struct{}, 1)
+	if reload.Load != nil && len(reload.Files)+len(reload.Dirs) > 0 {
+		watchStop := make(chan struct{})
+		defer close(watchStop)
+		if err := watchFiles(reload.Files, reload.Dirs, changes, watchStop); err != nil {
+			log.Warnf("Impossible to watch configuration files: %q", err)
+		}
+	}
 
-	http.ListenAndServe(listenFullHost, nil)
+	for {
+		select {
+		case err := <-a.serveErrors:
+			a.shutdown()
+			return err
+		case <-changes:
+			if a.config.Server.WatchConfig {
+				a.reload(reload.Load)
+			}
+		case received := <-signals:
+			if received == syscall.SIGHUP {
+				a.reload(reload.Load)
+				continue
+			}
+			log.Infof("Received %s, shutting down", received)
+			a.shutdown()
+			return nil
+		}
+	}
+}
+
+// shutdown stops accepting connections and waits for the requests in flight
+// until the timeout, closing the remaining connections afterwards
+func shutdown(server *http.Server, stopBackground func(), timeout time.Duration) {
+	// Streams only end when the background tasks stop, so they are stopped first
+	stopBackground()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Requests still in flight after %s, closing connections", timeout)
+		server.Close()
+	}
+	log.Info("Server stopped")
 }
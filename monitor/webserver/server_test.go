@@ -0,0 +1,67 @@
+package webserver
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test that an error is returned when the port is already in use
+func TestRunServerBindError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	config := utils.NewConfig()
+	config.Server.Port = listener.Addr().(*net.TCPAddr).Port
+	config.History.Enabled = false
+	if err := RunServer(config, ReloadOptions{}); err == nil {
+		t.Fatal("Expecting an error when the port is in use")
+	}
+}
+
+// Test that the requests in flight are completed and that the background tasks are stopped
+func TestShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+	go server.Serve(listener)
+
+	responses := make(chan string)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	stopped := false
+	shutdown(server, func() { stopped = true }, time.Second)
+	if !stopped {
+		t.Fatal("Background tasks not stopped")
+	}
+	if response := <-responses; response != "done" {
+		t.Fatalf("Request in flight not completed: %q", response)
+	}
+	if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Fatal("Expecting the server to be stopped")
+	}
+}
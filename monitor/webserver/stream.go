@@ -0,0 +1,172 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+
+	log "github.com/cihub/seelog"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+// streamOptions holds the parameters selected by a stream client
+type streamOptions struct {
+	probes   map[string]bool
+	interval time.Duration
+	deltas   bool
+}
+
+// parseStreamOptions reads the probes, interval and mode parameters of a stream request
+func parseStreamOptions(r *http.Request, minInterval time.Duration) (streamOptions, error) {
+	options := streamOptions{interval: minInterval}
+	query := r.URL.Query()
+
+	if probes := query.Get("probes"); probes != "" {
+		options.probes = make(map[string]bool)
+		for _, probe := range strings.Split(probes, ",") {
+			options.probes[strings.TrimSpace(probe)] = true
+		}
+	}
+
+	if interval := query.Get("interval"); interval != "" {
+		seconds, err := strconv.Atoi(interval)
+		if err != nil || seconds <= 0 {
+			return options, fmt.Errorf("Invalid interval %q", interval)
+		}
+		// Stats cannot be sent faster than they are collected
+		if requested := time.Duration(seconds) * time.Second; requested > minInterval {
+			options.interval = requested
+		}
+	}
+
+	switch query.Get("mode") {
+	case "", "snapshot":
+	case "delta":
+		options.deltas = true
+	default:
+		return options, fmt.Errorf("Invalid mode %q", query.Get("mode"))
+	}
+	return options, nil
+}
+
+// streamEvent builds the next event for a snapshot, returning false when there is
+// nothing to send. In delta mode, only the probes that changed since the last event
+// are sent.
+func streamEvent(snapshot collector.Snapshot, options streamOptions, previous map[string]json.RawMessage) (string, bool) {
+	probes, err := snapshot.Stats.Probes()
+	if err != nil {
+		log.Errorf("Error serializing stats: %q", err)
+		return "", false
+	}
+
+	payload := make(map[string]json.RawMessage)
+	for probe, value := range probes {
+		if options.probes != nil && !options.probes[probe] {
+			continue
+		}
+		if options.deltas && bytes.Equal(previous[probe], value) {
+			continue
+		}
+		previous[probe] = value
+		payload[probe] = value
+	}
+	if options.deltas && len(payload) == 0 {
+		return "", false
+	}
+
+	b, _ := json.Marshal(payload)
+	event := "snapshot"
+	if options.deltas {
+		event = "delta"
+	}
+	return fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", snapshot.Time.Unix(), event, b), true
+}
+
+// streamHandler sends the collected stats as Server-Sent Events until the client
+// disconnects or the server stops
+func streamHandler(statsCollector *collector.Collector, done <-chan struct{}, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	options, err := parseStreamOptions(r, statsCollector.Interval())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only the latest snapshot is kept when the client is slower than the collector
+	snapshots := make(chan collector.Snapshot, 1)
+	unsubscribe := statsCollector.Subscribe(func(snapshot collector.Snapshot) {
+		select {
+		case <-snapshots:
+		default:
+		}
+		select {
+		case snapshots <- snapshot:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	log.Debugf("Stream client connected from %q", r.RemoteAddr)
+
+	previous := make(map[string]json.RawMessage)
+	var lastSent time.Time
+	send := func(snapshot collector.Snapshot) error {
+		event, ok := streamEvent(snapshot, options, previous)
+		lastSent = snapshot.Time
+		if !ok {
+			return nil
+		}
+		if _, err := w.Write([]byte(event)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if latest, ok := statsCollector.Latest(); ok {
+		if err := send(latest); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debugf("Stream client %q disconnected", r.RemoteAddr)
+			return
+		case <-done:
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case snapshot := <-snapshots:
+			// Leave a small margin so that the collection jitter does not skip a whole interval
+			if snapshot.Time.Sub(lastSent) < options.interval-time.Second {
+				continue
+			}
+			if err := send(snapshot); err != nil {
+				return
+			}
+		}
+	}
+}
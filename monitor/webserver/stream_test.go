@@ -0,0 +1,109 @@
+package webserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// Test the selection of probes and the delta mode
+func TestStreamEvent(t *testing.T) {
+	options := streamOptions{probes: map[string]bool{"ram-usage": true, "uptime": true}, deltas: true}
+	previous := make(map[string]json.RawMessage)
+	snapshot := collector.Snapshot{
+		Time:  time.Unix(1600000000, 0),
+		Stats: stats.FullStats{RAMUsage: probes.RAMStats{Available: 10, Used: 5}, Uptime: 100},
+	}
+
+	event, ok := streamEvent(snapshot, options, previous)
+	if !ok || event != "id: 1600000000\nevent: delta\ndata: {\"ram-usage\":{\"available\":10,\"used\":5,\"free\":0,\"shared\":0},\"uptime\":100}\n\n" {
+		t.Fatalf("Invalid event %q", event)
+	}
+
+	snapshot.Time = time.Unix(1600000010, 0)
+	snapshot.Stats.Uptime = 110
+	event, ok = streamEvent(snapshot, options, previous)
+	if !ok || event != "id: 1600000010\nevent: delta\ndata: {\"uptime\":110}\n\n" {
+		t.Fatalf("Invalid event %q", event)
+	}
+
+	if _, ok = streamEvent(snapshot, options, previous); ok {
+		t.Fatal("Expecting no event without changes")
+	}
+}
+
+// Test the validation of the stream parameters
+func TestStreamOptions(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/stream?interval=1&probes=uptime", nil)
+	options, err := parseStreamOptions(r, 10*time.Second)
+	if err != nil || options.interval != 10*time.Second || !options.probes["uptime"] || options.deltas {
+		t.Fatalf("Invalid options %+v", options)
+	}
+
+	r = httptest.NewRequest("GET", "/api/v1/stream?interval=60&mode=delta", nil)
+	options, err = parseStreamOptions(r, 10*time.Second)
+	if err != nil || options.interval != time.Minute || options.probes != nil || !options.deltas {
+		t.Fatalf("Invalid options %+v", options)
+	}
+
+	for _, query := range []string{"interval=-1", "interval=abc", "mode=other"} {
+		r = httptest.NewRequest("GET", "/api/v1/stream?"+query, nil)
+		if _, err := parseStreamOptions(r, 10*time.Second); err == nil {
+			t.Fatalf("Expecting an error for %q", query)
+		}
+	}
+}
+
+// Test that a client receives the snapshots and that its handler exits on disconnection
+func TestStreamHandler(t *testing.T) {
+	statsCollector := collector.New(utils.ProbesConfig{Interval: 1})
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamHandler(statsCollector, done, w, r)
+		close(returned)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"?probes=uptime,ram-usage", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("Invalid content type")
+	}
+
+	statsCollector.Collect()
+	reader := bufio.NewReader(response.Body)
+	lines := []string{}
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading stream: %q", err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if lines[1] != "event: snapshot" || lines[2] != `data: {"ram-usage":{"available":0,"used":0,"free":0,"shared":0}}` {
+		t.Fatalf("Invalid event %q", lines)
+	}
+
+	cancel()
+	response.Body.Close()
+	select {
+	case <-returned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Handler still running after disconnection")
+	}
+}
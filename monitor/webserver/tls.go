@@ -0,0 +1,188 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+
+	log "github.com/cihub/seelog"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// modernCipherSuites only allows forward-secret AEAD ciphers for TLS 1.2,
+// TLS 1.3 suites are not configurable and always secure
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// cipherSuites returns the TLS 1.2 cipher suites allowed by a policy, nil meaning the Go defaults
+func cipherSuites(policy string) ([]uint16, error) {
+	switch policy {
+	case "", "intermediate":
+		return nil, nil
+	case "modern":
+		return modernCipherSuites, nil
+	}
+	return nil, fmt.Errorf("Unknown cipher policy %q", policy)
+}
+
+// certReloader holds the certificates of the server and reloads them when their files change
+type certReloader struct {
+	config utils.TLSConfig
+
+	mu       sync.RWMutex
+	current  *tls.Config
+	modTimes map[string]time.Time
+}
+
+// newCertReloader loads the configured certificates
+func newCertReloader(config utils.TLSConfig) (*certReloader, error) {
+	if config.Cert == "" || config.Key == "" {
+		return nil, fmt.Errorf("Both a certificate and a key are required for TLS")
+	}
+	reloader := &certReloader{config: config}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// files returns the certificate files to watch
+func (r *certReloader) files() []string {
+	files := []string{r.config.Cert, r.config.Key}
+	if r.config.ClientCA != "" {
+		files = append(files, r.config.ClientCA)
+	}
+	return files
+}
+
+// load builds a new TLS configuration from the certificate files
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	minVersion, ok := tlsVersions[r.config.MinVersion]
+	if !ok {
+		return fmt.Errorf("Unknown TLS version %q", r.config.MinVersion)
+	}
+	suites, err := cipherSuites(r.config.CipherPolicy)
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(r.config.Cert, r.config.Key)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: suites,
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.config.ClientCA != "" {
+		ca, err := ioutil.ReadFile(r.config.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("No certificate found in %q", r.config.ClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = tlsConfig
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed checks whether a certificate file was modified since the last load
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// The files may be missing for a moment while they are being replaced
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the certificates again when they changed, keeping the previous ones on error
+func (r *certReloader) reload() {
+	if !r.changed() {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.Errorf("Impossible to reload TLS certificates, keeping the previous ones: %q", err)
+		return
+	}
+	log.Info("TLS certificates reloaded")
+}
+
+// Run checks the certificate files at every interval until stop is closed
+func (r *certReloader) Run(stop <-chan struct{}) {
+	interval := time.Duration(r.config.ReloadInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.reload()
+		}
+	}
+}
+
+// TLSConfig returns a server configuration always using the latest certificates
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.current, nil
+		},
+		// Only used by the server to know that certificates are provided
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &r.current.Certificates[0], nil
+		},
+	}
+}
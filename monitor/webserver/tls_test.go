@@ -0,0 +1,147 @@
+package webserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+// testCertificate creates a certificate signed by parent, or self-signed when parent is nil
+func testCertificate(t *testing.T, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "system-monitor"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return certificate, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// Test that client certificates are required when a client CA is set, and that
+// the server certificate is reloaded when its file changes
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey, caPEM, _ := testCertificate(t, 1, nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCertificate(t, 2, ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCertificate(t, 3, ca, caKey)
+	config := utils.TLSConfig{
+		Cert:         filepath.Join(dir, "server.pem"),
+		Key:          filepath.Join(dir, "server.key"),
+		ClientCA:     filepath.Join(dir, "ca.pem"),
+		MinVersion:   "1.2",
+		CipherPolicy: "modern",
+	}
+	ioutil.WriteFile(config.Cert, serverPEM, 0600)
+	ioutil.WriteFile(config.Key, serverKeyPEM, 0600)
+	ioutil.WriteFile(config.ClientCA, caPEM, 0600)
+
+	reloader, err := newCertReloader(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = reloader.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCertificate, _ := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	connect := func(certificates []tls.Certificate) (*tls.ConnectionState, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}}
+		response, err := client.Get(server.URL)
+		if err != nil {
+			return nil, err
+		}
+		response.Body.Close()
+		return response.TLS, nil
+	}
+
+	if _, err := connect(nil); err == nil {
+		t.Fatal("Expecting an error without client certificate")
+	}
+	state, err := connect([]tls.Certificate{clientCertificate})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if state.PeerCertificates[0].SerialNumber.Int64() != 2 {
+		t.Fatal("Invalid server certificate")
+	}
+
+	_, _, serverPEM, serverKeyPEM = testCertificate(t, 4, ca, caKey)
+	ioutil.WriteFile(config.Cert, serverPEM, 0600)
+	ioutil.WriteFile(config.Key, serverKeyPEM, 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(config.Cert, later, later)
+	reloader.reload()
+
+	state, err = connect([]tls.Certificate{clientCertificate})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if state.PeerCertificates[0].SerialNumber.Int64() != 4 {
+		t.Fatal("Server certificate not reloaded")
+	}
+
+	// An invalid certificate is ignored and the previous one is kept
+	ioutil.WriteFile(config.Cert, []byte("invalid"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(config.Cert, later, later)
+	reloader.reload()
+	if _, err := connect([]tls.Certificate{clientCertificate}); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+}
+
+// Test the validation of the TLS options
+func TestCertReloaderOptions(t *testing.T) {
+	if _, err := newCertReloader(utils.TLSConfig{Cert: "cert.pem"}); err == nil {
+		t.Fatal("Expecting an error without key")
+	}
+	if _, err := cipherSuites("unknown"); err == nil {
+		t.Fatal("Expecting an error for an unknown cipher policy")
+	}
+	if suites, err := cipherSuites("intermediate"); err != nil || suites != nil {
+		t.Fatal("Expecting the default cipher suites")
+	}
+}
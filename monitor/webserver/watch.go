@@ -0,0 +1,92 @@
+package webserver
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	log "github.com/cihub/seelog"
+)
+
+// watchDebounce groups the events of a file being written in several steps
+const watchDebounce = 500 * time.Millisecond
+
+// watchFiles notifies changes when any of the files, or of the files of the
+// directories, is written, created, replaced or removed, until stop is closed.
+// The parent directories are watched, so that files replaced by editors or
+// configuration management are still followed.
+func watchFiles(files []string, dirs []string, changes chan<- struct{}, stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	watched := make(map[string]bool)
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		watched[path] = true
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	watchedDirs := make(map[string]bool)
+	for _, dir := range dirs {
+		path, err := filepath.Abs(dir)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		// The directory itself is followed through its parent, and its files
+		// only when it exists
+		watched[path] = true
+		watchedDirs[path] = true
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+			return err
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Debugf("Not watching missing configuration directory %q", path)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		debounce := time.NewTimer(watchDebounce)
+		debounce.Stop()
+		for {
+			select {
+			case <-stop:
+				debounce.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				if watchedDirs[name] && event.Has(fsnotify.Create) {
+					watcher.Add(name)
+				}
+				if (watched[name] || watchedDirs[filepath.Dir(name)]) && !event.Has(fsnotify.Chmod) {
+					debounce.Reset(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("Error watching configuration files: %q", err)
+			case <-debounce.C:
+				log.Debug("Configuration files changed")
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return nil
+}
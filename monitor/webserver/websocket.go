@@ -0,0 +1,281 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/stats"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	wsSendBuffer   = 16
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// wsRequest is a message sent by a WebSocket client, Alerts subscribing to the
+// alert events or unsubscribing from them
+type wsRequest struct {
+	Action   string   `json:"action"`
+	Probes   []string `json:"probes,omitempty"`
+	Alerts   bool     `json:"alerts,omitempty"`
+	Interval int      `json:"interval,omitempty"`
+}
+
+// wsMessage is a message sent to a WebSocket client
+type wsMessage struct {
+	Type      string                     `json:"type"`
+	Timestamp int64                      `json:"timestamp,omitempty"`
+	Data      map[string]json.RawMessage `json:"data,omitempty"`
+	Probes    []string                   `json:"probes,omitempty"`
+	Alerts    *bool                      `json:"alerts,omitempty"`
+	Interval  int                        `json:"interval,omitempty"`
+	Message   string                     `json:"message,omitempty"`
+	Firing    []stats.Alert              `json:"firing,omitempty"`
+	Alert     *stats.AlertEvent          `json:"alert,omitempty"`
+}
+
+// wsClient holds the subscriptions of a WebSocket connection
+type wsClient struct {
+	conn   *websocket.Conn
+	remote string
+	send   chan wsMessage
+	// minInterval returns the current collection interval, which changes on reload
+	minInterval func() time.Duration
+	// readStats and readAlerts are the scopes granted to the client
+	readStats  bool
+	readAlerts bool
+	latest     func() (collector.Snapshot, bool)
+
+	mu     sync.Mutex
+	probes map[string]bool
+	alerts bool
+	// interval is the one requested by the client, 0 for the collection interval
+	interval time.Duration
+	lastSent time.Time
+	closed   bool
+	dropped  bool
+}
+
+// subscriptions returns the sorted list of subscribed probes
+func (c *wsClient) subscriptions() []string {
+	probes := []string{}
+	for probe := range c.probes {
+		probes = append(probes, probe)
+	}
+	sort.Strings(probes)
+	return probes
+}
+
+// enqueue queues a message without blocking, dropping the client when it cannot keep up
+func (c *wsClient) enqueue(message wsMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- message:
+	default:
+		log.Warnf("Dropping slow WebSocket client %q", c.remote)
+		c.closed = true
+		c.dropped = true
+		close(c.send)
+	}
+}
+
+// currentInterval returns the interval between two stats, never shorter than the
+// collection interval. It must be called with the lock held.
+func (c *wsClient) currentInterval() time.Duration {
+	if minInterval := c.minInterval(); c.interval < minInterval {
+		return minInterval
+	}
+	return c.interval
+}
+
+// onSnapshot sends the alert events of a snapshot to the clients subscribed to them,
+// and its subscribed probes when the client interval elapsed
+func (c *wsClient) onSnapshot(snapshot collector.Snapshot) {
+	c.mu.Lock()
+	alerts := c.alerts
+	c.mu.Unlock()
+	if alerts {
+		for i := range snapshot.Events {
+			c.enqueue(wsMessage{Type: "alert", Timestamp: snapshot.Time.Unix(), Alert: &snapshot.Events[i]})
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.probes) == 0 || snapshot.Time.Sub(c.lastSent) < c.currentInterval()-time.Second {
+		c.mu.Unlock()
+		return
+	}
+	c.lastSent = snapshot.Time
+	subscribed := make(map[string]bool)
+	for probe := range c.probes {
+		subscribed[probe] = true
+	}
+	c.mu.Unlock()
+
+	probes, err := snapshot.Stats.Probes()
+	if err != nil {
+		log.Errorf("Error serializing stats: %q", err)
+		return
+	}
+	data := make(map[string]json.RawMessage)
+	for probe, value := range probes {
+		if subscribed[probe] {
+			data[probe] = value
+		}
+	}
+	c.enqueue(wsMessage{Type: "stats", Timestamp: snapshot.Time.Unix(), Data: data})
+}
+
+// handle applies a client request and returns the replies, the alerts firing being
+// sent when subscribing to them
+func (c *wsClient) handle(request wsRequest) []wsMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	replies := []wsMessage{}
+	switch request.Action {
+	case "subscribe":
+		for _, probe := range request.Probes {
+			if !stats.IsProbeName(probe) {
+				return []wsMessage{{Type: "error", Message: fmt.Sprintf("Unknown probe %q", probe)}}
+			}
+		}
+		if len(request.Probes) > 0 && !c.readStats {
+			return []wsMessage{{Type: "error", Message: fmt.Sprintf("Missing scope %q", scopeReadStats)}}
+		}
+		if request.Alerts && !c.readAlerts {
+			return []wsMessage{{Type: "error", Message: fmt.Sprintf("Missing scope %q", scopeReadAlerts)}}
+		}
+		for _, probe := range request.Probes {
+			c.probes[probe] = true
+		}
+		if request.Alerts && !c.alerts {
+			c.alerts = true
+			firing := wsMessage{Type: "alerts", Firing: []stats.Alert{}}
+			if snapshot, ok := c.latest(); ok {
+				firing.Timestamp, firing.Firing = snapshot.Time.Unix(), snapshot.Alerts
+			}
+			replies = append(replies, firing)
+		}
+	case "unsubscribe":
+		for _, probe := range request.Probes {
+			delete(c.probes, probe)
+		}
+		if request.Alerts {
+			c.alerts = false
+		}
+	case "set-interval":
+		if request.Interval <= 0 {
+			return []wsMessage{{Type: "error", Message: "Invalid interval"}}
+		}
+		c.interval = time.Duration(request.Interval) * time.Second
+	default:
+		return []wsMessage{{Type: "error", Message: fmt.Sprintf("Unknown action %q", request.Action)}}
+	}
+	alerts := c.alerts
+	subscriptions := wsMessage{Type: "subscriptions", Probes: c.subscriptions(), Alerts: &alerts, Interval: int(c.currentInterval() / time.Second)}
+	return append([]wsMessage{subscriptions}, replies...)
+}
+
+// writeLoop sends the queued messages and the pings until the client is closed
+func (c *wsClient) writeLoop(done <-chan struct{}) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-done:
+			c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server stopping"), time.Now().Add(wsWriteTimeout))
+			return
+		case message, ok := <-c.send:
+			if !ok {
+				c.mu.Lock()
+				dropped := c.dropped
+				c.mu.Unlock()
+				if dropped {
+					c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Client too slow"), time.Now().Add(wsWriteTimeout))
+				}
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// websocketHandler lets a client subscribe to the probes it wants to receive, with
+// the read:stats scope, and to the alert events, with the read:alerts scope
+func websocketHandler(statsCollector *collector.Collector, done <-chan struct{}, w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warnf("WebSocket upgrade failed: %q", err)
+		return
+	}
+	log.Debugf("WebSocket client connected from %q", r.RemoteAddr)
+
+	client := &wsClient{
+		conn:        conn,
+		remote:      r.RemoteAddr,
+		send:        make(chan wsMessage, wsSendBuffer),
+		minInterval: statsCollector.Interval,
+		readStats:   requestAllows(r, scopeReadStats),
+		readAlerts:  requestAllows(r, scopeReadAlerts),
+		latest:      statsCollector.Latest,
+		probes:      make(map[string]bool),
+	}
+	unsubscribe := statsCollector.Subscribe(client.onSnapshot)
+	writerDone := make(chan struct{})
+	go func() {
+		client.writeLoop(done)
+		close(writerDone)
+	}()
+
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		var request wsRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			break
+		}
+		for _, reply := range client.handle(request) {
+			client.enqueue(reply)
+		}
+	}
+
+	unsubscribe()
+	client.mu.Lock()
+	if !client.closed {
+		client.closed = true
+		close(client.send)
+	}
+	client.mu.Unlock()
+	<-writerDone
+	log.Debugf("WebSocket client %q disconnected", r.RemoteAddr)
+}
@@ -0,0 +1,136 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/aHugues/system-monitor/monitor/collector"
+	"github.com/aHugues/system-monitor/monitor/probes"
+	"github.com/aHugues/system-monitor/monitor/stats"
+	"github.com/aHugues/system-monitor/monitor/utils"
+)
+
+func dialTestWebsocket(t *testing.T, statsCollector *collector.Collector) (*websocket.Conn, func()) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocketHandler(statsCollector, done, w, r)
+	}))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Impossible to connect: %q", err)
+	}
+	return conn, func() {
+		conn.Close()
+		close(done)
+		server.Close()
+	}
+}
+
+// Test subscribing to a probe and receiving its stats
+func TestWebsocketSubscribe(t *testing.T) {
+	statsCollector := collector.New(utils.ProbesConfig{Interval: 1})
+	conn, cleanup := dialTestWebsocket(t, statsCollector)
+	defer cleanup()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	conn.WriteJSON(wsRequest{Action: "subscribe", Probes: []string{"ram-usage", "alerts"}})
+	var reply wsMessage
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "error" {
+		t.Fatalf("Expecting an error for an unknown probe, got %+v", reply)
+	}
+
+	conn.WriteJSON(wsRequest{Action: "subscribe", Probes: []string{"ram-usage"}})
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "subscriptions" || len(reply.Probes) != 1 || reply.Interval != 1 {
+		t.Fatalf("Invalid subscriptions %+v", reply)
+	}
+
+	statsCollector.Collect()
+	var message wsMessage
+	if err := conn.ReadJSON(&message); err != nil || message.Type != "stats" || len(message.Data) != 1 || message.Data["ram-usage"] == nil {
+		t.Fatalf("Invalid stats message %+v", message)
+	}
+}
+
+// Test that the clients follow the changes of the collection interval
+func TestWebsocketIntervalReload(t *testing.T) {
+	statsCollector := collector.New(utils.ProbesConfig{Uptime: true, Interval: 1})
+	client := &wsClient{send: make(chan wsMessage, 4), minInterval: statsCollector.Interval, readStats: true, probes: make(map[string]bool)}
+	if replies := client.handle(wsRequest{Action: "subscribe", Probes: []string{"uptime"}}); replies[0].Interval != 1 {
+		t.Fatalf("Invalid subscriptions %+v", replies[0])
+	}
+
+	statsCollector.Reconfigure(utils.ProbesConfig{Uptime: true, Interval: 10})
+	if replies := client.handle(wsRequest{Action: "set-interval", Interval: 5}); replies[0].Interval != 10 {
+		t.Fatalf("Expecting the collection interval, got %+v", replies[0])
+	}
+	snapshot := collector.Snapshot{Time: time.Now(), Stats: stats.FullStats{Uptime: 10}}
+	client.onSnapshot(snapshot)
+	snapshot.Time = snapshot.Time.Add(5 * time.Second)
+	client.onSnapshot(snapshot)
+	if len(client.send) != 1 {
+		t.Fatalf("Expecting a single message, got %d", len(client.send))
+	}
+}
+
+// Test that a client not reading its messages is dropped
+func TestWebsocketSlowClient(t *testing.T) {
+	client := &wsClient{send: make(chan wsMessage, 1), minInterval: func() time.Duration { return time.Second }, probes: map[string]bool{"uptime": true}}
+	snapshot := collector.Snapshot{Time: time.Now(), Stats: stats.FullStats{RAMUsage: probes.RAMStats{Used: 1}, Uptime: 10}}
+
+	client.onSnapshot(snapshot)
+	if client.dropped {
+		t.Fatal("Client dropped too early")
+	}
+	snapshot.Time = snapshot.Time.Add(time.Minute)
+	client.onSnapshot(snapshot)
+	if !client.dropped || !client.closed {
+		t.Fatal("Slow client not dropped")
+	}
+	if _, ok := <-client.send; !ok {
+		t.Fatal("Queued message lost")
+	}
+	if _, ok := <-client.send; ok {
+		t.Fatal("Send channel not closed")
+	}
+}
+
+// Test subscribing to the alert events, which requires the read:alerts scope
+func TestWebsocketAlerts(t *testing.T) {
+	alert := stats.Alert{Name: "disk-full-soon", Target: "/var", Message: "/var is expected to be full in 1h0m0s", Since: 1600000000}
+	latest := func() (collector.Snapshot, bool) {
+		return collector.Snapshot{Time: time.Unix(1600000010, 0), Alerts: []stats.Alert{alert}}, true
+	}
+	client := &wsClient{send: make(chan wsMessage, 4), minInterval: func() time.Duration { return time.Second }, readStats: true, latest: latest, probes: make(map[string]bool)}
+	if replies := client.handle(wsRequest{Action: "subscribe", Alerts: true}); len(replies) != 1 || replies[0].Type != "error" {
+		t.Fatalf("Expecting an error without the read:alerts scope, got %+v", replies)
+	}
+
+	client.readStats, client.readAlerts = false, true
+	if replies := client.handle(wsRequest{Action: "subscribe", Probes: []string{"uptime"}}); len(replies) != 1 || replies[0].Type != "error" {
+		t.Fatalf("Expecting an error without the read:stats scope, got %+v", replies)
+	}
+	replies := client.handle(wsRequest{Action: "subscribe", Alerts: true})
+	if len(replies) != 2 || replies[0].Type != "subscriptions" || !*replies[0].Alerts {
+		t.Fatalf("Invalid subscriptions %+v", replies)
+	}
+	if replies[1].Type != "alerts" || len(replies[1].Firing) != 1 || replies[1].Firing[0] != alert {
+		t.Fatalf("Expecting the firing alerts, got %+v", replies[1])
+	}
+
+	event := stats.AlertEvent{Alert: alert, State: stats.AlertResolved}
+	client.onSnapshot(collector.Snapshot{Time: time.Unix(1600000020, 0), Events: []stats.AlertEvent{event}})
+	if message := <-client.send; message.Type != "alert" || *message.Alert != event {
+		t.Fatalf("Invalid alert event %+v", message)
+	}
+
+	client.handle(wsRequest{Action: "unsubscribe", Alerts: true})
+	client.onSnapshot(collector.Snapshot{Time: time.Unix(1600000030, 0), Events: []stats.AlertEvent{event}})
+	if len(client.send) != 0 {
+		t.Fatal("Alert event sent after unsubscribing")
+	}
+}